@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/outbox"
+	"github.com/zhasm/tts-reader/internal/project"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+func runBuild(args []string) error {
+	fs := newFlagSet("build", "[lesson...]")
+	file := fs.StringP("file", "f", project.DEFAULT_PROJECT_FILE, "project file")
+	jobs := fs.IntP("jobs", "j", runtime.NumCPU(), "number of outputs built in parallel")
+	force := fs.BoolP("force", "B", false, "rebuild every output, even up-to-date ones")
+	dryRun := fs.BoolP("dry-run", "n", false, "only list the outputs that would be built")
+	publish := fs.BoolP("publish", "p", false, "upload built outputs and append their records")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+
+	p, err := project.Load(*file)
+	if err != nil {
+		return err
+	}
+	targets, err := p.Targets(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	manifest, err := project.LoadManifest(p.OutputDir())
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		for _, t := range targets {
+			stale, err := manifest.Stale(t)
+			if err != nil {
+				return err
+			}
+			if *force || stale {
+				fmt.Printf("%s <- %s\n", utils.ToHomeRelativePath(t.Output), utils.ToHomeRelativePath(t.Source))
+			}
+		}
+		return nil
+	}
+
+	if err := config.RequireAPIKey(); err != nil {
+		return err
+	}
+	if *publish {
+		if err := config.RequireDBToken(); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	results, buildErr := project.Build(manifest, targets, *jobs, *force)
+	logger.LogInfo("Built %d of %d outputs, took %.3f(s)", len(results), len(targets), time.Since(start).Seconds())
+
+	if *publish {
+		if err := publishResults(results); err != nil {
+			return err
+		}
+	}
+	if buildErr != nil {
+		return fmt.Errorf("build failed: %w", buildErr)
+	}
+	return nil
+}
+
+// publishResults uploads the built outputs and appends their records in
+// batches rather than one request each.
+func publishResults(results []project.Result) error {
+	var (
+		reqs    []tts.TTSRequest
+		stages  [][]history.Stage
+		records []storage.Record
+	)
+	for _, r := range results {
+		req := tts.NewTTSRequest(r.Content, r.Target.Lang.NameFUll, r.Target.Lang.Reader, r.Target.Speed)
+		req.Dest = r.Target.Output
+		req.Md5 = r.Key
+		s, err := runFunctionsConcurrently([]func(tts.TTSRequest) (bool, error){storage.Upload}, req)
+		if err != nil {
+			recordHistory(req, s)
+			return fmt.Errorf("publishing %s failed: %w", r.Target.Output, err)
+		}
+		record, err := storage.NewRecord(req)
+		if err != nil {
+			recordHistory(req, s)
+			return fmt.Errorf("publishing %s failed: %w", r.Target.Output, err)
+		}
+		reqs, stages, records = append(reqs, req), append(stages, s), append(records, record)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := storage.AppendRecords(records)
+	stage := history.Stage{Name: "storage.AppendRecords", OK: err == nil, Queued: errors.Is(err, outbox.ErrQueued), Took: time.Since(start)}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	for i, req := range reqs {
+		recordHistory(req, append(stages[i], stage))
+	}
+	if err != nil && !stage.Queued {
+		return fmt.Errorf("appending records failed: %w", err)
+	}
+	_, err = storage.FlushOutbox(tts.TTSRequest{})
+	return err
+}
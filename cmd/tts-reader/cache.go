@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// cacheCommands are the subcommands of `tts-reader cache`.
+var cacheCommands = []command{
+	{"ls", "list cached audio, least recently used first", runCacheLs},
+	{"info", "show the details of one cached file", runCacheInfo},
+	{"prune", "evict what exceeds the size and age limits", runCachePrune},
+	{"verify", "check the index against the files on disk", runCacheVerify},
+	{"migrate", "re-key files cached under the legacy MD5 scheme", runCacheMigrate},
+}
+
+func runCache(args []string) error {
+	if len(args) > 0 {
+		for _, c := range cacheCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage of %s cache <command>:\n", os.Args[0])
+	for _, c := range cacheCommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown cache command: %s", args[0])
+}
+
+func runCacheLs(args []string) error {
+	fs := newFlagSet("cache ls", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	ix, err := cache.Load(config.TTS_PATH)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tLANG\tSIZE\tDURATION\tLAST USED\tCONTENT")
+	for _, e := range ix.Sorted() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fs\t%s\t%s\n", e.Key[:min(len(e.Key), 8)], langShortName(e.Lang),
+			formatSize(e.Size), e.Duration.Seconds(), e.LastUsed().Format(time.DateTime), truncate(e.Content, 40))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d files, %s in %s\n", len(ix.Entries), formatSize(ix.TotalSize()), utils.ToHomeRelativePath(ix.Dir()))
+	return nil
+}
+
+func runCacheInfo(args []string) error {
+	fs := newFlagSet("cache info", "<md5>")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one key")
+	}
+	ix, err := cache.Load(config.TTS_PATH)
+	if err != nil {
+		return err
+	}
+	e, err := ix.Find(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Key:\t%s\n", e.Key)
+	fmt.Fprintf(w, "File:\t%s\n", utils.ToHomeRelativePath(ix.Path(e)))
+	fmt.Fprintf(w, "Content:\t%s\n", e.Content)
+	fmt.Fprintf(w, "Language:\t%s\n", e.Lang)
+	fmt.Fprintf(w, "Voice:\t%s\n", e.Voice)
+	fmt.Fprintf(w, "Speed:\t%.1f\n", e.Speed)
+	fmt.Fprintf(w, "Format:\t%s\n", e.Format)
+	fmt.Fprintf(w, "Size:\t%s\n", formatSize(e.Size))
+	fmt.Fprintf(w, "Duration:\t%.2fs\n", e.Duration.Seconds())
+	fmt.Fprintf(w, "Created:\t%s\n", e.Created.Format(time.DateTime))
+	if !e.LastPlayed.IsZero() {
+		fmt.Fprintf(w, "Last played:\t%s\n", e.LastPlayed.Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func runCachePrune(args []string) error {
+	fs := newFlagSet("cache prune", "")
+	maxSize := fs.String("max-size", "", "largest total size, e.g. 500MB (default: cache.max_size of the config)")
+	maxAge := fs.Duration("max-age", 0, "evict files not used for longer, e.g. 720h (default: cache.max_age of the config)")
+	dryRun := fs.BoolP("dry-run", "n", false, "only list the files that would be evicted")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	limits, err := cache.ConfiguredLimits()
+	if err != nil {
+		return err
+	}
+	if fs.Changed("max-size") {
+		if limits.MaxSize, err = config.ParseSize(*maxSize); err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+	}
+	if fs.Changed("max-age") {
+		limits.MaxAge = *maxAge
+	}
+	if limits.MaxSize == 0 && limits.MaxAge == 0 {
+		return fmt.Errorf("no limit set: pass --max-size or --max-age, or set them in the cache section of the config")
+	}
+
+	var evicted []*cache.Entry
+	err = cache.Update(config.TTS_PATH, func(ix *cache.Index) error {
+		var err error
+		evicted, err = ix.Prune(limits, time.Now(), *dryRun)
+		return err
+	})
+	var freed int64
+	for _, e := range evicted {
+		freed += e.Size
+		fmt.Printf("%s  %s  %s\n", e.Key, formatSize(e.Size), truncate(e.Content, 60))
+	}
+	verb := "Evicted"
+	if *dryRun {
+		verb = "Would evict"
+	}
+	logger.LogInfo("%s %d files, %s", verb, len(evicted), formatSize(freed))
+	return err
+}
+
+func runCacheVerify(args []string) error {
+	fs := newFlagSet("cache verify", "")
+	fix := fs.Bool("fix", false, "drop missing entries, quarantine corrupt files and index untracked ones")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	var report cache.Report
+	err := cache.Update(config.TTS_PATH, func(ix *cache.Index) error {
+		var err error
+		report, err = ix.Verify(*fix)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range []struct {
+		label string
+		keys  []string
+	}{
+		{"missing", report.Missing},
+		{"corrupt", report.Corrupt},
+		{"resized", report.Resized},
+		{"untracked", report.Untracked},
+	} {
+		for _, key := range p.keys {
+			fmt.Printf("%-10s %s\n", p.label, key)
+		}
+	}
+	logger.LogInfo("Checked %d entries: %d missing, %d corrupt, %d resized, %d untracked",
+		report.Checked, len(report.Missing), len(report.Corrupt), len(report.Resized), len(report.Untracked))
+	if !report.OK() && !*fix {
+		return fmt.Errorf("cache has problems, run with --fix to repair them")
+	}
+	return nil
+}
+
+// runCacheMigrate renames the files indexed under a legacy MD5 key to their
+// versioned key. The MD5 stays an alias in the index, and the uploaded
+// objects keep their names, so published URLs and records still resolve.
+func runCacheMigrate(args []string) error {
+	fs := newFlagSet("cache migrate", "")
+	dryRun := fs.BoolP("dry-run", "n", false, "only list the files that would be re-keyed")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	var migrated, kept int
+	err := cache.Update(config.TTS_PATH, func(ix *cache.Index) error {
+		for _, e := range ix.Sorted() {
+			if !tts.IsLegacyKey(e.Key) {
+				continue
+			}
+			req := tts.NewTTSRequest(e.Content, e.Lang, e.Voice, e.Speed)
+			// Only entries whose parameters reproduce their key are known to
+			// hold the audio the new key describes.
+			if e.Content == "" || tts.LegacyKey(req) != e.Key {
+				logger.LogDebug("Keeping %s: its parameters are unknown", e.Key)
+				kept++
+				continue
+			}
+			file := req.Md5 + filepath.Ext(e.File)
+			fmt.Printf("%s -> %s  %s\n", e.Key, req.Md5[:16], truncate(e.Content, 40))
+			migrated++
+			if *dryRun {
+				continue
+			}
+			if err := os.Rename(ix.Path(e), filepath.Join(ix.Dir(), file)); err != nil {
+				return err
+			}
+			if err := ix.Rekey(e.Key, req.Md5, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	verb := "Migrated"
+	if *dryRun {
+		verb = "Would migrate"
+	}
+	logger.LogInfo("%s %d files; kept %d under their MD5 name, they are adopted when next read", verb, migrated, kept)
+	return err
+}
+
+// formatSize prints a byte count with a binary unit, as ParseSize reads it.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// truncate shortens s to n runes on a single line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
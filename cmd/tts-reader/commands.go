@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// command is a subcommand such as `tts-reader build`. Its run function gets
+// the arguments following the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands in the order they are shown in the usage.
+var commands = []command{
+	{"build", "build the stale outputs of a tts-project.yml", runBuild},
+	{"cache", "list, prune and verify the local audio cache", runCache},
+	{"export", "export tagged readings as Anki notes or a playlist", runExport},
+	{"feed", "generate a podcast RSS feed of published audio", runFeed},
+	{"history", "list, search, show, delete and replay records", runHistory},
+	{"outbox", "list and replay uploads and records that failed", runOutbox},
+	{"queue", "list, skip and stop the readings of the playback queue daemon", runQueue},
+	{"repl", "read lines interactively, with :commands to change settings", runREPL},
+	{"srt", "synthesize an .srt file into one track timed like the subtitles", runSRT},
+	{"sync", "reconcile the local cache, the bucket and the records", runSync},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func commandsUsage() string {
+	var b strings.Builder
+	b.WriteString("Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(&b, "\nRun '%s <command> --help' for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(&b, "To read aloud a text that is a command name, put it after --: '%s -- sync'.\n", os.Args[0])
+	return b.String()
+}
+
+// dispatch runs the subcommand named by the first argument, or the default
+// read-aloud mode when there is none.
+func dispatch() error {
+	config.UsageFooter = commandsUsage()
+	tts.Remote = storage.NewTeamCache()
+	if c, found := commandOf(os.Args[1:]); found {
+		return c.run(os.Args[2:])
+	}
+	return run()
+}
+
+// commandOf returns the subcommand args start with. Only the very first
+// argument names one: after a flag or --, a command name is text to read.
+func commandOf(args []string) (command, bool) {
+	if len(args) == 0 {
+		return command{}, false
+	}
+	return findCommand(args[0])
+}
+
+// newFlagSet returns the flag set of a subcommand with a usage line that
+// mirrors the top-level one.
+func newFlagSet(name, args string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s %s %s:\n", os.Args[0], name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// initCommand parses the flags of a subcommand and loads the config.
+func initCommand(fs *pflag.FlagSet, args []string) error {
+	logger.Init()
+	err := config.InitCommand(fs, args)
+	if errors.Is(err, pflag.ErrHelp) {
+		os.Exit(0)
+	}
+	return err
+}
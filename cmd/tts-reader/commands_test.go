@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestCommandOf(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"sync", "--dry-run"}, "sync"},
+		{[]string{"-l", "fr", "sync"}, ""},
+		{[]string{"--", "sync"}, ""},
+		{[]string{"bonjour"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		c, found := commandOf(tt.args)
+		if found != (tt.want != "") || c.name != tt.want {
+			t.Errorf("commandOf(%q) = %q, %v; want %q", tt.args, c.name, found, tt.want)
+		}
+	}
+}
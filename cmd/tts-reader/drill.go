@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/player"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// drillRequests returns a request per speed of the ladder, each read and
+// cached on its own, or req alone without a ladder.
+func drillRequests(req tts.TTSRequest) ([]tts.TTSRequest, error) {
+	if len(config.Ladder) == 0 {
+		return []tts.TTSRequest{req}, nil
+	}
+	reqs := make([]tts.TTSRequest, 0, len(config.Ladder))
+	for _, speed := range config.Ladder {
+		if speed < MIN_SPEED || speed > MAX_SPEED {
+			return nil, fmt.Errorf("ladder speed %g is not between %.1f and %.1f", speed, MIN_SPEED, MAX_SPEED)
+		}
+		r := tts.NewTTSRequest(req.Content, req.Lang, req.Reader, speed)
+		r.Tags, r.Note = req.Tags, req.Note
+		reqs = append(reqs, r)
+	}
+	return reqs, nil
+}
+
+// runDrill synthesizes and publishes each variant of req like a reading of
+// its own, then plays them in sequence with the configured repeats and gaps.
+func runDrill(req tts.TTSRequest) error {
+	reqs, err := drillRequests(req)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(reqs))
+	var publishErr error
+	for _, r := range reqs {
+		synth, err := synthesize(r)
+		if err != nil {
+			recordHistory(r, []history.Stage{synth})
+			return fmt.Errorf("TTS request at speed %g failed: %w", r.Speed, err)
+		}
+		logger.LogDebug("Speed %g read, took %.3f(s)", r.Speed, synth.Took.Seconds())
+		stages := []history.Stage{synth}
+		if !config.DryRun {
+			published, err := runFunctionsConcurrently(buildPublishPipeline(), r)
+			stages = append(stages, published...)
+			if err != nil && publishErr == nil {
+				publishErr = err
+			}
+		}
+		recordHistory(r, stages)
+		files = append(files, r.Dest)
+	}
+	logger.LogInfo("🔁 Playing %d variants %d times, %s apart", len(files), config.Repeat, config.Gap)
+	if err := player.PlayDrill(files, config.Repeat, config.Gap); err != nil {
+		return err
+	}
+	return publishErr
+}
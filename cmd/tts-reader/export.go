@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/export"
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	DEFAULT_EXPORT_NAME      = "tts-reader"
+	DEFAULT_TRANSLATION_LANG = "en"
+)
+
+// exportCommands are the subcommands of `tts-reader export`. They export the
+// readings of the local history, typically those of a tag, or build study
+// material from lists of texts.
+var exportCommands = []command{
+	{"anki", "write the readings as Anki notes, with their audio", runExportAnki},
+	{"drill", "put lists of texts together as drill tracks with cue sheets", runExportDrill},
+	{"playlist", "write the readings as an M3U playlist", runExportPlaylist},
+}
+
+func runExport(args []string) error {
+	if len(args) > 0 {
+		for _, c := range exportCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage of %s export <command>:\n", os.Args[0])
+	for _, c := range exportCommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown export command: %s", args[0])
+}
+
+// exportEntries returns the latest reading of each audio matching the
+// flags, oldest first, the order they were studied in.
+func exportEntries(f historyFilterFlags) ([]history.Entry, error) {
+	q, err := f.query("", 0)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := history.Open(config.TTS_PATH).Query(q)
+	if err != nil {
+		return nil, err
+	}
+	entries = history.Latest(entries)
+	slices.Reverse(entries)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no readings to export")
+	}
+	return entries, nil
+}
+
+// exportName names the files of an export after its tags.
+func exportName(tags []string) string {
+	if len(tags) == 0 {
+		return DEFAULT_EXPORT_NAME
+	}
+	return strings.Join(strings.Fields(strings.Join(tags, "-")), "_")
+}
+
+// entryAudio returns the valid local audio of e, found through the cache when
+// the file it was written to is gone.
+func entryAudio(e history.Entry) (string, bool) {
+	if valid, _ := tts.IsAudioFileValid(e.Path); valid {
+		return e.Path, true
+	}
+	return cachedRecordAudio(storage.Record{Md5: e.Md5})
+}
+
+func runExportAnki(args []string) error {
+	fs := newFlagSet("export anki", "")
+	f := addHistoryFilterFlags(fs)
+	deck := fs.String("deck", "", "deck of the notes (default: the tags)")
+	output := fs.StringP("output", "o", "", "notes file; the audio goes to a .media directory next to it (default: <tags>.txt)")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	entries, err := exportEntries(f)
+	if err != nil {
+		return err
+	}
+	name := exportName(*f.tags)
+	if *deck == "" {
+		*deck = name
+	}
+	if *output == "" {
+		*output = name + ".txt"
+	}
+	media := strings.TrimSuffix(*output, filepath.Ext(*output)) + ".media"
+	if *output == "-" {
+		media = name + ".media"
+	}
+	if err := os.MkdirAll(media, 0755); err != nil {
+		return err
+	}
+
+	items := make([]export.Item, 0, len(entries))
+	for _, e := range entries {
+		path, ok := entryAudio(e)
+		if !ok {
+			logger.LogWarn("No audio for %s, skipped: %s", e.Md5, truncate(e.Content, 40))
+			continue
+		}
+		// The cache names WAV data .mp3, Anki goes by the extension.
+		dest := filepath.Join(media, "tts-"+e.Md5+audio.Extension(audio.MIMEType(path)))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := utils.WriteFileAtomic(dest, data, 0644); err != nil {
+			return err
+		}
+		items = append(items, export.Item{Text: e.Content, Note: e.Note, Tags: e.Tags, Audio: dest, Duration: e.Duration})
+	}
+	if err := writeExport(*output, func(w io.Writer) error { return export.Anki(w, *deck, items) }); err != nil {
+		return err
+	}
+	logger.LogInfo("Wrote %d notes to %s", len(items), *output)
+	logger.LogInfo("Copy the files of %s into the collection.media folder of Anki, then import %s", media, *output)
+	return nil
+}
+
+func runExportPlaylist(args []string) error {
+	fs := newFlagSet("export playlist", "")
+	f := addHistoryFilterFlags(fs)
+	urls := fs.Bool("urls", false, "list the published URLs instead of the local files")
+	output := fs.StringP("output", "o", "", "playlist file, - for stdout (default: <tags>.m3u)")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	entries, err := exportEntries(f)
+	if err != nil {
+		return err
+	}
+	name := exportName(*f.tags)
+	if *output == "" {
+		*output = name + ".m3u"
+	}
+
+	items := make([]export.Item, 0, len(entries))
+	for _, e := range entries {
+		it := export.Item{Text: e.Content, Note: e.Note, Tags: e.Tags, Audio: e.URL, Duration: e.Duration}
+		if !*urls {
+			path, ok := entryAudio(e)
+			if !ok {
+				logger.LogWarn("No audio for %s, skipped: %s", e.Md5, truncate(e.Content, 40))
+				continue
+			}
+			if it.Audio, err = filepath.Abs(path); err != nil {
+				return err
+			}
+		} else if it.Audio == "" {
+			logger.LogWarn("%s was not published, skipped: %s", e.Md5, truncate(e.Content, 40))
+			continue
+		}
+		items = append(items, it)
+	}
+	if err := writeExport(*output, func(w io.Writer) error { return export.M3U(w, name, items) }); err != nil {
+		return err
+	}
+	if *output != "-" {
+		logger.LogInfo("Wrote %d readings to %s", len(items), *output)
+	}
+	return nil
+}
+
+// writeExport writes an export to path, or to stdout for -.
+func writeExport(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	var b strings.Builder
+	if err := write(&b); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, []byte(b.String()), 0644)
+}
+
+func runExportDrill(args []string) error {
+	fs := newFlagSet("export drill", "<list.txt>...")
+	fs.StringVarP(&config.Language, "language", "l", config.DEFAULT_LANGUAGE, "language of the texts ("+config.GetAllLangShortNamesStr()+")")
+	fs.Float64VarP(&config.Speed, "speed", "s", config.DEFAULT_SPEED, "speed (float)")
+	translationLang := fs.String("translation-lang", DEFAULT_TRANSLATION_LANG, "language of the translations")
+	template := fs.String("template", export.DEFAULT_DRILL_TEMPLATE, "segments of each item: target, translation and gaps, separated by arrows or commas")
+	output := fs.StringP("output", "o", "", "track of a single list, .wav or any format ffmpeg writes (default: the list with .wav)")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected drill lists")
+	}
+	if *output != "" && fs.NArg() > 1 {
+		return fmt.Errorf("--output needs a single list")
+	}
+	segments, err := export.ParseTemplate(*template)
+	if err != nil {
+		return err
+	}
+	if err := config.RequireAPIKey(); err != nil {
+		return err
+	}
+	lang, found := config.GetLang(config.Language)
+	if !found {
+		return fmt.Errorf("language not found: %s", config.Language)
+	}
+	tlang, found := config.GetLang(*translationLang)
+	if !found {
+		return fmt.Errorf("language not found: %s", *translationLang)
+	}
+
+	for _, list := range fs.Args() {
+		path := *output
+		if path == "" {
+			path = strings.TrimSuffix(list, filepath.Ext(list)) + ".wav"
+		}
+		if err := exportDrill(list, path, segments, lang, tlang); err != nil {
+			return fmt.Errorf("%s: %w", list, err)
+		}
+	}
+	return nil
+}
+
+// exportDrill joins the segments of the items of list into the track path,
+// with a cue sheet next to it.
+func exportDrill(list, path string, segments []export.Segment, lang, tlang config.Lang) error {
+	f, err := os.Open(list)
+	if err != nil {
+		return err
+	}
+	items, err := export.ReadDrillList(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no items")
+	}
+
+	start := time.Now()
+	track := audio.NewTrack(audio.DefaultFormat)
+	chapters := make([]export.Chapter, 0, len(items))
+	for i, it := range items {
+		title := it.Text
+		if it.Translation != "" {
+			title += " — " + it.Translation
+		}
+		chapters = append(chapters, export.Chapter{Title: title, Start: track.End()})
+		skipGap := false
+		for _, seg := range segments {
+			var pcm audio.PCM
+			switch seg.Kind {
+			case "":
+				// The gap after a missing translation goes with it.
+				if !skipGap {
+					track.Pad(track.End() + seg.Gap)
+				}
+				continue
+			case export.DRILL_TRANSLATION:
+				if skipGap = it.Translation == ""; skipGap {
+					continue
+				}
+				pcm, err = synthesizePCM(it.Translation, tlang, config.Speed)
+			case export.DRILL_TARGET:
+				skipGap = false
+				pcm, err = synthesizePCM(it.Text, lang, config.Speed)
+			}
+			if err != nil {
+				return fmt.Errorf("item %d: %w", i+1, err)
+			}
+			if _, err := track.Place(track.End(), pcm); err != nil {
+				return fmt.Errorf("item %d: %w", i+1, err)
+			}
+		}
+		logger.LogDebug("item %d at %s: %s", i+1, formatCueTime(chapters[i].Start), title)
+	}
+
+	if err := audio.Save(path, track.PCM); err != nil {
+		return err
+	}
+	cue := strings.TrimSuffix(path, filepath.Ext(path)) + ".cue"
+	name := strings.TrimSuffix(filepath.Base(list), filepath.Ext(list))
+	if err := writeExport(cue, func(w io.Writer) error { return export.CUE(w, name, path, chapters) }); err != nil {
+		return err
+	}
+	logger.LogInfo("Wrote %d items (%s) to %s and %s, took %.3f(s)",
+		len(items), formatCueTime(track.End()), path, cue, time.Since(start).Seconds())
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/feed"
+	"github.com/zhasm/tts-reader/internal/project"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	DEFAULT_FEED_KEY  = "feed.xml"
+	MAX_TITLE_LENGTH  = 80
+	DEFAULT_FEED_SIZE = 100
+)
+
+func runFeed(args []string) error {
+	fs := newFlagSet("feed", "")
+	projectFile := fs.String("project", "", "build the feed from this project's outputs instead of the history")
+	ch := feed.Channel{Category: "Education"}
+	fs.StringVar(&ch.Title, "title", "tts-reader", "feed title")
+	fs.StringVar(&ch.Description, "description", "Readings published by tts-reader", "feed description")
+	fs.StringVar(&ch.Link, "link", "", "feed website link (default: the public storage URL)")
+	fs.StringVar(&ch.Author, "author", "", "feed author")
+	fs.StringVar(&ch.Image, "image", "", "cover image URL")
+	fs.StringVar(&ch.Language, "feed-language", "", "feed language, e.g. fr-FR")
+	limit := fs.IntP("limit", "n", DEFAULT_FEED_SIZE, "maximum number of items, 0 for all")
+	output := fs.StringP("output", "o", "-", "output file, - for stdout")
+	upload := fs.BoolP("upload", "u", false, "upload the feed next to the audio")
+	key := fs.String("key", DEFAULT_FEED_KEY, "bucket key of the uploaded feed")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+
+	var (
+		items []feed.Item
+		err   error
+	)
+	if *projectFile != "" {
+		items, err = projectFeedItems(*projectFile)
+	} else {
+		if err := config.RequireDBToken(); err != nil {
+			return err
+		}
+		items, err = historyFeedItems()
+	}
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(items) > *limit {
+		items = newestItems(items, *limit)
+	}
+	if ch.Link == "" {
+		ch.Link = storage.PublicBase()
+	}
+	if *upload {
+		ch.SelfURL = storage.PublicBase() + "/" + *key
+	}
+
+	data, err := feed.Render(ch, items)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "-" {
+		if !*upload {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		path = filepath.Join(os.TempDir(), DEFAULT_FEED_KEY)
+		defer os.Remove(path)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	logger.LogInfo("Wrote feed with %d items to %s", len(items), path)
+
+	if *upload {
+		// The feed changes under the same key, so it is always replaced.
+		backend, err := storage.Configured()
+		if err != nil {
+			return err
+		}
+		if err := backend.Put(path, *key); err != nil {
+			return fmt.Errorf("uploading feed failed: %w", err)
+		}
+		logger.LogInfo("Feed published at %s", ch.SelfURL)
+	}
+	return nil
+}
+
+// historyFeedItems turns the records of the records service into feed items,
+// taking size and duration from the local cache when the audio is there.
+func historyFeedItems() ([]feed.Item, error) {
+	records, err := storage.ListRecords()
+	if err != nil {
+		return nil, err
+	}
+	// Migrated files are found through the aliases of the cache index.
+	ix, err := cache.Load(config.TTS_PATH)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]feed.Item, 0, len(records))
+	for _, r := range records {
+		if r.Md5 == "" {
+			continue
+		}
+		local := filepath.Join(config.TTS_PATH, r.Key())
+		if e, err := ix.Find(r.Md5); err == nil {
+			local = ix.Path(e)
+		}
+		it := feed.Item{
+			Title:       feedTitle(r.Language, r.Content),
+			Description: r.Content,
+			GUID:        r.Md5,
+			URL:         r.PublicURL(),
+			MIMEType:    audio.MIMEType(local),
+			Published:   r.Created(),
+		}
+		if fi, err := os.Stat(local); err == nil {
+			it.Size = fi.Size()
+			if it.Published.IsZero() {
+				it.Published = fi.ModTime()
+			}
+		} else {
+			// Without the file, the record tells what was published.
+			if r.Format != "" {
+				it.MIMEType = r.Format
+			}
+			it.Size = r.Size
+			if it.Size == 0 {
+				kb, _ := strconv.ParseInt(r.FileSizeKb, 10, 64)
+				it.Size = kb * 1024
+			}
+		}
+		if it.Published.IsZero() {
+			it.Published = time.Now()
+		}
+		if d, err := audio.FileDuration(local); err == nil {
+			it.Duration = d
+		} else {
+			it.Duration = estimateDuration(it.Size)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// projectFeedItems turns the outputs recorded in a project's build manifest
+// into feed items.
+func projectFeedItems(file string) ([]feed.Item, error) {
+	p, err := project.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	m, err := project.LoadManifest(p.OutputDir())
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Entries) == 0 {
+		return nil, fmt.Errorf("%s has no built outputs, run the build command first", file)
+	}
+	items := make([]feed.Item, 0, len(m.Entries))
+	for rel, e := range m.Entries {
+		output := filepath.Join(p.OutputDir(), filepath.FromSlash(rel))
+		name := strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+		description := ""
+		if src, err := os.ReadFile(e.Source); err == nil {
+			description = strings.Join(project.Phrases(string(src)), "\n")
+		}
+		items = append(items, feed.Item{
+			Title:       fmt.Sprintf("%s %s – %s", config.GetFlagByName(e.Lang), e.Lesson, name),
+			Description: description,
+			GUID:        e.Md5,
+			URL:         fmt.Sprintf("%s/%s%s", storage.PublicBase(), e.Md5, filepath.Ext(rel)),
+			MIMEType:    audio.MIMEType(output),
+			Size:        e.Size,
+			Duration:    e.Duration,
+			Published:   e.Built,
+		})
+	}
+	return items, nil
+}
+
+func feedTitle(lang, content string) string {
+	title := strings.Join(strings.Fields(content), " ")
+	if runes := []rune(title); len(runes) > MAX_TITLE_LENGTH {
+		title = string(runes[:MAX_TITLE_LENGTH]) + "..."
+	}
+	if flag := config.GetFlagByName(lang); flag != "" {
+		title = flag + " " + title
+	}
+	return title
+}
+
+// estimateDuration guesses the playing time of size bytes of TTS output.
+func estimateDuration(size int64) time.Duration {
+	return time.Duration(size * int64(time.Second) / int64(audio.DefaultFormat.BytesPerSecond()))
+}
+
+func newestItems(items []feed.Item, n int) []feed.Item {
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b feed.Item) int {
+		return b.Published.Compare(a.Published)
+	})
+	return sorted[:n]
+}
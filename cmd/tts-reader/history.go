@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/player"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const DEFAULT_HISTORY_SIZE = 20
+
+// historyCommands are the subcommands of `tts-reader history`. They read the
+// local history unless --remote asks for the records service.
+var historyCommands = []command{
+	{"list", "list the latest readings", runHistoryList},
+	{"search", "list the readings whose content contains a text", runHistorySearch},
+	{"show", "show the details of one reading", runHistoryShow},
+	{"tags", "list the tags with how many readings carry each", runHistoryTags},
+	{"delete", "delete a record from the records service", runHistoryDelete},
+	{"replay", "play a reading, downloading its audio if it is not cached", runHistoryReplay},
+}
+
+func runHistory(args []string) error {
+	if len(args) > 0 {
+		for _, c := range historyCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage of %s history <command>:\n", os.Args[0])
+	for _, c := range historyCommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown history command: %s", args[0])
+}
+
+// historyFilterFlags select readings of the local history.
+type historyFilterFlags struct {
+	lang  *string
+	since *string
+	until *string
+	tags  *[]string
+}
+
+func addHistoryFilterFlags(fs *pflag.FlagSet) historyFilterFlags {
+	return historyFilterFlags{
+		lang:  fs.StringP("lang", "l", "", "only readings of this language, e.g. fr"),
+		since: fs.String("since", "", "only readings from this date or age on, e.g. 2025-01-02 or 7d"),
+		until: fs.String("until", "", "only readings before this date or age"),
+		tags:  fs.StringSliceP("tag", "t", nil, "only readings carrying this tag (repeatable)"),
+	}
+}
+
+// query returns the local history query of the flags, text and limit.
+func (f historyFilterFlags) query(text string, limit int) (history.Query, error) {
+	now := time.Now()
+	q := history.Query{Lang: *f.lang, Text: text, Tags: *f.tags, Limit: limit}
+	var err error
+	if q.Since, err = history.ParseTime(*f.since, now); err != nil {
+		return q, fmt.Errorf("invalid --since: %w", err)
+	}
+	if q.Until, err = history.ParseTime(*f.until, now); err != nil {
+		return q, fmt.Errorf("invalid --until: %w", err)
+	}
+	return q, nil
+}
+
+// historyListFlags are the flags shared by list, search and tags.
+type historyListFlags struct {
+	historyFilterFlags
+	limit  *int
+	remote *bool
+	asJSON *bool
+}
+
+func addHistoryListFlags(fs *pflag.FlagSet) historyListFlags {
+	return historyListFlags{
+		historyFilterFlags: addHistoryFilterFlags(fs),
+		limit:              fs.IntP("limit", "n", DEFAULT_HISTORY_SIZE, "maximum number of readings, 0 for all"),
+		remote:             fs.Bool("remote", false, "query the records service instead of the local history"),
+		asJSON:             fs.Bool("json", false, "print the readings as JSON"),
+	}
+}
+
+func runHistoryList(args []string) error {
+	fs := newFlagSet("history list", "")
+	f := addHistoryListFlags(fs)
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	return listHistory(f, "")
+}
+
+func runHistorySearch(args []string) error {
+	fs := newFlagSet("history search", "<text>")
+	f := addHistoryListFlags(fs)
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected a text to search for")
+	}
+	return listHistory(f, strings.Join(fs.Args(), " "))
+}
+
+// listHistory prints the newest readings matching the flags and text.
+func listHistory(f historyListFlags, text string) error {
+	if *f.remote {
+		if *f.since != "" || *f.until != "" {
+			return fmt.Errorf("--since and --until only apply to the local history")
+		}
+		return listRemoteHistory(storage.RecordQuery{Language: *f.lang, Text: text, Tags: *f.tags}, f)
+	}
+	q, err := f.query(text, *f.limit)
+	if err != nil {
+		return err
+	}
+	entries, err := history.Open(config.TTS_PATH).Query(q)
+	if err != nil {
+		return err
+	}
+	if *f.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MD5\tLANG\tTIME\tDURATION\tSTATUS\tTAGS\tCONTENT")
+	for _, e := range entries {
+		status := "ok"
+		if !e.OK() {
+			status = "failed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fs\t%s\t%s\t%s\n", e.Md5[:min(len(e.Md5), 12)], e.Lang,
+			e.Time.Local().Format(time.DateTime), e.Duration.Seconds(), status, strings.Join(e.Tags, ","), truncate(e.Content, 60))
+	}
+	return w.Flush()
+}
+
+// listRemoteHistory prints the newest records of the records service
+// matching q.
+func listRemoteHistory(q storage.RecordQuery, f historyListFlags) error {
+	if err := config.RequireDBToken(); err != nil {
+		return err
+	}
+	records, err := storage.DefaultRecordsClient().List(q)
+	if err != nil {
+		return err
+	}
+	records = newestRecords(records, *f.limit)
+	if *f.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MD5\tLANG\tCREATED\tTAGS\tCONTENT")
+	for _, r := range records {
+		created := ""
+		if t := r.Created(); !t.IsZero() {
+			created = t.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Md5[:min(len(r.Md5), 12)], r.Language, created,
+			strings.Join(r.Tags, ","), truncate(r.Content, 60))
+	}
+	return w.Flush()
+}
+
+// newestRecords returns up to limit records, newest first. Records without a
+// creation time keep the order of the service, which lists oldest first.
+func newestRecords(records []storage.Record, limit int) []storage.Record {
+	out := slices.Clone(records)
+	slices.Reverse(out)
+	slices.SortStableFunc(out, func(a, b storage.Record) int {
+		return b.Created().Compare(a.Created())
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// findRecord parses the one md5 argument of fs and looks its record up.
+func findRecord(fs *pflag.FlagSet) (storage.Record, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return storage.Record{}, fmt.Errorf("expected one md5")
+	}
+	if err := config.RequireDBToken(); err != nil {
+		return storage.Record{}, err
+	}
+	return storage.DefaultRecordsClient().Find(fs.Arg(0))
+}
+
+func runHistoryShow(args []string) error {
+	fs := newFlagSet("history show", "<md5>")
+	remote := fs.Bool("remote", false, "show the record of the records service instead of the local history")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if !*remote {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("expected one md5")
+		}
+		e, err := history.Open(config.TTS_PATH).Find(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		printHistoryEntry(e)
+		return nil
+	}
+	r, err := findRecord(fs)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", r.ID)
+	fmt.Fprintf(w, "MD5:\t%s\n", r.Md5)
+	fmt.Fprintf(w, "Language:\t%s\n", r.Language)
+	fmt.Fprintf(w, "Content:\t%s\n", r.Content)
+	fmt.Fprintf(w, "Size:\t%s KB\n", r.FileSizeKb)
+	fmt.Fprintf(w, "Created:\t%s\n", r.CreatedAt)
+	if len(r.Tags) > 0 {
+		fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(r.Tags, ", "))
+	}
+	if r.Note != "" {
+		fmt.Fprintf(w, "Note:\t%s\n", r.Note)
+	}
+	fmt.Fprintf(w, "URL:\t%s\n", r.PublicURL())
+	if path, ok := cachedRecordAudio(r); ok {
+		fmt.Fprintf(w, "File:\t%s\n", utils.ToHomeRelativePath(path))
+	}
+	return w.Flush()
+}
+
+func printHistoryEntry(e history.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MD5:\t%s\n", e.Md5)
+	fmt.Fprintf(w, "Time:\t%s\n", e.Time.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "Language:\t%s\n", e.Lang)
+	fmt.Fprintf(w, "Content:\t%s\n", e.Content)
+	fmt.Fprintf(w, "Voice:\t%s\n", e.Voice)
+	fmt.Fprintf(w, "Speed:\t%.1f\n", e.Speed)
+	fmt.Fprintf(w, "Duration:\t%.2fs\n", e.Duration.Seconds())
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(e.Tags, ", "))
+	}
+	if e.Note != "" {
+		fmt.Fprintf(w, "Note:\t%s\n", e.Note)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(w, "File:\t%s\n", utils.ToHomeRelativePath(e.Path))
+	}
+	if e.URL != "" {
+		fmt.Fprintf(w, "URL:\t%s\n", e.URL)
+	}
+	for _, st := range e.Stages {
+		status := "ok"
+		switch {
+		case st.Queued:
+			status = "queued: " + st.Error
+		case !st.OK:
+			status = "failed: " + st.Error
+		}
+		fmt.Fprintf(w, "%s:\t%s, took %.3f(s)\n", st.Name, status, st.Took.Seconds())
+	}
+	w.Flush()
+}
+
+func runHistoryTags(args []string) error {
+	fs := newFlagSet("history tags", "")
+	f := addHistoryListFlags(fs)
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if *f.remote {
+		return fmt.Errorf("history tags only reads the local history")
+	}
+	// The limit applies to the tags listed, not to the readings counted.
+	q, err := f.query("", 0)
+	if err != nil {
+		return err
+	}
+	entries, err := history.Open(config.TTS_PATH).Query(q)
+	if err != nil {
+		return err
+	}
+	groups := history.GroupByTag(history.Latest(entries))
+	if *f.limit > 0 && len(groups) > *f.limit {
+		groups = groups[:*f.limit]
+	}
+	if *f.asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tREADINGS\tDURATION\tLAST")
+	for _, g := range groups {
+		var total time.Duration
+		for _, e := range g.Entries {
+			total += e.Duration
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.1fs\t%s\n", g.Tag, len(g.Entries), total.Seconds(),
+			g.Entries[0].Time.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+// recordHistory appends a run of req to the local history. Failing to do so
+// only warns: it must not fail the reading.
+func recordHistory(req tts.TTSRequest, stages []history.Stage) {
+	e := history.Entry{
+		Time:    time.Now(),
+		Content: req.Content,
+		Lang:    langShortName(req.Lang),
+		Voice:   req.Reader,
+		Speed:   req.Speed,
+		Md5:     req.Md5,
+		Path:    req.Dest,
+		Tags:    req.Tags,
+		Note:    req.Note,
+		Stages:  stages,
+	}
+	if d, err := audio.FileDuration(req.Dest); err == nil {
+		e.Duration = d
+	}
+	for _, st := range stages {
+		if st.Name == GetFuncName(storage.Upload) && st.OK {
+			e.URL = storage.PublicURL(req)
+		}
+	}
+	if err := history.Open(config.TTS_PATH).Append(e); err != nil {
+		logger.LogWarn("Could not record the history: %v", err)
+	}
+}
+
+func runHistoryDelete(args []string) error {
+	fs := newFlagSet("history delete", "<md5>")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	r, err := findRecord(fs)
+	if err != nil {
+		return err
+	}
+	if err := storage.DeleteRecord(r); err != nil {
+		return err
+	}
+	logger.LogInfo("Deleted record %s: %s", r.Md5, truncate(r.Content, 40))
+	return nil
+}
+
+func runHistoryReplay(args []string) error {
+	fs := newFlagSet("history replay", "<md5>")
+	fs.BoolVarP(&config.Wait, "wait", "w", false, "play in the foreground with controls")
+	fs.BoolVarP(&config.Interrupt, "interrupt", "i", false, "play now instead of after the queued readings")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one md5")
+	}
+	// The local history knows recent readings without the network, and
+	// where their audio was written.
+	var (
+		r    storage.Record
+		path string
+	)
+	if e, err := history.Open(config.TTS_PATH).Find(fs.Arg(0)); err == nil {
+		r = storage.Record{Md5: e.Md5, Language: e.Lang, Content: e.Content}
+		if valid, _ := tts.IsAudioFileValid(e.Path); valid {
+			path = e.Path
+		}
+	} else if r, err = findRecord(fs); err != nil {
+		return err
+	}
+	if path == "" {
+		var ok bool
+		if path, ok = cachedRecordAudio(r); !ok {
+			var err error
+			if path, err = downloadRecordAudio(r); err != nil {
+				return err
+			}
+		}
+	}
+	logger.LogInfo("%s %s", config.GetFlagByName(r.Language), r.Content)
+	_, err := player.PlayAudio(tts.TTSRequest{Content: r.Content, Lang: r.Language, Md5: r.Md5, Dest: path})
+	return err
+}
+
+// cachedRecordAudio returns the valid local file of r, found through the
+// cache index, which knows migrated keys by their aliases.
+func cachedRecordAudio(r storage.Record) (string, bool) {
+	path := filepath.Join(config.TTS_PATH, r.Key())
+	if ix, err := cache.Load(config.TTS_PATH); err == nil {
+		if e, err := ix.Find(r.Md5); err == nil {
+			path = ix.Path(e)
+		}
+	}
+	if valid, _ := tts.IsAudioFileValid(path); !valid {
+		return "", false
+	}
+	return path, true
+}
+
+// downloadRecordAudio fetches the published audio of r into the cache and
+// indexes it.
+func downloadRecordAudio(r storage.Record) (string, error) {
+	key := r.Key()
+	logger.LogInfo("Downloading %s", key)
+	data, err := storage.FetchPublished(key)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", key, err)
+	}
+	if _, err := audio.ProbeBytes(data); err != nil {
+		return "", fmt.Errorf("downloaded %s is not valid audio: %w", key, err)
+	}
+	path := filepath.Join(config.TTS_PATH, key)
+	if err := os.MkdirAll(config.TTS_PATH, 0755); err != nil {
+		return "", err
+	}
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		return "", err
+	}
+	e, err := cache.NewEntry(r.Md5, path)
+	if err != nil {
+		return "", err
+	}
+	e.Content, e.Lang, e.Created = r.Content, r.Language, time.Now()
+	// The index holds full language names, the records short ones.
+	if l, ok := config.GetLang(r.Language); ok {
+		e.Lang = l.NameFUll
+	}
+	if err := cache.Record(config.TTS_PATH, e); err != nil {
+		logger.LogWarn("Could not index %s: %v", path, err)
+	}
+	return path, nil
+}
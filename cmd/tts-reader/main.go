@@ -10,7 +10,7 @@ const (
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := dispatch(); err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
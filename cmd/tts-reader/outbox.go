@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// outboxCommands are the subcommands of `tts-reader outbox`.
+var outboxCommands = []command{
+	{"ls", "list the queued uploads and records", runOutboxLs},
+	{"flush", "replay the queued items that are due", runOutboxFlush},
+	{"drop", "remove a queued item without replaying it", runOutboxDrop},
+}
+
+func runOutbox(args []string) error {
+	if len(args) > 0 {
+		for _, c := range outboxCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage of %s outbox <command>:\n", os.Args[0])
+	for _, c := range outboxCommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown outbox command: %s", args[0])
+}
+
+func runOutboxLs(args []string) error {
+	fs := newFlagSet("outbox ls", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	ob := storage.DefaultOutbox()
+	items, err := ob.List()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+	for _, it := range items {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", it.ID, it.Kind, it.Attempts,
+			it.NextAttempt.Local().Format(time.DateTime), truncate(it.LastError, 60))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d items in %s\n", len(items), utils.ToHomeRelativePath(ob.Dir()))
+	return nil
+}
+
+func runOutboxFlush(args []string) error {
+	fs := newFlagSet("outbox flush", "")
+	all := fs.BoolP("all", "a", false, "replay every item, also those waiting for their next attempt")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	// Without a token, every queued record would fail its attempt.
+	if err := config.RequireDBToken(); err != nil {
+		return err
+	}
+	r, err := storage.FlushOutboxItems(*all)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("%d sent, %d failed, %d dropped, %d waiting", r.Sent, r.Failed, r.Dropped, r.Waiting)
+	if r.Failed > 0 {
+		return fmt.Errorf("%d items failed, see '%s outbox ls'", r.Failed, os.Args[0])
+	}
+	return nil
+}
+
+func runOutboxDrop(args []string) error {
+	fs := newFlagSet("outbox drop", "<id>")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one id")
+	}
+	return storage.DefaultOutbox().Remove(fs.Arg(0))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/player"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// queueCommands are the subcommands of `tts-reader queue`. While the daemon
+// runs, readings are played through its queue one after the other.
+var queueCommands = []command{
+	{"daemon", "run the playback queue in the foreground", runQueueDaemon},
+	{"ls", "list the reading playing and those queued", runQueueLs},
+	{"skip", "skip the reading playing", runQueueSkip},
+	{"stop", "stop playing and empty the queue", runQueueStop},
+}
+
+func runQueue(args []string) error {
+	if len(args) > 0 {
+		for _, c := range queueCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage of %s queue <command>:\n", os.Args[0])
+	for _, c := range queueCommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return nil
+	}
+	return fmt.Errorf("unknown queue command: %s", args[0])
+}
+
+func runQueueDaemon(args []string) error {
+	fs := newFlagSet("queue daemon", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	socket := config.PlayerSocket()
+	l, err := player.ListenQueue(socket)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	q := player.NewQueue()
+	go q.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		q.Stop()
+		l.Close()
+	}()
+	logger.LogInfo("Playback queue listening on %s", utils.ToHomeRelativePath(socket))
+	return q.Serve(l)
+}
+
+func runQueueLs(args []string) error {
+	fs := newFlagSet("queue ls", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	playing, items, err := player.ListQueue(config.PlayerSocket())
+	if err != nil {
+		return err
+	}
+	if playing == nil && len(items) == 0 {
+		fmt.Println("Nothing playing")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tLANG\tQUEUED\tTEXT")
+	if playing != nil {
+		printQueueItem(w, *playing, "playing")
+	}
+	for _, it := range items {
+		printQueueItem(w, it, "queued")
+	}
+	return w.Flush()
+}
+
+func printQueueItem(w *tabwriter.Writer, it player.QueueItem, state string) {
+	text := it.Text
+	if text == "" {
+		text = utils.ToHomeRelativePath(it.File)
+	}
+	fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", it.ID, state, config.GetFlagByName(langShortName(it.Lang)),
+		it.Queued.Local().Format(time.TimeOnly), truncate(text, 60))
+}
+
+func runQueueSkip(args []string) error {
+	fs := newFlagSet("queue skip", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	skipped, err := player.SkipQueue(config.PlayerSocket())
+	if err != nil {
+		return err
+	}
+	if skipped == nil {
+		logger.LogInfo("Nothing playing")
+		return nil
+	}
+	logger.LogInfo("Skipped #%d", skipped.ID)
+	return nil
+}
+
+func runQueueStop(args []string) error {
+	fs := newFlagSet("queue stop", "")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	stopped, dropped, err := player.StopQueue(config.PlayerSocket())
+	if err != nil {
+		return err
+	}
+	if stopped != nil {
+		logger.LogInfo("Stopped #%d", stopped.ID)
+	}
+	logger.LogInfo("Dropped %d queued readings", dropped)
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/player"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+	"golang.org/x/term"
+)
+
+const (
+	REPL_PROMPT = "%s %s › "
+	// SLOW_FACTOR scales the speed used by :slow.
+	SLOW_FACTOR = 0.75
+	MIN_SPEED   = 0.3
+	MAX_SPEED   = 3.0
+)
+
+// replSession is the state kept between the lines of an interactive session.
+type replSession struct {
+	lang    config.Lang
+	voice   string
+	speed   float64
+	tags    []string
+	last    *tts.TTSRequest
+	history []tts.TTSRequest
+	out     io.Writer
+}
+
+type replCommand struct {
+	args    string
+	summary string
+	run     func(s *replSession, arg string) error
+}
+
+var replCommands map[string]replCommand
+
+func init() {
+	// Assigned in init because :help refers to the map itself.
+	replCommands = map[string]replCommand{
+		"lang":    {"<name>", "switch language", (*replSession).setLang},
+		"speed":   {"<float>", "set the reading speed", (*replSession).setSpeed},
+		"voice":   {"[name]", "use another voice, or the language default without a name", (*replSession).setVoice},
+		"tag":     {"[tags]", "tag the following readings, or stop tagging without tags", (*replSession).setTags},
+		"replay":  {"", "play the last reading again", (*replSession).replay},
+		"slow":    {"", "read the last text again, slower", (*replSession).slow},
+		"save":    {"[path]", "copy the last audio to path (default: current directory)", (*replSession).save},
+		"history": {"", "list the texts read in this session", (*replSession).listHistory},
+		"help":    {"", "show this help", (*replSession).help},
+	}
+}
+
+func runREPL(args []string) error {
+	fs := newFlagSet("repl", "")
+	fs.StringVarP(&config.Language, "language", "l", config.DEFAULT_LANGUAGE, "language ("+config.GetAllLangShortNamesStr()+")")
+	fs.Float64VarP(&config.Speed, "speed", "s", config.DEFAULT_SPEED, "speed (float)")
+	fs.BoolVarP(&config.DryRun, "dry-run", "d", false, "dry run mode (no upload, no record)")
+	fs.StringSliceVarP(&config.Tags, "tag", "t", nil, "tag the readings, e.g. lesson3 (repeatable)")
+	fs.BoolVarP(&config.Wait, "wait", "w", false, "play each reading in the foreground with controls")
+	fs.BoolVarP(&config.Interrupt, "interrupt", "i", false, "play now instead of after the queued readings")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if err := config.RequireAPIKey(); err != nil {
+		return err
+	}
+	if !config.DryRun {
+		if err := config.RequireDBToken(); err != nil {
+			return err
+		}
+	}
+	lang, found := config.GetLang(config.Language)
+	if !found {
+		return fmt.Errorf("language not found: %s", config.Language)
+	}
+
+	s := &replSession{lang: lang, speed: config.Speed, tags: history.NormalizeTags(config.Tags), out: os.Stdout}
+	in := newLineReader()
+	fmt.Fprintln(s.out, "Type a text to read it aloud, :help for commands, Ctrl-D to quit.")
+	for {
+		in.SetPrompt(fmt.Sprintf(REPL_PROMPT, s.lang.Flag, s.lang.Name))
+		line, err := in.ReadLine()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(s.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == ":q" || line == ":quit" || line == ":exit" {
+			return nil
+		}
+		if err := s.handle(line); err != nil {
+			logger.LogError("%v", err)
+		}
+	}
+}
+
+// handle runs a :command or reads the line aloud.
+func (s *replSession) handle(line string) error {
+	if name, found := strings.CutPrefix(line, ":"); found {
+		name, arg, _ := strings.Cut(name, " ")
+		c, ok := replCommands[name]
+		if !ok {
+			return fmt.Errorf("unknown command :%s, see :help", name)
+		}
+		return c.run(s, strings.TrimSpace(arg))
+	}
+	return s.read(line, s.speed)
+}
+
+// read synthesizes content at speed, plays it and runs the storage stages.
+func (s *replSession) read(content string, speed float64) error {
+	if ok, err := config.ValidateLangRegex(s.lang.Name, content); err == nil && !ok {
+		logger.LogWarn("Text does not look like %s", s.lang.Name)
+	}
+	reader := s.lang.Reader
+	if s.voice != "" {
+		reader = s.voice
+	}
+	req := tts.NewTTSRequest(content, s.lang.NameFUll, reader, speed)
+	req.Tags = s.tags
+
+	synth, err := synthesize(req)
+	if err != nil {
+		recordHistory(req, []history.Stage{synth})
+		return fmt.Errorf("TTS request failed: %w", err)
+	}
+	logger.LogDebug("TTS request completed, took %.3f(s)", synth.Took.Seconds())
+
+	s.last = &req
+	s.history = append(s.history, req)
+	stages, err := runFunctionsConcurrently(buildProcessingPipeline(), req)
+	recordHistory(req, append([]history.Stage{synth}, stages...))
+	return err
+}
+
+func (s *replSession) setLang(arg string) error {
+	lang, found := config.GetLang(arg)
+	if !found {
+		return fmt.Errorf("language not found: %s (%s)", arg, config.GetAllLangShortNamesStr())
+	}
+	s.lang, s.voice = lang, ""
+	config.Language = lang.Name
+	fmt.Fprintf(s.out, "Language: %s %s, voice %s\n", lang.Flag, lang.Name, lang.Reader)
+	return nil
+}
+
+func (s *replSession) setSpeed(arg string) error {
+	speed, err := strconv.ParseFloat(arg, 64)
+	if err != nil || speed < MIN_SPEED || speed > MAX_SPEED {
+		return fmt.Errorf("speed must be a number between %.1f and %.1f", MIN_SPEED, MAX_SPEED)
+	}
+	s.speed = speed
+	fmt.Fprintf(s.out, "Speed: %.2f\n", speed)
+	return nil
+}
+
+func (s *replSession) setVoice(arg string) error {
+	s.voice = arg
+	if arg == "" {
+		arg = s.lang.Reader
+	}
+	fmt.Fprintf(s.out, "Voice: %s\n", arg)
+	return nil
+}
+
+func (s *replSession) setTags(arg string) error {
+	s.tags = history.NormalizeTags(strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' }))
+	if len(s.tags) == 0 {
+		fmt.Fprintln(s.out, "Tags: none")
+		return nil
+	}
+	fmt.Fprintf(s.out, "Tags: %s\n", strings.Join(s.tags, ", "))
+	return nil
+}
+
+func (s *replSession) replay(string) error {
+	if s.last == nil {
+		return fmt.Errorf("nothing read yet")
+	}
+	_, err := player.PlayAudio(*s.last)
+	return err
+}
+
+func (s *replSession) slow(string) error {
+	if s.last == nil {
+		return fmt.Errorf("nothing read yet")
+	}
+	// Round down to 0.1 steps, so that repeated :slow reuses cached audio.
+	speed := math.Max(math.Floor(s.last.Speed*SLOW_FACTOR*10)/10, MIN_SPEED)
+	fmt.Fprintf(s.out, "Speed: %.1f\n", speed)
+	return s.read(s.last.Content, speed)
+}
+
+func (s *replSession) save(arg string) error {
+	if s.last == nil {
+		return fmt.Errorf("nothing read yet")
+	}
+	dest := arg
+	if dest == "" {
+		dest = "."
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		dest = filepath.Join(dest, s.last.Md5+".wav")
+	}
+	data, err := os.ReadFile(s.last.Dest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Saved %s\n", dest)
+	return nil
+}
+
+func (s *replSession) listHistory(string) error {
+	for i, req := range s.history {
+		fmt.Fprintf(s.out, "%3d  %s %.1f  %s\n", i+1, config.GetFlagByName(langShortName(req.Lang)), req.Speed, req.Content)
+	}
+	return nil
+}
+
+func (s *replSession) help(string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		c := replCommands[name]
+		fmt.Fprintf(s.out, "  :%-16s %s\n", strings.TrimSpace(name+" "+c.args), c.summary)
+	}
+	fmt.Fprintf(s.out, "  :%-16s %s\n", "quit", "leave the session")
+	return nil
+}
+
+// langShortName maps a full language name such as fr-FR back to its short name.
+func langShortName(full string) string {
+	for _, l := range config.Langs {
+		if l.NameFUll == full {
+			return l.Name
+		}
+	}
+	return full
+}
+
+// lineReader reads one line of input at a time.
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+// newLineReader returns a line editor with history when stdin is a terminal
+// and a plain line scanner otherwise.
+func newLineReader() lineReader {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &scanReader{scanner: bufio.NewScanner(os.Stdin)}
+	}
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+	return &termReader{fd: fd, t: term.NewTerminal(rw, "")}
+}
+
+// termReader puts the terminal in raw mode only while a line is edited, so
+// that log output between prompts is printed normally.
+type termReader struct {
+	fd int
+	t  *term.Terminal
+}
+
+func (r *termReader) SetPrompt(prompt string) {
+	r.t.SetPrompt(prompt)
+}
+
+func (r *termReader) ReadLine() (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+	return r.t.ReadLine()
+}
+
+type scanReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *scanReader) SetPrompt(string) {}
+
+func (r *scanReader) ReadLine() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
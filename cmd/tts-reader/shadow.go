@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/player"
+	"github.com/zhasm/tts-reader/internal/text"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// runShadow plays the content of req for shadowing: each sentence phrase by
+// phrase, every phrase followed by a pause to repeat it aloud, then whole.
+// The phrases and sentences are read and cached as requests of their own.
+func runShadow(req tts.TTSRequest) error {
+	for _, sentence := range text.Sentences(req.Content) {
+		phrases := text.Phrases(sentence, config.Language)
+		if len(phrases) > 1 {
+			for _, phrase := range phrases {
+				if err := shadowPart(req, phrase, "🗣"); err != nil {
+					return err
+				}
+			}
+		}
+		if err := shadowPart(req, sentence, "💬"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shadowPart reads content with the voice and speed of req, plays it and
+// pauses for the user to repeat it. Each part is a run of the history.
+func shadowPart(req tts.TTSRequest, content, icon string) error {
+	r := tts.NewTTSRequest(content, req.Lang, req.Reader, req.Speed)
+	r.Tags, r.Note = req.Tags, req.Note
+	synth, err := synthesize(r)
+	recordHistory(r, []history.Stage{synth})
+	if err != nil {
+		return fmt.Errorf("TTS request failed for %q: %w", content, err)
+	}
+	d, err := audio.FileDuration(r.Dest)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("%s %s", icon, content)
+	if err := player.PlayWait(r.Dest); err != nil {
+		return err
+	}
+	time.Sleep(time.Duration(float64(d) * config.ShadowFactor))
+	return nil
+}
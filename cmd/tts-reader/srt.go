@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/subtitle"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	FIT_COMPRESS    = "compress"
+	FIT_FLAG        = "flag"
+	DEFAULT_MAX_FIT = 1.5
+)
+
+func runSRT(args []string) error {
+	fs := newFlagSet("srt", "<file.srt>")
+	fs.StringVarP(&config.Language, "language", "l", config.DEFAULT_LANGUAGE, "language ("+config.GetAllLangShortNamesStr()+")")
+	fs.Float64VarP(&config.Speed, "speed", "s", config.DEFAULT_SPEED, "speed (float)")
+	output := fs.StringP("output", "o", "", "output file, .wav or any format ffmpeg writes (default: the subtitle file with .wav)")
+	fit := fs.String("fit", FIT_COMPRESS, "speech longer than its cue: compress (re-synthesize faster) or flag")
+	maxFit := fs.Float64("max-fit", DEFAULT_MAX_FIT, "largest speed-up used to compress speech into its cue")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one subtitle file")
+	}
+	if *fit != FIT_COMPRESS && *fit != FIT_FLAG {
+		return fmt.Errorf("invalid --fit: %s", *fit)
+	}
+	if err := config.RequireAPIKey(); err != nil {
+		return err
+	}
+	lang, found := config.GetLang(config.Language)
+	if !found {
+		return fmt.Errorf("language not found: %s", config.Language)
+	}
+
+	file := fs.Arg(0)
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	cues, err := subtitle.ParseSRT(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(cues) == 0 {
+		return fmt.Errorf("%s has no cues", file)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(file, filepath.Ext(file)) + ".wav"
+	}
+
+	start := time.Now()
+	var (
+		track   *audio.Track
+		flagged []string
+	)
+	for _, cue := range cues {
+		pcm, speed, err := synthesizeCue(cue, lang, *fit == FIT_COMPRESS, *maxFit)
+		if err != nil {
+			return fmt.Errorf("cue %d: %w", cue.Index, err)
+		}
+		if track == nil {
+			track = audio.NewTrack(pcm.Format)
+		}
+		if over := pcm.Duration() - cue.Duration(); over > 0 {
+			flagged = append(flagged, fmt.Sprintf("cue %d (%s): speech is %.2fs longer than the cue at speed %.1f",
+				cue.Index, formatCueTime(cue.Start), over.Seconds(), speed))
+		}
+		late, err := track.Place(cue.Start, pcm)
+		if err != nil {
+			return fmt.Errorf("cue %d: %w", cue.Index, err)
+		}
+		if late > 0 {
+			flagged = append(flagged, fmt.Sprintf("cue %d (%s): starts %.2fs late", cue.Index, formatCueTime(cue.Start), late.Seconds()))
+		}
+		logger.LogDebug("cue %d at %s: %s", cue.Index, formatCueTime(cue.Start), cue.Text)
+	}
+	track.Pad(cues[len(cues)-1].End)
+
+	if err := audio.Save(*output, track.PCM); err != nil {
+		return err
+	}
+	for _, msg := range flagged {
+		logger.LogWarn("%s", msg)
+	}
+	logger.LogInfo("Wrote %d cues (%s) to %s, %d flagged, took %.3f(s)",
+		len(cues), formatCueTime(track.End()), *output, len(flagged), time.Since(start).Seconds())
+	return nil
+}
+
+// synthesizeCue returns the audio of a cue and the speed it was read at. With
+// compress, speech longer than the cue is requested again at a higher speed,
+// up to maxFit times the configured one. Every speed is cached on its own.
+func synthesizeCue(cue subtitle.Cue, lang config.Lang, compress bool, maxFit float64) (audio.PCM, float64, error) {
+	speed := config.Speed
+	pcm, err := synthesizePCM(cue.Text, lang, speed)
+	if err != nil || !compress || pcm.Duration() <= cue.Duration() || cue.Duration() <= 0 {
+		return pcm, speed, err
+	}
+
+	ratio := pcm.Duration().Seconds() / cue.Duration().Seconds()
+	// Round up to 0.1 steps, so that close ratios share their cached audio.
+	faster := math.Min(math.Ceil(speed*ratio*10)/10, speed*maxFit)
+	if faster <= speed {
+		return pcm, speed, nil
+	}
+	logger.LogDebug("cue %d: %.2fs of speech for a %.2fs cue, retrying at speed %.1f",
+		cue.Index, pcm.Duration().Seconds(), cue.Duration().Seconds(), faster)
+	fast, err := synthesizePCM(cue.Text, lang, faster)
+	if err != nil {
+		return audio.PCM{}, 0, err
+	}
+	return fast, faster, nil
+}
+
+// synthesizePCM reads content through the TTS cache and decodes the result.
+func synthesizePCM(content string, lang config.Lang, speed float64) (audio.PCM, error) {
+	req := tts.NewTTSRequest(content, lang.NameFUll, lang.Reader, speed)
+	if ok, err := tts.Synthesize(req); err != nil || !ok {
+		return audio.PCM{}, fmt.Errorf("TTS request failed: %w", err)
+	}
+	return audio.ReadWAV(req.Dest)
+}
+
+func formatCueTime(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+func runSync(args []string) error {
+	fs := newFlagSet("sync", "")
+	fixes := fs.StringSlice("fix", nil, "fixes to apply: "+strings.Join(storage.FIXES, ", ")+" (default: report only)")
+	dryRun := fs.BoolP("dry-run", "n", false, "only list the fixes that would be applied")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := initCommand(fs, args); err != nil {
+		return err
+	}
+	for _, f := range *fixes {
+		if !slices.Contains(storage.FIXES, f) {
+			return fmt.Errorf("invalid --fix: %s (%s)", f, strings.Join(storage.FIXES, ", "))
+		}
+	}
+	if err := config.RequireDBToken(); err != nil {
+		return err
+	}
+
+	local, err := localFiles()
+	if err != nil {
+		return err
+	}
+	objects, err := storage.ListObjects()
+	if err != nil {
+		return err
+	}
+	records, err := storage.ListRecords()
+	if err != nil {
+		return err
+	}
+	queued, err := storage.QueuedRecords()
+	if err != nil {
+		return err
+	}
+	report := storage.Diff(local, objects, records, queued)
+
+	var errs []error
+	if len(*fixes) > 0 && !*dryRun {
+		var (
+			pending []*storage.SyncItem
+			records []storage.Record
+		)
+		for i := range report.Items {
+			it := &report.Items[i]
+			r, err := applyFixes(it, *fixes)
+			if err != nil {
+				it.Error = err.Error()
+				errs = append(errs, fmt.Errorf("%s: %w", it.Key, err))
+			} else if r != nil {
+				pending, records = append(pending, it), append(records, *r)
+			}
+		}
+		errs = append(errs, appendRecords(pending, records)...)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printSyncReport(report, *fixes, *dryRun)
+	}
+	return errors.Join(errs...)
+}
+
+// localFiles lists the audio of the cache directory, with what the index
+// knows about each file.
+func localFiles() ([]storage.LocalFile, error) {
+	ix, err := cache.Load(config.TTS_PATH)
+	if err != nil {
+		return nil, err
+	}
+	var files []storage.LocalFile
+	for _, e := range ix.Sorted() {
+		if _, err := os.Stat(ix.Path(e)); err != nil {
+			continue
+		}
+		files = append(files, storage.LocalFile{Key: e.Key, Aliases: e.Aliases, Path: ix.Path(e), Content: e.Content, Lang: e.Lang})
+	}
+	// Verify without fix only reports, including the files the index misses.
+	r, err := ix.Verify(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range r.Untracked {
+		files = append(files, storage.LocalFile{
+			Key:  strings.TrimSuffix(name, filepath.Ext(name)),
+			Path: filepath.Join(ix.Dir(), name),
+		})
+	}
+	return files, nil
+}
+
+// applyFixes runs the fixes of it that are enabled, but for the record fix,
+// which comes last: the record to append is returned for appendRecords.
+func applyFixes(it *storage.SyncItem, enabled []string) (*storage.Record, error) {
+	for _, fix := range it.Fixes {
+		if !slices.Contains(enabled, fix) {
+			continue
+		}
+		var err error
+		switch fix {
+		case storage.FIX_UPLOAD:
+			err = storage.UploadFile(it.File, it.Key+filepath.Ext(it.File))
+		case storage.FIX_RECORD:
+			r, err := storage.NewRecord(tts.TTSRequest{Content: it.Content, Lang: it.Lang, Dest: it.File, Md5: it.Key})
+			if err != nil {
+				return nil, fmt.Errorf("%s failed: %w", fix, err)
+			}
+			return &r, nil
+		case storage.FIX_DOWNLOAD:
+			err = downloadObject(it)
+		case storage.FIX_DELETE:
+			if it.Object != "" {
+				err = storage.DeleteObject(it.Object)
+			} else {
+				err = storage.DeleteRecord(*it.Record)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w", fix, err)
+		}
+		it.Done = append(it.Done, fix)
+	}
+	return nil, nil
+}
+
+// appendRecords appends the records of the items in batches. Sync reports
+// failures itself rather than queueing them.
+func appendRecords(items []*storage.SyncItem, records []storage.Record) []error {
+	if len(records) == 0 {
+		return nil
+	}
+	saved, err := storage.DefaultRecordsClient().CreateBatch(records)
+	for _, it := range items[:len(saved)] {
+		it.Done = append(it.Done, storage.FIX_RECORD)
+	}
+	if err == nil {
+		return nil
+	}
+	var errs []error
+	for _, it := range items[len(saved):] {
+		it.Error = fmt.Sprintf("%s failed: %v", storage.FIX_RECORD, err)
+		errs = append(errs, fmt.Errorf("%s: %s", it.Key, it.Error))
+	}
+	return errs
+}
+
+// downloadObject copies the object of it into the cache and indexes it.
+func downloadObject(it *storage.SyncItem) error {
+	dest := filepath.Join(config.TTS_PATH, it.Object)
+	if err := storage.DownloadFile(it.Object, dest); err != nil {
+		return err
+	}
+	if valid, err := tts.IsAudioFileValid(dest); !valid {
+		os.Remove(dest)
+		return err
+	}
+	e, err := cache.NewEntry(it.Key, dest)
+	if err != nil {
+		return err
+	}
+	e.Content, e.Lang, e.Created = it.Content, it.Lang, time.Now()
+	it.File = dest
+	return cache.Record(config.TTS_PATH, e)
+}
+
+func printSyncReport(r storage.SyncReport, fixes []string, dryRun bool) {
+	for _, it := range r.Items {
+		status := strings.Join(it.Fixes, ",")
+		switch {
+		case it.Error != "":
+			status = "error: " + it.Error
+		case len(it.Done) > 0:
+			status = "done: " + strings.Join(it.Done, ",")
+		case dryRun && len(fixes) > 0:
+			var would []string
+			for _, f := range it.Fixes {
+				if slices.Contains(fixes, f) {
+					would = append(would, f)
+				}
+			}
+			if len(would) > 0 {
+				status = "would " + strings.Join(would, ",")
+			}
+		case it.Kind == storage.QUEUED_RECORD:
+			status = "record queued"
+		case status == "":
+			status = "unknown content"
+		}
+		fmt.Printf("%-15s %s  %-18s %s\n", it.Kind, it.Key[:min(len(it.Key), 12)], status, truncate(it.Content, 40))
+	}
+	logger.LogInfo("%d local files, %d objects, %d records: %d in sync, %d to reconcile",
+		r.Local, r.Objects, r.Records, r.InSync, len(r.Items))
+	if r.Ignored > 0 {
+		logger.LogInfo("%d objects that are not cached audio were left alone", r.Ignored)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -9,8 +10,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zhasm/tts-reader/internal/article"
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/outbox"
 	"github.com/zhasm/tts-reader/internal/player"
 	"github.com/zhasm/tts-reader/internal/storage"
+	"github.com/zhasm/tts-reader/internal/text"
 	"github.com/zhasm/tts-reader/internal/tts"
 	"github.com/zhasm/tts-reader/internal/utils"
 	"github.com/zhasm/tts-reader/pkg/config"
@@ -28,6 +33,9 @@ func run() error {
 	if err := config.ValidateAndHandleArgs(); err != nil {
 		return fmt.Errorf("argument validation failed: %w", err)
 	}
+	if err := resolveContent(); err != nil {
+		return err
+	}
 
 	lang, found := config.GetLang(config.Language)
 	if !found {
@@ -56,16 +64,33 @@ func run() error {
 		logger.LogInfo("Total time taken: %.3f(s)\n", time.Since(startAll).Seconds())
 	}()
 
-	start := time.Now()
-	if ok, err := tts.ReqTTS(req); err != nil || !ok {
+	if config.Shadow {
+		if err := runShadow(req); err != nil {
+			success = false
+			return err
+		}
+		return nil
+	}
+	if config.IsDrill() {
+		if err := runDrill(req); err != nil {
+			success = false
+			return err
+		}
+		return nil
+	}
+
+	synth, err := synthesize(req)
+	if err != nil {
 		success = false
+		recordHistory(req, []history.Stage{synth})
 		return fmt.Errorf("TTS request failed: %w", err)
 	}
-	duration := time.Since(start).Seconds()
-	logger.LogInfo("✅ TTS request completed, took %.3f(s)", duration)
+	logger.LogInfo("✅ TTS request completed, took %.3f(s)", synth.Took.Seconds())
 
 	funcs := buildProcessingPipeline()
-	if err := runFunctionsConcurrently(funcs, req); err != nil {
+	stages, err := runFunctionsConcurrently(funcs, req)
+	recordHistory(req, append([]history.Stage{synth}, stages...))
+	if err != nil {
 		success = false
 		return err
 	}
@@ -73,18 +98,69 @@ func run() error {
 	return nil
 }
 
+// synthesize runs the TTS request as the first stage of a run.
+func synthesize(req tts.TTSRequest) (history.Stage, error) {
+	start := time.Now()
+	ok, err := tts.Synthesize(req)
+	if err == nil && !ok {
+		err = fmt.Errorf("no audio for %s", req.Md5)
+	}
+	stage := history.Stage{Name: "tts.Synthesize", OK: err == nil, Took: time.Since(start)}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	return stage, err
+}
+
 func initLoggerAndConfig() {
 	logger.Init()
 	config.Init()
 }
 
+// resolveContent replaces a URL given as content by the text of the article
+// it points to, detecting the language unless --language was given, and
+// verbalizes the URLs found inside plain text.
+func resolveContent() error {
+	if !text.IsURL(config.Content) {
+		config.Content = text.VerbalizeURLs(config.Content)
+		return nil
+	}
+
+	logger.LogInfo("🌐 Fetching %s", config.Content)
+	a, err := article.Fetch(config.Content)
+	if err != nil {
+		return fmt.Errorf("fetching article failed: %w", err)
+	}
+	logger.LogInfo("📰 %s (%d chars)", a.Title, len([]rune(a.Text)))
+
+	lang, found := config.GetLangByCode(a.Lang)
+	if !found {
+		lang, found = config.DetectLang(a.Text)
+	}
+	switch {
+	case !found:
+		logger.LogWarn("Could not detect the article language, reading it as %s", config.Language)
+	case config.IsFlagSet("language"):
+		if lang.Name != config.Language {
+			logger.LogWarn("Article looks like %s, reading it as %s as requested", lang.Name, config.Language)
+		}
+	default:
+		logger.LogInfo("Detected language: %s %s", lang.Flag, lang.Name)
+		config.Language = lang.Name
+	}
+	config.Content = a.Text
+	return nil
+}
+
 func createTTSRequest(lang config.Lang) tts.TTSRequest {
-	return tts.NewTTSRequest(
+	req := tts.NewTTSRequest(
 		config.Content,
 		lang.NameFUll,
 		lang.Reader,
 		config.Speed,
 	)
+	req.Tags, req.Note = history.NormalizeTags(config.Tags), config.Note
+	return req
 }
 
 func logContentPreview(req tts.TTSRequest) string {
@@ -102,17 +178,26 @@ func buildProcessingPipeline() []func(tts.TTSRequest) (bool, error) {
 	}
 
 	if !config.DryRun {
-		funcs = append([]func(tts.TTSRequest) (bool, error){
-			storage.UploadToR2,
-			storage.AppendRecord,
-		}, funcs...)
+		funcs = append(buildPublishPipeline(), funcs...)
 	}
 	return funcs
 }
 
-func runFunctionsConcurrently(funcs []func(tts.TTSRequest) (bool, error), req tts.TTSRequest) error {
+// buildPublishPipeline returns the storage stages of the processing pipeline.
+func buildPublishPipeline() []func(tts.TTSRequest) (bool, error) {
+	return []func(tts.TTSRequest) (bool, error){
+		storage.Upload,
+		storage.AppendRecord,
+		storage.FlushOutbox,
+	}
+}
+
+// runFunctionsConcurrently runs the stages of funcs on req and returns how
+// each went, in the order of funcs, with the first error.
+func runFunctionsConcurrently(funcs []func(tts.TTSRequest) (bool, error), req tts.TTSRequest) ([]history.Stage, error) {
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(funcs))
+	stages := make([]history.Stage, len(funcs))
 
 	wg.Add(len(funcs))
 	for i, f := range funcs {
@@ -129,9 +214,17 @@ func runFunctionsConcurrently(funcs []func(tts.TTSRequest) (bool, error), req tt
 			ok, err := f(req)
 
 			// Calculate duration
-			duration := time.Since(start).Seconds()
+			took := time.Since(start)
+			duration := took.Seconds()
+			stages[i] = history.Stage{Name: funcName, OK: err == nil && ok, Queued: errors.Is(err, outbox.ErrQueued), Took: took}
+			if err != nil {
+				stages[i].Error = err.Error()
+			}
 
-			if err != nil || !ok {
+			// Queued work is retried later: it does not fail the reading.
+			if stages[i].Queued {
+				logger.LogWarn("%s%s queued, took %.3f(s)", indent, funcName, duration)
+			} else if err != nil || !ok {
 				logger.LogWarn("%s%s [%d] failed, took %.3f(s)", indent, funcName, i, duration)
 				errChan <- fmt.Errorf("function %d failed: %w", i, err)
 			} else {
@@ -144,10 +237,10 @@ func runFunctionsConcurrently(funcs []func(tts.TTSRequest) (bool, error), req tt
 
 	for err := range errChan {
 		if err != nil {
-			return err
+			return stages, err
 		}
 	}
-	return nil
+	return stages, nil
 }
 
 func GetWindowWidth() (int, error) {
@@ -4,8 +4,7 @@ go 1.24.4
 
 require (
 	github.com/spf13/pflag v1.0.7
-	gopkg.in/yaml.v3 v3.0.1
+	golang.org/x/sys v0.34.0
 	golang.org/x/term v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.34.0 // indirect
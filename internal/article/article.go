@@ -0,0 +1,277 @@
+package article
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	USER_AGENT    = "Mozilla/5.0 (compatible; tts-reader)"
+	MAX_PAGE_SIZE = 5 << 20
+)
+
+// Article is the readable part of a web page.
+type Article struct {
+	URL   string
+	Title string
+	// Lang is the language declared by the page, e.g. "fr-FR", if any.
+	Lang string
+	// Text holds the paragraphs of the article separated by newlines.
+	Text string
+}
+
+var (
+	// Elements whose content is never part of the article. Scripts and styles
+	// are removed before tokenizing, as their bodies are not valid markup.
+	rawTextRegex = regexp.MustCompile(`(?is)<(script|style|noscript|template|svg)\b.*?</(script|style|noscript|template|svg)\s*>|<!--.*?-->`)
+	skipTags     = map[string]bool{
+		"nav": true, "header": true, "footer": true, "aside": true, "form": true,
+		"button": true, "select": true, "iframe": true, "figure": true,
+	}
+	voidTags = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+		"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+	}
+	blockTags = map[string]bool{
+		"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"li": true, "blockquote": true, "pre": true, "dd": true, "dt": true,
+	}
+	positiveHint = regexp.MustCompile(`(?i)article|content|main|post|entry|text|body|story`)
+	negativeHint = regexp.MustCompile(`(?i)comment|footer|nav|sidebar|menu|share|social|related|promo|banner|\bad\b|cookie|subscribe`)
+)
+
+type node struct {
+	tag      string
+	attrs    map[string]string
+	children []*node
+	text     string // set on text nodes only
+	parent   *node
+}
+
+// Fetch downloads rawURL and extracts its article.
+func Fetch(rawURL string) (Article, error) {
+	httpHeaders := map[string]string{
+		"User-Agent": USER_AGENT,
+		"Accept":     "text/html,text/plain;q=0.9",
+	}
+	httpReq, err := utils.NewHTTPRequest("GET", rawURL, nil, httpHeaders)
+	if err != nil {
+		return Article{}, err
+	}
+	resp, err := utils.HTTPRequest(&http.Client{Timeout: 30 * time.Second}, httpReq)
+	if err != nil {
+		return Article{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Article{}, fmt.Errorf("fetching %s failed: %s", rawURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_PAGE_SIZE))
+	if err != nil {
+		return Article{}, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	logger.LogDebug("Fetched %s (%s, %d bytes)", rawURL, mediaType, len(body))
+	var a Article
+	switch mediaType {
+	case "text/plain":
+		a = Article{Text: strings.TrimSpace(string(body))}
+	case "", "text/html", "application/xhtml+xml":
+		a = Extract(body)
+	default:
+		return Article{}, fmt.Errorf("cannot read %s content from %s", mediaType, rawURL)
+	}
+	a.URL = rawURL
+	if a.Lang == "" {
+		a.Lang = resp.Header.Get("Content-Language")
+	}
+	if a.Text == "" {
+		return Article{}, fmt.Errorf("no article text found at %s", rawURL)
+	}
+	return a, nil
+}
+
+// Extract finds the main article of an HTML page. Like readability, it scores
+// every element by the paragraphs directly inside it and keeps the best one.
+func Extract(page []byte) Article {
+	root := parse(page)
+	a := Article{}
+	if html := find(root, "html"); html != nil {
+		a.Lang = html.attrs["lang"]
+	}
+	if title := find(root, "title"); title != nil {
+		a.Title = collapse(textOf(title))
+	}
+	if h1 := find(root, "h1"); a.Title == "" && h1 != nil {
+		a.Title = collapse(textOf(h1))
+	}
+
+	var (
+		best      *node
+		bestScore float64
+	)
+	walk(root, func(n *node) {
+		if score := scoreNode(n); score > bestScore {
+			best, bestScore = n, score
+		}
+	})
+	if best == nil {
+		if body := find(root, "body"); body != nil {
+			best = body
+		} else {
+			best = root
+		}
+	}
+
+	var paragraphs []string
+	collectBlocks(best, &paragraphs)
+	if len(paragraphs) == 0 {
+		if t := collapse(textOf(best)); t != "" {
+			paragraphs = append(paragraphs, t)
+		}
+	}
+	a.Text = strings.Join(paragraphs, "\n")
+	return a
+}
+
+// parse builds a loose DOM. The tokenizer runs in non-strict mode and
+// unmatched end tags are ignored, so broken markup yields a partial tree
+// rather than an error.
+func parse(page []byte) *node {
+	page = rawTextRegex.ReplaceAll(page, nil)
+	d := xml.NewDecoder(bytes.NewReader(page))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	root := &node{tag: "#root"}
+	cur := root
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			if err != io.EOF {
+				logger.LogDebug("Stopped parsing page: %v", err)
+			}
+			return root
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{tag: strings.ToLower(t.Name.Local), attrs: map[string]string{}, parent: cur}
+			for _, attr := range t.Attr {
+				n.attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			cur.children = append(cur.children, n)
+			if !voidTags[n.tag] {
+				cur = n
+			}
+		case xml.EndElement:
+			tag := strings.ToLower(t.Name.Local)
+			for n := cur; n != root; n = n.parent {
+				if n.tag == tag {
+					cur = n.parent
+					break
+				}
+			}
+		case xml.CharData:
+			cur.children = append(cur.children, &node{text: string(t), parent: cur})
+		}
+	}
+}
+
+func walk(n *node, fn func(*node)) {
+	if n.tag == "" || skipTags[n.tag] {
+		return
+	}
+	fn(n)
+	for _, c := range n.children {
+		walk(c, fn)
+	}
+}
+
+func find(n *node, tag string) *node {
+	if n.tag == tag {
+		return n
+	}
+	for _, c := range n.children {
+		if found := find(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// scoreNode rates how likely n is to be the article container, based on the
+// length and punctuation of the paragraphs directly inside it and on hints in
+// its class and id.
+func scoreNode(n *node) float64 {
+	score := 0.0
+	for _, c := range n.children {
+		if c.tag != "p" && c.tag != "pre" && c.tag != "blockquote" {
+			continue
+		}
+		t := collapse(textOf(c))
+		if len([]rune(t)) < 25 {
+			continue
+		}
+		score += 1 + float64(strings.Count(t, ",")+strings.Count(t, "、")) + min(float64(len([]rune(t)))/100, 3)
+	}
+	if score == 0 {
+		return 0
+	}
+	hints := n.attrs["class"] + " " + n.attrs["id"]
+	if n.tag == "article" || n.tag == "main" || positiveHint.MatchString(hints) {
+		score *= 1.25
+	}
+	if negativeHint.MatchString(hints) {
+		score *= 0.25
+	}
+	return score
+}
+
+// collectBlocks appends the text of every block element under n.
+func collectBlocks(n *node, out *[]string) {
+	if n.tag == "" || skipTags[n.tag] {
+		return
+	}
+	if blockTags[n.tag] {
+		if t := collapse(textOf(n)); t != "" {
+			*out = append(*out, t)
+		}
+		return
+	}
+	for _, c := range n.children {
+		collectBlocks(c, out)
+	}
+}
+
+func textOf(n *node) string {
+	if n.tag == "" {
+		return n.text
+	}
+	if skipTags[n.tag] {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(textOf(c))
+		if c.tag == "br" || blockTags[c.tag] {
+			b.WriteString(" ")
+		}
+	}
+	return b.String()
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,90 @@
+package article
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html lang="fr-FR">
+<head>
+  <meta charset="utf-8">
+  <title>Le printemps à Paris</title>
+  <script>if (a < b && c) { document.write("<p>nope</p>"); }</script>
+  <style>p { color: red; }</style>
+</head>
+<body>
+  <nav><ul><li><a href="/">Accueil</a></li><li>Rubriques</li></ul></nav>
+  <div class="sidebar"><p>Abonnez-vous à notre lettre, chaque semaine, gratuitement, sans engagement.</p></div>
+  <article class="post">
+    <h1>Le printemps à Paris</h1>
+    <p>Les arbres fleurissent dans les jardins, et les terrasses se remplissent de monde.</p>
+    <p>Au bord de la Seine, les promeneurs profitent du soleil&nbsp;: c&#39;est la saison préférée des Parisiens.<br>
+    Les musées, eux, restent calmes.</p>
+    <img src="a.jpg">
+  </article>
+  <footer><p>© 2025 Le Journal, tous droits réservés, reproduction interdite.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	a := Extract([]byte(testPage))
+	if a.Title != "Le printemps à Paris" {
+		t.Errorf("Title = %q", a.Title)
+	}
+	if a.Lang != "fr-FR" {
+		t.Errorf("Lang = %q", a.Lang)
+	}
+	lines := strings.Split(a.Text, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected heading and 2 paragraphs, got %q", a.Text)
+	}
+	if !strings.HasPrefix(lines[1], "Les arbres fleurissent") {
+		t.Errorf("Unexpected first paragraph: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "soleil : c'est la saison") || !strings.Contains(lines[2], "Parisiens. Les musées") {
+		t.Errorf("Entities or line breaks not handled: %q", lines[2])
+	}
+	for _, unwanted := range []string{"Abonnez-vous", "Accueil", "nope", "droits", "color"} {
+		if strings.Contains(a.Text, unwanted) {
+			t.Errorf("Unexpected %q in article text", unwanted)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, testPage)
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Language", "pl")
+			fmt.Fprint(w, "Dzień dobry.\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a, err := Fetch(server.URL + "/article")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if a.URL != server.URL+"/article" || !strings.Contains(a.Text, "Seine") {
+		t.Errorf("Unexpected article: %+v", a)
+	}
+
+	a, err = Fetch(server.URL + "/notes.txt")
+	if err != nil || a.Text != "Dzień dobry." || a.Lang != "pl" {
+		t.Errorf("Unexpected plain text article: %+v, err %v", a, err)
+	}
+
+	if _, err := Fetch(server.URL + "/missing"); err == nil {
+		t.Error("Expected error for missing page")
+	}
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var extMIMETypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+}
+
+// HasAudioExtension reports whether the extension of name is that of an
+// audio format.
+func HasAudioExtension(name string) bool {
+	_, ok := extMIMETypes[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Extension returns the usual file extension of an audio MIME type, or ""
+// for the unknown ones.
+func Extension(mime string) string {
+	switch mime {
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/ogg":
+		return ".ogg"
+	}
+	for ext, m := range extMIMETypes {
+		if m == mime {
+			return ext
+		}
+	}
+	return ""
+}
+
+// SniffMIMEType returns the MIME type of an audio stream from its first
+// bytes, or "" when the header is not recognized.
+func SniffMIMEType(header []byte) string {
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "audio/flac"
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		return "audio/mp4"
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return "audio/mpeg"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return "audio/mpeg"
+	}
+	return ""
+}
+
+// MIMEType returns the MIME type of an audio file. The content wins over the
+// extension, since the TTS cache stores WAV data in files named .mp3. When
+// the file cannot be read, the extension decides.
+func MIMEType(path string) string {
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		header := make([]byte, 12)
+		n, _ := io.ReadFull(f, header)
+		if mime := SniffMIMEType(header[:n]); mime != "" {
+			return mime
+		}
+	}
+	if mime, ok := extMIMETypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return mime
+	}
+	return "application/octet-stream"
+}
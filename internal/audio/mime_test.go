@@ -0,0 +1,28 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMIMEType(t *testing.T) {
+	dir := t.TempDir()
+
+	// WAV data in a .mp3 file, as written by the TTS cache.
+	cached := filepath.Join(dir, "abc.mp3")
+	if err := os.WriteFile(cached, EncodeWAV(Silence(DefaultFormat, time.Second)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := MIMEType(cached); got != "audio/wav" {
+		t.Errorf("MIMEType(cached) = %s, want audio/wav", got)
+	}
+
+	if got := MIMEType(filepath.Join(dir, "missing.mp3")); got != "audio/mpeg" {
+		t.Errorf("MIMEType(missing) = %s, want audio/mpeg", got)
+	}
+	if got := SniffMIMEType([]byte("OggS\x00")); got != "audio/ogg" {
+		t.Errorf("SniffMIMEType(ogg) = %s, want audio/ogg", got)
+	}
+}
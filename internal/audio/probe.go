@@ -0,0 +1,301 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Info is what Probe learns from the headers of an audio file.
+type Info struct {
+	MIMEType string
+	Duration time.Duration
+}
+
+// ErrTruncated is returned for files that end before their headers say.
+var ErrTruncated = errors.New("audio is truncated")
+
+// Probe checks that the file at path is a complete WAV, MP3 or Ogg stream and
+// returns its type and playing time.
+func Probe(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := ProbeBytes(data)
+	if err != nil {
+		return Info{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// ProbeBytes is Probe for audio held in memory.
+func ProbeBytes(data []byte) (Info, error) {
+	mime := SniffMIMEType(data[:min(len(data), 12)])
+	var (
+		d   time.Duration
+		err error
+	)
+	switch mime {
+	case "audio/wav":
+		d, err = probeWAV(data)
+	case "audio/mpeg":
+		d, err = probeMP3(data)
+	case "audio/ogg":
+		d, err = probeOgg(data)
+	case "":
+		return Info{}, fmt.Errorf("not audio: %s", describeHeader(data))
+	default:
+		return Info{}, fmt.Errorf("unsupported audio type %s", mime)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{MIMEType: mime, Duration: d}, nil
+}
+
+// describeHeader quotes the start of data for error messages, which helps
+// when an API error body was saved in place of audio.
+func describeHeader(data []byte) string {
+	if len(data) == 0 {
+		return "empty file"
+	}
+	head := data[:min(len(data), 40)]
+	if bytes.IndexFunc(head, func(r rune) bool { return r < ' ' && r != '\n' && r != '\r' && r != '\t' }) < 0 {
+		return fmt.Sprintf("starts with %q", head)
+	}
+	return fmt.Sprintf("unknown header % x", head[:min(len(head), 12)])
+}
+
+// placeholder sizes written by streaming encoders that do not know the length.
+func isPlaceholderSize(size uint32) bool {
+	return size == 0 || size == 0xFFFFFFFF
+}
+
+func probeWAV(data []byte) (time.Duration, error) {
+	riffSize := binary.LittleEndian.Uint32(data[4:8])
+	if !isPlaceholderSize(riffSize) && int64(riffSize)+8 > int64(len(data)) {
+		return 0, fmt.Errorf("%w: RIFF declares %d bytes, file has %d", ErrTruncated, int64(riffSize)+8, len(data))
+	}
+	pos := 12
+	for pos+8 <= len(data) {
+		size := int64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if string(data[pos:pos+4]) == "data" {
+			if !isPlaceholderSize(uint32(size)) && int64(pos)+8+size > int64(len(data)) {
+				return 0, fmt.Errorf("%w: data chunk declares %d bytes, file has %d", ErrTruncated, size, len(data)-pos-8)
+			}
+			break
+		}
+		next := int64(pos) + 8 + size + size%2
+		if next > int64(len(data)) {
+			break
+		}
+		pos = int(next)
+	}
+	p, err := DecodeWAV(data)
+	if err != nil {
+		return 0, err
+	}
+	if len(p.Data) == 0 {
+		return 0, fmt.Errorf("WAV stream has no samples")
+	}
+	return p.Duration(), nil
+}
+
+var (
+	// mp3Bitrates are in kbit/s, indexed by [MPEG-1][layer-1][index].
+	mp3Bitrates = [2][3][16]int{
+		{ // MPEG-2 and 2.5
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+		{ // MPEG-1
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame is a parsed MPEG audio frame header.
+type mp3Frame struct {
+	size       int
+	samples    int
+	sampleRate int
+}
+
+func parseMP3Frame(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := (h[1] >> 3) & 3 // 0: 2.5, 2: 2, 3: 1
+	layer := 4 - int((h[1]>>1)&3)
+	bitrateIdx := h[2] >> 4
+	rateIdx := (h[2] >> 2) & 3
+	if version == 1 || layer == 4 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mp3Frame{}, false
+	}
+	padding := int(h[2]>>1) & 1
+	mpeg1 := 0
+	if version == 3 {
+		mpeg1 = 1
+	}
+	bitrate := mp3Bitrates[mpeg1][layer-1][bitrateIdx] * 1000
+	rate := mp3SampleRates[rateIdx]
+	switch version {
+	case 2:
+		rate /= 2
+	case 0:
+		rate /= 4
+	}
+
+	var f mp3Frame
+	f.sampleRate = rate
+	switch {
+	case layer == 1:
+		f.samples = 384
+		f.size = (12*bitrate/rate + padding) * 4
+	case layer == 3 && mpeg1 == 0:
+		f.samples = 576
+		f.size = 72*bitrate/rate + padding
+	default:
+		f.samples = 1152
+		f.size = 144*bitrate/rate + padding
+	}
+	return f, true
+}
+
+func probeMP3(data []byte) (time.Duration, error) {
+	pos := 0
+	// Skip an ID3v2 tag, whose size is stored in 7-bit bytes.
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		pos = 10 + size
+		if data[5]&0x10 != 0 {
+			pos += 10 // footer
+		}
+		if pos > len(data) {
+			return 0, fmt.Errorf("%w: ID3 tag is longer than the file", ErrTruncated)
+		}
+	}
+	end := len(data)
+	// An ID3v1 tag closes the file.
+	if end-pos >= 128 && string(data[end-128:end-125]) == "TAG" {
+		end -= 128
+	}
+
+	var (
+		frames  int
+		samples float64
+	)
+	for pos < end {
+		f, ok := parseMP3Frame(data[pos:end])
+		if !ok {
+			if frames == 0 {
+				return 0, fmt.Errorf("no MPEG audio frame at offset %d", pos)
+			}
+			return 0, fmt.Errorf("invalid MPEG frame header at offset %d after %d frames", pos, frames)
+		}
+		if pos+f.size > end {
+			return 0, fmt.Errorf("%w: frame %d needs %d bytes, %d left", ErrTruncated, frames+1, f.size, end-pos)
+		}
+		samples += float64(f.samples) / float64(f.sampleRate)
+		frames++
+		pos += f.size
+	}
+	if frames == 0 {
+		return 0, fmt.Errorf("MP3 stream has no frames")
+	}
+	return time.Duration(samples * float64(time.Second)), nil
+}
+
+// oggCRCTable is the CRC-32 of Ogg pages: polynomial 0x04C11DB7, not
+// reflected, unlike the one of hash/crc32.
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for i, b := range page {
+		// The checksum field itself counts as zeros.
+		if i >= 22 && i < 26 {
+			b = 0
+		}
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+func probeOgg(data []byte) (time.Duration, error) {
+	var (
+		pos        int
+		pages      int
+		granule    int64
+		sampleRate int
+		preSkip    int64
+	)
+	for pos < len(data) {
+		if len(data)-pos < 27 {
+			return 0, fmt.Errorf("%w: page %d header", ErrTruncated, pages+1)
+		}
+		h := data[pos:]
+		if string(h[:4]) != "OggS" || h[4] != 0 {
+			return 0, fmt.Errorf("invalid Ogg page at offset %d", pos)
+		}
+		nsegs := int(h[26])
+		if len(h) < 27+nsegs {
+			return 0, fmt.Errorf("%w: page %d segment table", ErrTruncated, pages+1)
+		}
+		size := 27 + nsegs
+		for _, l := range h[27 : 27+nsegs] {
+			size += int(l)
+		}
+		if len(h) < size {
+			return 0, fmt.Errorf("%w: page %d needs %d bytes, %d left", ErrTruncated, pages+1, size, len(h))
+		}
+		page := h[:size]
+		if got, want := oggCRC(page), binary.LittleEndian.Uint32(page[22:26]); got != want {
+			return 0, fmt.Errorf("Ogg page %d has a bad checksum", pages+1)
+		}
+		if pages == 0 {
+			body := page[27+nsegs:]
+			switch {
+			case bytes.HasPrefix(body, []byte("OpusHead")) && len(body) >= 12:
+				// Opus granules always count 48kHz samples.
+				sampleRate = 48000
+				preSkip = int64(binary.LittleEndian.Uint16(body[10:12]))
+			case bytes.HasPrefix(body, []byte("\x01vorbis")) && len(body) >= 16:
+				sampleRate = int(binary.LittleEndian.Uint32(body[12:16]))
+			}
+		}
+		if g := int64(binary.LittleEndian.Uint64(page[6:14])); g > granule {
+			granule = g
+		}
+		pages++
+		pos += size
+	}
+	if pages == 0 {
+		return 0, fmt.Errorf("Ogg stream has no pages")
+	}
+	if sampleRate == 0 {
+		return 0, fmt.Errorf("Ogg stream is neither Opus nor Vorbis")
+	}
+	return time.Duration(max(granule-preSkip, 0) * int64(time.Second) / int64(sampleRate)), nil
+}
@@ -0,0 +1,104 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mp3Stream returns n MPEG-1 layer III frames at 128 kbit/s and 44.1 kHz.
+func mp3Stream(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+// oggPage returns one Ogg page holding body, with a valid checksum.
+func oggPage(granule int64, seq uint32, body []byte) []byte {
+	var lacing []byte
+	for n := len(body); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, 1)
+	page = binary.LittleEndian.AppendUint32(page, seq)
+	page = binary.LittleEndian.AppendUint32(page, 0)
+	page = append(page, byte(len(lacing)))
+	page = append(page, lacing...)
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+	return page
+}
+
+func opusStream(seconds int64) []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, 312) // pre-skip
+	head = append(head, make([]byte, 7)...)
+	return append(oggPage(0, 0, head), oggPage(seconds*48000+312, 1, make([]byte, 300))...)
+}
+
+func TestProbeBytes(t *testing.T) {
+	wav := EncodeWAV(Silence(DefaultFormat, 1500*time.Millisecond))
+	tests := []struct {
+		name string
+		data []byte
+		mime string
+		want time.Duration
+	}{
+		{"wav", wav, "audio/wav", 1500 * time.Millisecond},
+		{"mp3", mp3Stream(38), "audio/mpeg", 38 * 1152 * time.Second / 44100},
+		{"mp3 with tags", append(append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05hello"), mp3Stream(2)...), append([]byte("TAG"), make([]byte, 125)...)...),
+			"audio/mpeg", 2 * 1152 * time.Second / 44100},
+		{"opus", opusStream(2), "audio/ogg", 2 * time.Second},
+	}
+	for _, tt := range tests {
+		info, err := ProbeBytes(tt.data)
+		if err != nil {
+			t.Errorf("%s: ProbeBytes failed: %v", tt.name, err)
+			continue
+		}
+		// MP3 durations add up float frame lengths.
+		if info.MIMEType != tt.mime || (info.Duration-tt.want).Abs() > time.Microsecond {
+			t.Errorf("%s: got %+v, want %s %v", tt.name, info, tt.mime, tt.want)
+		}
+	}
+}
+
+func TestProbeBytes_Invalid(t *testing.T) {
+	wav := EncodeWAV(Silence(DefaultFormat, time.Second))
+	ogg := opusStream(1)
+	badCRC := bytes.Clone(ogg)
+	badCRC[len(badCRC)-1] ^= 0xFF
+
+	truncated := map[string][]byte{
+		"wav": wav[:len(wav)-100],
+		"mp3": mp3Stream(3)[:1000],
+		"ogg": ogg[:len(ogg)-10],
+	}
+	for name, data := range truncated {
+		if _, err := ProbeBytes(data); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: expected ErrTruncated, got %v", name, err)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"empty":        nil,
+		"json error":   []byte(`{"error":{"code":"Unauthorized"}}`),
+		"zeros":        make([]byte, 2000),
+		"mp3 garbage":  append(mp3Stream(2), 0x00, 0x01, 0x02, 0x03),
+		"ogg checksum": badCRC,
+		"wav no data":  EncodeWAV(PCM{Format: DefaultFormat}),
+	}
+	for name, data := range invalid {
+		if _, err := ProbeBytes(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package audio
+
+import (
+	"fmt"
+	"time"
+)
+
+// Track lays PCM segments out on a timeline, filling the gaps with silence.
+type Track struct {
+	PCM
+}
+
+// NewTrack returns an empty track in format f.
+func NewTrack(f Format) *Track {
+	return &Track{PCM{Format: f}}
+}
+
+// bytesFor returns the length of d in format f, aligned to whole frames.
+func (f Format) bytesFor(d time.Duration) int {
+	n := int(int64(d) * int64(f.BytesPerSecond()) / int64(time.Second))
+	return n - n%max(f.blockAlign(), 1)
+}
+
+// End returns the time at which the audio placed so far ends.
+func (t *Track) End() time.Duration {
+	return t.Duration()
+}
+
+// Place puts p at offset at. When earlier audio still plays at that time, p
+// starts right after it instead and the resulting delay is returned.
+func (t *Track) Place(at time.Duration, p PCM) (time.Duration, error) {
+	if p.Format != t.Format {
+		return 0, fmt.Errorf("segment has format %+v, want %+v", p.Format, t.Format)
+	}
+	var late time.Duration
+	if end := t.End(); end > at {
+		late = end - at
+	} else {
+		// Pad compares in bytes: End rounds down and may fall before at
+		// while the data already reaches it.
+		t.Pad(at)
+	}
+	t.Data = append(t.Data, p.Data...)
+	return late, nil
+}
+
+// Pad extends the track with silence until it lasts d.
+func (t *Track) Pad(d time.Duration) {
+	if n := t.Format.bytesFor(d); n > len(t.Data) {
+		t.Data = append(t.Data, make([]byte, n-len(t.Data))...)
+	}
+}
@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackPlace(t *testing.T) {
+	track := NewTrack(DefaultFormat)
+	late, err := track.Place(time.Second, Silence(DefaultFormat, 2*time.Second))
+	if err != nil || late != 0 {
+		t.Fatalf("Place = %v, %v", late, err)
+	}
+	if track.End() != 3*time.Second {
+		t.Errorf("End = %v, want 3s", track.End())
+	}
+
+	// The next segment should start at 2.5s but the first one plays until 3s.
+	late, _ = track.Place(2500*time.Millisecond, Silence(DefaultFormat, time.Second))
+	if late != 500*time.Millisecond || track.End() != 4*time.Second {
+		t.Errorf("late = %v, End = %v", late, track.End())
+	}
+
+	track.Pad(10 * time.Second)
+	if track.End() != 10*time.Second {
+		t.Errorf("End after Pad = %v, want 10s", track.End())
+	}
+}
+
+func TestTrackPlace_UnalignedEnd(t *testing.T) {
+	// 3 bytes end between two samples: End rounds down to less than the
+	// data, which must not be cut or padded backwards.
+	track := NewTrack(DefaultFormat)
+	track.Data = make([]byte, 3)
+	late, err := track.Place(track.End(), Silence(DefaultFormat, time.Second))
+	if err != nil || late != 0 {
+		t.Fatalf("Place = %v, %v", late, err)
+	}
+	if want := 3 + DefaultFormat.BytesPerSecond(); len(track.Data) != want {
+		t.Errorf("len(Data) = %d, want %d", len(track.Data), want)
+	}
+}
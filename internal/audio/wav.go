@@ -0,0 +1,204 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// Format describes the layout of linear PCM samples.
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// DefaultFormat matches the riff-24khz-16bit-mono-pcm output of the TTS API.
+var DefaultFormat = Format{SampleRate: 24000, Channels: 1, BitsPerSample: 16}
+
+// PCM holds raw interleaved little-endian samples together with their format.
+type PCM struct {
+	Format Format
+	Data   []byte
+}
+
+// BytesPerSecond returns the data rate of the format.
+func (f Format) BytesPerSecond() int {
+	return f.SampleRate * f.blockAlign()
+}
+
+func (f Format) blockAlign() int {
+	return f.Channels * f.BitsPerSample / 8
+}
+
+// Duration returns the playing time of the samples.
+func (p PCM) Duration() time.Duration {
+	bps := p.Format.BytesPerSecond()
+	if bps == 0 {
+		return 0
+	}
+	return time.Duration(int64(len(p.Data)) * int64(time.Second) / int64(bps))
+}
+
+// From returns the samples of p past d.
+func (p PCM) From(d time.Duration) PCM {
+	return PCM{Format: p.Format, Data: p.Data[min(p.Format.bytesFor(d), len(p.Data)):]}
+}
+
+// Silence returns d worth of zero samples in format f.
+func Silence(f Format, d time.Duration) PCM {
+	return PCM{Format: f, Data: make([]byte, f.bytesFor(d))}
+}
+
+// Concat joins parts into one stream. All parts must share the same format.
+func Concat(parts ...PCM) (PCM, error) {
+	if len(parts) == 0 {
+		return PCM{Format: DefaultFormat}, nil
+	}
+	out := PCM{Format: parts[0].Format}
+	size := 0
+	for i, p := range parts {
+		if p.Format != out.Format {
+			return PCM{}, fmt.Errorf("part %d has format %+v, want %+v", i, p.Format, out.Format)
+		}
+		size += len(p.Data)
+	}
+	out.Data = make([]byte, 0, size)
+	for _, p := range parts {
+		out.Data = append(out.Data, p.Data...)
+	}
+	return out, nil
+}
+
+// DecodeWAV parses a RIFF/WAVE byte slice holding linear PCM.
+func DecodeWAV(data []byte) (PCM, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return PCM{}, fmt.Errorf("not a RIFF/WAVE stream")
+	}
+	var (
+		format  Format
+		hasFmt  bool
+		samples []byte
+		hasData bool
+	)
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		// Streamed WAVs may carry a placeholder size; clamp it to the file.
+		end := min(body+size, len(data))
+		switch id {
+		case "fmt ":
+			if end-body < 16 {
+				return PCM{}, fmt.Errorf("fmt chunk too short: %d bytes", end-body)
+			}
+			if tag := binary.LittleEndian.Uint16(data[body:]); tag != 1 {
+				return PCM{}, fmt.Errorf("unsupported WAV encoding: %d", tag)
+			}
+			format = Format{
+				Channels:      int(binary.LittleEndian.Uint16(data[body+2:])),
+				SampleRate:    int(binary.LittleEndian.Uint32(data[body+4:])),
+				BitsPerSample: int(binary.LittleEndian.Uint16(data[body+14:])),
+			}
+			hasFmt = true
+		case "data":
+			samples = data[body:end]
+			hasData = true
+		}
+		if hasFmt && hasData {
+			break
+		}
+		pos = end + size%2
+	}
+	if !hasFmt || !hasData {
+		return PCM{}, fmt.Errorf("WAV stream is missing its fmt or data chunk")
+	}
+	if format.Channels == 0 || format.BitsPerSample == 0 || format.SampleRate == 0 || format.blockAlign() == 0 {
+		return PCM{}, fmt.Errorf("invalid WAV format: %+v", format)
+	}
+	samples = samples[:len(samples)-len(samples)%format.blockAlign()]
+	return PCM{Format: format, Data: samples}, nil
+}
+
+// ReadWAV loads a WAV file from disk.
+func ReadWAV(path string) (PCM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PCM{}, err
+	}
+	p, err := DecodeWAV(data)
+	if err != nil {
+		return PCM{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// EncodeWAV serializes p as a canonical 44-byte-header WAV stream.
+func EncodeWAV(p PCM) []byte {
+	var buf bytes.Buffer
+	f := p.Format
+	write := func(v any) { _ = binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	write(uint32(36 + len(p.Data)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	write(uint32(16))
+	write(uint16(1))
+	write(uint16(f.Channels))
+	write(uint32(f.SampleRate))
+	write(uint32(f.BytesPerSecond()))
+	write(uint16(f.blockAlign()))
+	write(uint16(f.BitsPerSample))
+	buf.WriteString("data")
+	write(uint32(len(p.Data)))
+	buf.Write(p.Data)
+	return buf.Bytes()
+}
+
+// Save writes p to path. A .wav path is written directly; any other extension
+// is transcoded with ffmpeg.
+func Save(path string, p PCM) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		return utils.WriteFileAtomic(path, EncodeWAV(p), 0644)
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg is required to write %s: %w", filepath.Ext(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tts-*.wav")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(EncodeWAV(p)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	logger.LogDebug("Transcoding %s to %s", tmp.Name(), path)
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", tmp.Name(), path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// FileDuration returns the playing time of a WAV, MP3 or Ogg file.
+func FileDuration(path string) (time.Duration, error) {
+	info, err := Probe(path)
+	return info.Duration, err
+}
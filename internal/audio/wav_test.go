@@ -0,0 +1,73 @@
+package audio
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeWAV(t *testing.T) {
+	in := Silence(DefaultFormat, 500*time.Millisecond)
+	out, err := DecodeWAV(EncodeWAV(in))
+	if err != nil {
+		t.Fatalf("DecodeWAV failed: %v", err)
+	}
+	if out.Format != DefaultFormat {
+		t.Errorf("Format = %+v, want %+v", out.Format, DefaultFormat)
+	}
+	if out.Duration() != 500*time.Millisecond {
+		t.Errorf("Duration = %v, want 500ms", out.Duration())
+	}
+}
+
+func TestDecodeWAV_Invalid(t *testing.T) {
+	if _, err := DecodeWAV([]byte(`{"error":"quota"}`)); err == nil {
+		t.Error("Expected error for non-WAV data")
+	}
+	// 4 bits per sample make a block of no bytes.
+	tiny := EncodeWAV(PCM{Format: Format{SampleRate: 8000, Channels: 1, BitsPerSample: 4}, Data: []byte{1, 2, 3}})
+	if _, err := DecodeWAV(tiny); err == nil {
+		t.Error("Expected error for samples under 8 bits")
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a := Silence(DefaultFormat, time.Second)
+	b := Silence(DefaultFormat, 250*time.Millisecond)
+	got, err := Concat(a, b)
+	if err != nil {
+		t.Fatalf("Concat failed: %v", err)
+	}
+	if got.Duration() != 1250*time.Millisecond {
+		t.Errorf("Duration = %v, want 1.25s", got.Duration())
+	}
+
+	other := Silence(Format{SampleRate: 16000, Channels: 1, BitsPerSample: 16}, time.Second)
+	if _, err := Concat(a, other); err == nil {
+		t.Error("Expected error when joining different formats")
+	}
+}
+
+func TestPCMFrom(t *testing.T) {
+	p := Silence(DefaultFormat, time.Second)
+	if got := p.From(250 * time.Millisecond).Duration(); got != 750*time.Millisecond {
+		t.Errorf("From(250ms) = %v, want 750ms", got)
+	}
+	if got := p.From(2 * time.Second).Duration(); got != 0 {
+		t.Errorf("From past the end = %v, want 0", got)
+	}
+}
+
+func TestSaveAndReadWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "silence.wav")
+	if err := Save(path, Silence(DefaultFormat, time.Second)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	p, err := ReadWAV(path)
+	if err != nil {
+		t.Fatalf("ReadWAV failed: %v", err)
+	}
+	if p.Duration() != time.Second {
+		t.Errorf("Duration = %v, want 1s", p.Duration())
+	}
+}
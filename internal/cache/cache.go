@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	INDEX_FILE = "index.json"
+	// QUARANTINE_DIR, inside the cache directory, keeps corrupt files.
+	QUARANTINE_DIR = "quarantine"
+)
+
+// Entry describes one cached audio file.
+type Entry struct {
+	Key string `json:"key"`
+	// Aliases are the keys the file was known by before being re-keyed.
+	Aliases    []string      `json:"aliases,omitempty"`
+	File       string        `json:"file"`
+	Content    string        `json:"content,omitempty"`
+	Lang       string        `json:"lang,omitempty"`
+	Voice      string        `json:"voice,omitempty"`
+	Speed      float64       `json:"speed,omitempty"`
+	Format     string        `json:"format,omitempty"`
+	Size       int64         `json:"size"`
+	Duration   time.Duration `json:"duration"`
+	Created    time.Time     `json:"created"`
+	LastPlayed time.Time     `json:"last_played,omitzero"`
+}
+
+// LastUsed returns when the entry was last played, or created if it never was.
+func (e *Entry) LastUsed() time.Time {
+	if e.LastPlayed.After(e.Created) {
+		return e.LastPlayed
+	}
+	return e.Created
+}
+
+// Index is the record of what each file in the cache directory contains.
+type Index struct {
+	Entries map[string]*Entry `json:"entries"`
+
+	dir string
+}
+
+// Limits bound the cache. Zero values mean no limit.
+type Limits struct {
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+// mu serializes the load-modify-save cycles of Update within the process;
+// the lock file of INDEX_FILE serializes them between processes.
+var mu sync.Mutex
+
+// errUnchanged tells Update that fn left the index as it was.
+var errUnchanged = errors.New("index unchanged")
+
+// Load reads the index of dir. A missing index is empty.
+func Load(dir string) (*Index, error) {
+	ix := &Index{Entries: map[string]*Entry{}, dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, INDEX_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ix); err != nil {
+		return nil, fmt.Errorf("error parsing cache index: %w", err)
+	}
+	if ix.Entries == nil {
+		ix.Entries = map[string]*Entry{}
+	}
+	return ix, nil
+}
+
+// Save writes the index back, replacing the previous one in a single rename
+// so that readers never see a partial file.
+func (ix *Index) Save() error {
+	data, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ix.dir, 0755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(ix.dir, INDEX_FILE), data, 0644)
+}
+
+// Dir returns the cache directory.
+func (ix *Index) Dir() string {
+	return ix.dir
+}
+
+// Path returns the location of an entry's file.
+func (ix *Index) Path(e *Entry) string {
+	return filepath.Join(ix.dir, e.File)
+}
+
+// Find returns the entry whose key or alias starts with prefix, if exactly
+// one does.
+func (ix *Index) Find(prefix string) (*Entry, error) {
+	if e, ok := ix.Entries[prefix]; ok {
+		return e, nil
+	}
+	var found *Entry
+	for key, e := range ix.Entries {
+		if !strings.HasPrefix(key, prefix) && !slices.ContainsFunc(e.Aliases, func(a string) bool {
+			return strings.HasPrefix(a, prefix)
+		}) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("key prefix %s is ambiguous", prefix)
+		}
+		found = e
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no cache entry for %s", prefix)
+	}
+	return found, nil
+}
+
+// TotalSize returns the size of all indexed files.
+func (ix *Index) TotalSize() int64 {
+	var total int64
+	for _, e := range ix.Entries {
+		total += e.Size
+	}
+	return total
+}
+
+// Sorted returns the entries ordered from the least to the most recently
+// used.
+func (ix *Index) Sorted() []*Entry {
+	entries := make([]*Entry, 0, len(ix.Entries))
+	for _, e := range ix.Entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int {
+		if c := a.LastUsed().Compare(b.LastUsed()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return entries
+}
+
+// Prune evicts entries older than l.MaxAge, then the least recently used ones
+// until the cache fits in l.MaxSize. The evicted entries are returned; unless
+// dryRun, their files are deleted and they are removed from the index.
+func (ix *Index) Prune(l Limits, now time.Time, dryRun bool) ([]*Entry, error) {
+	return ix.prune(l, now, dryRun, "")
+}
+
+// prune is Prune sparing the entry with key keep.
+func (ix *Index) prune(l Limits, now time.Time, dryRun bool, keep string) ([]*Entry, error) {
+	var (
+		evicted []*Entry
+		errs    []error
+	)
+	total := ix.TotalSize()
+	for _, e := range ix.Sorted() {
+		expired := l.MaxAge > 0 && now.Sub(e.LastUsed()) > l.MaxAge
+		oversize := l.MaxSize > 0 && total > l.MaxSize
+		if (!expired && !oversize) || e.Key == keep {
+			continue
+		}
+		evicted = append(evicted, e)
+		total -= e.Size
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(ix.Path(e)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		delete(ix.Entries, e.Key)
+	}
+	return evicted, errors.Join(errs...)
+}
+
+// Update loads the index of dir, applies fn and saves the result. It saves
+// it even when fn fails, since fn may have removed or renamed files before
+// failing, which the index must not forget.
+func Update(dir string, fn func(ix *Index) error) error {
+	mu.Lock()
+	defer mu.Unlock()
+	unlock, err := Lock(dir, INDEX_FILE)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ix, err := Load(dir)
+	if err != nil {
+		return err
+	}
+	err = fn(ix)
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return errors.Join(err, ix.Save())
+}
+
+// ConfiguredLimits returns the limits set in the cache section of the config.
+func ConfiguredLimits() (Limits, error) {
+	size, err := config.ParseSize(config.Cache.MaxSize)
+	if err != nil {
+		return Limits{}, fmt.Errorf("cache max_size: %w", err)
+	}
+	return Limits{MaxSize: size, MaxAge: config.Cache.MaxAge}, nil
+}
+
+// NewEntry describes the audio file at path. The size and duration are read
+// from the file; the caller fills in what it contains.
+func NewEntry(key, path string) (Entry, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{
+		Key:     key,
+		File:    filepath.Base(path),
+		Format:  audio.MIMEType(path),
+		Size:    fi.Size(),
+		Created: fi.ModTime(),
+	}
+	if info, err := audio.Probe(path); err == nil {
+		e.Format, e.Duration = info.MIMEType, info.Duration
+	}
+	return e, nil
+}
+
+// Record adds e to the index of dir and evicts what exceeds the configured
+// limits. e itself is never evicted, as it is about to be played.
+func Record(dir string, e Entry) error {
+	limits, err := ConfiguredLimits()
+	if err != nil {
+		return err
+	}
+	return Update(dir, func(ix *Index) error {
+		if old, ok := ix.Entries[e.Key]; ok && e.LastPlayed.IsZero() {
+			e.LastPlayed = old.LastPlayed
+		}
+		ix.Entries[e.Key] = &e
+		evicted, err := ix.prune(limits, time.Now(), false, e.Key)
+		for _, ev := range evicted {
+			logger.LogDebug("Evicted %s from the cache (%d bytes)", ev.File, ev.Size)
+		}
+		return err
+	})
+}
+
+// Rekey moves the entry of oldKey to newKey, whose file is now file, and keeps
+// oldKey as an alias. An unknown oldKey is indexed from the file.
+func (ix *Index) Rekey(oldKey, newKey, file string) error {
+	e, ok := ix.Entries[oldKey]
+	if !ok {
+		fresh, err := NewEntry(newKey, filepath.Join(ix.dir, file))
+		if err != nil {
+			return err
+		}
+		e = &fresh
+	}
+	delete(ix.Entries, oldKey)
+	e.Key, e.File = newKey, file
+	if !slices.Contains(e.Aliases, oldKey) {
+		e.Aliases = append(e.Aliases, oldKey)
+	}
+	ix.Entries[newKey] = e
+	return nil
+}
+
+// Rekey re-keys an entry of the index of dir, see Index.Rekey.
+func Rekey(dir, oldKey, newKey, file string) error {
+	return Update(dir, func(ix *Index) error {
+		return ix.Rekey(oldKey, newKey, file)
+	})
+}
+
+// Touch marks the entry as just played.
+func Touch(dir, key string) error {
+	return Update(dir, func(ix *Index) error {
+		e, ok := ix.Entries[key]
+		if !ok {
+			return errUnchanged
+		}
+		e.LastPlayed = time.Now()
+		return nil
+	})
+}
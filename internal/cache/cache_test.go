@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func writeAudio(t *testing.T, dir, key string, d time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, key+".mp3")
+	if err := os.WriteFile(path, audio.EncodeWAV(audio.Silence(audio.DefaultFormat, d)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecordAndTouch(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewEntry("abc", writeAudio(t, dir, "abc", time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Content, e.Lang = "Bonjour", "fr-FR"
+	if err := Record(dir, e); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := Touch(dir, "abc"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+
+	ix, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ix.Find("ab")
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if got.Content != "Bonjour" || got.Duration != time.Second || got.Format != "audio/wav" || got.LastPlayed.IsZero() {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+	if _, err := ix.Find("zz"); err == nil {
+		t.Error("Expected error for unknown key")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	ix, _ := Load(dir)
+	for i, key := range []string{"old", "mid", "new"} {
+		e, err := NewEntry(key, writeAudio(t, dir, key, time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Created = now.Add(time.Duration(i-3) * time.Hour)
+		ix.Entries[key] = &e
+	}
+	size := ix.Entries["new"].Size
+
+	// Dry run reports without deleting.
+	evicted, _ := ix.Prune(Limits{MaxAge: 150 * time.Minute}, now, true)
+	if len(evicted) != 1 || evicted[0].Key != "old" || len(ix.Entries) != 3 {
+		t.Fatalf("Unexpected dry run: %d evicted, %d left", len(evicted), len(ix.Entries))
+	}
+
+	// Fitting two files evicts the least recently used one.
+	ix.Entries["old"].LastPlayed = now
+	evicted, err := ix.Prune(Limits{MaxSize: 2 * size}, now, false)
+	if err != nil || len(evicted) != 1 || evicted[0].Key != "mid" {
+		t.Fatalf("Prune evicted %v, err %v", evicted, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mid.mp3")); !os.IsNotExist(err) {
+		t.Error("Expected evicted file to be deleted")
+	}
+}
+
+func TestUpdate_SavesPartialProgress(t *testing.T) {
+	dir := t.TempDir()
+	for _, key := range []string{"abc", "def"} {
+		e, err := NewEntry(key, writeAudio(t, dir, key, time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Record(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first file goes, then the work fails.
+	err := Update(dir, func(ix *Index) error {
+		os.Remove(ix.Path(ix.Entries["abc"]))
+		delete(ix.Entries, "abc")
+		return os.ErrPermission
+	})
+	if !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("Update = %v, want the error of fn", err)
+	}
+	ix, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Entries["abc"]; ok || len(ix.Entries) != 1 {
+		t.Errorf("Expected the removed entry to be forgotten, got %v", ix.Entries)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	ix, _ := Load(dir)
+	for _, key := range []string{"good", "gone", "bad"} {
+		e, _ := NewEntry(key, writeAudio(t, dir, key, time.Second))
+		ix.Entries[key] = &e
+	}
+	os.Remove(filepath.Join(dir, "gone.mp3"))
+	os.WriteFile(filepath.Join(dir, "bad.mp3"), []byte(`{"error":"quota exceeded"}`), 0644)
+	writeAudio(t, dir, "stray", time.Second)
+
+	r, err := ix.Verify(true)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if r.Checked != 3 || len(r.Missing) != 1 || len(r.Corrupt) != 1 || len(r.Untracked) != 1 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if _, ok := ix.Entries["stray"]; !ok || len(ix.Entries) != 2 {
+		t.Errorf("Expected fixed index with good and stray, got %v", ix.Entries)
+	}
+
+	r, _ = ix.Verify(false)
+	if !r.OK() {
+		t.Errorf("Expected clean report after fix, got %+v", r)
+	}
+}
+
+func TestConfiguredLimits(t *testing.T) {
+	config.Cache = config.CacheConfig{MaxSize: "1MB", MaxAge: time.Hour}
+	defer func() { config.Cache = config.CacheConfig{} }()
+	l, err := ConfiguredLimits()
+	if err != nil || l.MaxSize != 1<<20 || l.MaxAge != time.Hour {
+		t.Errorf("ConfiguredLimits = %+v, %v", l, err)
+	}
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// LOCK_STALE is how old a lock file may get before it is considered left
+	// behind by a process that died, where locks are not flocks. The holder
+	// refreshes its mtime well within it.
+	LOCK_STALE = 3 * time.Minute
+	// LOCK_TIMEOUT is how long Lock waits for another process.
+	LOCK_TIMEOUT = 5 * time.Minute
+)
+
+// lockPoll is how often a waiting Lock checks the lock file again.
+var lockPoll = 100 * time.Millisecond
+
+// LockPath returns the lock file of key in dir.
+func LockPath(dir, key string) string {
+	return filepath.Join(dir, "."+key+".lock")
+}
+
+// Lock takes the lock of key in dir, shared by every process using the
+// directory, and returns the function releasing it. While another process
+// holds the lock, Lock waits, so that one synthesis is not done twice.
+func Lock(dir, key string) (unlock func(), err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := LockPath(dir, key)
+	deadline := time.Now().Add(LOCK_TIMEOUT)
+	waiting := false
+	for {
+		unlock, ok, err := tryLock(path)
+		if err != nil || ok {
+			return unlock, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s, held by process %s", path, lockOwner(path))
+		}
+		if !waiting {
+			logger.LogDebug("Waiting for process %s to release %s", lockOwner(path), path)
+			waiting = true
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// TryLock is Lock without the wait: ok is false while another process holds
+// the lock.
+func TryLock(dir, key string) (unlock func(), ok bool, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, false, err
+	}
+	return tryLock(LockPath(dir, key))
+}
+
+// samePath reports whether f is still the file at path.
+func samePath(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
+}
+
+// lockOwner returns the process id written in a lock file.
+func lockOwner(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "?"
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "?"
+	}
+	return strconv.Itoa(pid)
+}
@@ -0,0 +1,96 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// tryLock creates the lock file at path, first removing one older than
+// LOCK_STALE whose process is gone.
+func tryLock(path string) (unlock func(), ok bool, err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				os.Remove(path)
+				return nil, false, err
+			}
+			return holdLock(path, fi), true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, false, err
+		}
+		fi, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// The holder just released it: retry at once.
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		owner := lockOwner(path)
+		if time.Since(fi.ModTime()) <= LOCK_STALE || processAlive(owner) {
+			return nil, false, nil
+		}
+		logger.LogWarn("Removing stale lock %s of process %s", path, owner)
+		os.Remove(path)
+	}
+}
+
+// holdLock keeps the mtime of the lock file fi at path fresh until the
+// returned unlock, which removes the file if it is still fi.
+func holdLock(path string, fi os.FileInfo) (unlock func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(LOCK_STALE / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if cur, err := os.Stat(path); err == nil && os.SameFile(cur, fi) {
+					now := time.Now()
+					os.Chtimes(path, now, now)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		if cur, err := os.Stat(path); err == nil && os.SameFile(cur, fi) {
+			os.Remove(path)
+		}
+	}
+}
+
+// processAlive reports whether the process of pid, as written by lockOwner,
+// still runs. An unknown pid counts as gone.
+func processAlive(pid string) bool {
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return false
+	}
+	if n == os.Getpid() {
+		return true
+	}
+	p, err := os.FindProcess(n)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLockWaitsForHolder(t *testing.T) {
+	lockPoll = time.Millisecond
+	dir := t.TempDir()
+	unlock, err := Lock(dir, "abc")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	acquired := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		second, err := Lock(dir, "abc")
+		if err != nil {
+			t.Errorf("Second Lock failed: %v", err)
+		}
+		acquired <- time.Now()
+		second()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	released := time.Now()
+	unlock()
+	if got := <-acquired; got.Before(released) {
+		t.Error("Second Lock returned while the first was held")
+	}
+	<-done
+	if _, err := os.Stat(LockPath(dir, "abc")); !os.IsNotExist(err) {
+		t.Error("Expected the lock file to be removed")
+	}
+}
+
+func TestLockBreaksStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	path := LockPath(dir, "abc")
+	if err := os.WriteFile(path, []byte("12345\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * LOCK_STALE)
+	os.Chtimes(path, old, old)
+
+	unlock, err := Lock(dir, "abc")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	unlock()
+}
+
+func TestTryLock(t *testing.T) {
+	dir := t.TempDir()
+	unlock, ok, err := TryLock(dir, "abc")
+	if !ok || err != nil {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, ok, err := TryLock(dir, "abc"); ok || err != nil {
+		t.Errorf("Expected a held lock to be refused, got %v, %v", ok, err)
+	}
+	unlock()
+	second, ok, err := TryLock(dir, "abc")
+	if !ok || err != nil {
+		t.Fatalf("TryLock after unlock = %v, %v", ok, err)
+	}
+	second()
+}
+
+func TestLockIsNotBrokenWhileHeld(t *testing.T) {
+	dir := t.TempDir()
+	unlock, ok, err := TryLock(dir, "abc")
+	if !ok || err != nil {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	defer unlock()
+	// However old, a lock of a running process is not stale.
+	old := time.Now().Add(-2 * LOCK_STALE)
+	os.Chtimes(LockPath(dir, "abc"), old, old)
+	if _, ok, err := TryLock(dir, "abc"); ok || err != nil {
+		t.Errorf("Expected the held lock to be refused, got %v, %v", ok, err)
+	}
+}
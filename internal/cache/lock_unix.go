@@ -0,0 +1,43 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes an flock on the file at path. The kernel releases it when
+// the process dies, so a lock is never left behind.
+func tryLock(path string) (unlock func(), ok bool, err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, unix.EWOULDBLOCK) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		// The previous holder removed the file we opened: lock the one now
+		// at path instead.
+		if !samePath(f, path) {
+			f.Close()
+			continue
+		}
+		f.Truncate(0)
+		fmt.Fprintln(f, os.Getpid())
+		return func() {
+			// Only the holder removes the file, before releasing it, and
+			// whoever locks it next checks that it is still at path.
+			os.Remove(path)
+			f.Close()
+		}, true, nil
+	}
+}
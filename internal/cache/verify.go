@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// Report lists the problems found by Verify.
+type Report struct {
+	Checked int `json:"checked"`
+	// Missing entries have no file anymore.
+	Missing []string `json:"missing,omitempty"`
+	// Corrupt entries have a file that is not complete audio.
+	Corrupt []string `json:"corrupt,omitempty"`
+	// Resized entries have a file whose size differs from the index.
+	Resized []string `json:"resized,omitempty"`
+	// Untracked files are in the cache directory but not in the index.
+	Untracked []string `json:"untracked,omitempty"`
+}
+
+// OK reports whether Verify found nothing to fix.
+func (r Report) OK() bool {
+	return len(r.Missing)+len(r.Corrupt)+len(r.Resized)+len(r.Untracked) == 0
+}
+
+// CheckAudio reports whether the file at path holds complete audio.
+func CheckAudio(path string) bool {
+	_, err := audio.Probe(path)
+	return err == nil
+}
+
+// Quarantine moves the corrupt file at path out of the cache directory dir,
+// into its QUARANTINE_DIR, and drops its entry from the index. The file is
+// kept for inspection rather than deleted.
+func Quarantine(dir, path string) error {
+	if err := quarantineFile(dir, path); err != nil {
+		return err
+	}
+	return Update(dir, func(ix *Index) error {
+		for key, e := range ix.Entries {
+			if e.File == filepath.Base(path) {
+				delete(ix.Entries, key)
+				return nil
+			}
+		}
+		return errUnchanged
+	})
+}
+
+func quarantineFile(dir, path string) error {
+	qdir := filepath.Join(dir, QUARANTINE_DIR)
+	if err := os.MkdirAll(qdir, 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(qdir, filepath.Base(path)+"."+time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	logger.LogWarn("Quarantined corrupt audio %s to %s", path, dest)
+	return nil
+}
+
+// Verify checks every entry against its file and looks for audio files that
+// are not indexed. With fix, missing entries are dropped, corrupt files are
+// quarantined, sizes are updated and untracked files are indexed.
+func (ix *Index) Verify(fix bool) (Report, error) {
+	var r Report
+	for _, e := range ix.Sorted() {
+		r.Checked++
+		path := ix.Path(e)
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+			r.Missing = append(r.Missing, e.Key)
+			if fix {
+				delete(ix.Entries, e.Key)
+			}
+		case !CheckAudio(path):
+			r.Corrupt = append(r.Corrupt, e.Key)
+			if fix {
+				if err := quarantineFile(ix.dir, path); err != nil {
+					return r, err
+				}
+				delete(ix.Entries, e.Key)
+			}
+		case fi.Size() != e.Size:
+			r.Resized = append(r.Resized, e.Key)
+			if fix {
+				if fresh, err := NewEntry(e.Key, path); err == nil {
+					e.Size, e.Duration, e.Format = fresh.Size, fresh.Duration, fresh.Format
+				}
+			}
+		}
+	}
+
+	tracked := map[string]bool{}
+	for _, e := range ix.Entries {
+		tracked[e.File] = true
+	}
+	files, err := os.ReadDir(ix.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return r, err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || tracked[name] || !isAudioFileName(name) {
+			continue
+		}
+		r.Untracked = append(r.Untracked, name)
+		if fix {
+			e, err := NewEntry(strings.TrimSuffix(name, filepath.Ext(name)), filepath.Join(ix.dir, name))
+			if err != nil {
+				return r, err
+			}
+			ix.Entries[e.Key] = &e
+		}
+	}
+	slices.Sort(r.Untracked)
+	return r, nil
+}
+
+func isAudioFileName(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3", ".wav", ".ogg", ".opus", ".m4a":
+		return true
+	}
+	return false
+}
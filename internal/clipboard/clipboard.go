@@ -0,0 +1,174 @@
+// Package clipboard copies text with whatever the machine offers: the copy
+// command of the desktop, or the OSC 52 escape sequence of the terminal,
+// which also works over SSH.
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+	"golang.org/x/term"
+)
+
+// MAX_OSC52_SIZE is the largest payload most terminals accept in OSC 52.
+const MAX_OSC52_SIZE = 74994
+
+// COPY_WAIT_DELAY is how long Copy waits for the stderr of a copy command
+// once it exited. xclip and wl-copy leave a child serving the selection,
+// which keeps it open.
+const COPY_WAIT_DELAY = 500 * time.Millisecond
+
+// Provider copies text to a clipboard.
+type Provider interface {
+	Name() string
+	Copy(text string) error
+}
+
+// Seams for tests.
+var (
+	lookPath = exec.LookPath
+	getenv   = os.Getenv
+	goos     = runtime.GOOS
+	// openTTY returns the terminal OSC 52 is written to, or nil.
+	openTTY = func() io.WriteCloser {
+		if f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+			return f
+		}
+		if term.IsTerminal(int(os.Stderr.Fd())) {
+			return nopCloser{os.Stderr}
+		}
+		return nil
+	}
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// commands are tried in order by Detect, each when its condition holds.
+var commands = []struct {
+	name string
+	args []string
+	when func() bool
+}{
+	{"pbcopy", nil, func() bool { return goos == "darwin" }},
+	{"wl-copy", nil, func() bool { return getenv("WAYLAND_DISPLAY") != "" }},
+	{"xclip", []string{"-selection", "clipboard"}, func() bool { return getenv("DISPLAY") != "" }},
+	{"xsel", []string{"--clipboard", "--input"}, func() bool { return getenv("DISPLAY") != "" }},
+}
+
+// Command copies by writing the text to the stdin of a program.
+type Command struct {
+	Path string
+	Args []string
+}
+
+func (c Command) Name() string { return filepath.Base(c.Path) }
+
+func (c Command) Copy(text string) error {
+	var stderr strings.Builder
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = COPY_WAIT_DELAY
+	err := cmd.Run()
+	// The command succeeded, only the child it left behind holds stderr.
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", c.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// OSC52 asks the terminal to set its clipboard.
+type OSC52 struct{}
+
+func (OSC52) Name() string { return config.CLIPBOARD_OSC52 }
+
+func (OSC52) Copy(text string) error {
+	seq, err := osc52Sequence(text, getenv("TMUX") != "")
+	if err != nil {
+		return err
+	}
+	tty := openTTY()
+	if tty == nil {
+		return fmt.Errorf("no terminal to send OSC 52 to")
+	}
+	defer tty.Close()
+	_, err = io.WriteString(tty, seq)
+	return err
+}
+
+// osc52Sequence encodes text for the system clipboard. Inside tmux the
+// sequence is passed through to the outer terminal.
+func osc52Sequence(text string, tmux bool) (string, error) {
+	payload := base64.StdEncoding.EncodeToString([]byte(text))
+	if len(payload) > MAX_OSC52_SIZE {
+		return "", fmt.Errorf("text too long for OSC 52: %d bytes", len(text))
+	}
+	seq := "\x1b]52;c;" + payload + "\x07"
+	if tmux {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq, nil
+}
+
+// Detect returns the provider of the clipboard config: the one it names, or
+// the first available one for auto. It returns nil, nil when copying is off.
+func Detect(c config.ClipboardConfig) (Provider, error) {
+	switch c.Provider {
+	case config.CLIPBOARD_OFF:
+		return nil, nil
+	case config.CLIPBOARD_OSC52:
+		return OSC52{}, nil
+	case config.CLIPBOARD_COMMAND:
+		fields := strings.Fields(c.Command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("clipboard provider is command, but no command is set")
+		}
+		return Command{Path: fields[0], Args: fields[1:]}, nil
+	case "", config.CLIPBOARD_AUTO:
+		for _, cmd := range commands {
+			if !cmd.when() {
+				continue
+			}
+			if path, err := lookPath(cmd.name); err == nil {
+				return Command{Path: path, Args: cmd.args}, nil
+			}
+		}
+		// Over SSH or on a console there is no copy command, but the
+		// terminal may still hold a clipboard.
+		return OSC52{}, nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == c.Provider {
+			path, err := lookPath(cmd.name)
+			if err != nil {
+				return nil, fmt.Errorf("clipboard provider %s: %w", c.Provider, err)
+			}
+			return Command{Path: path, Args: cmd.args}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown clipboard provider: %s", c.Provider)
+}
+
+// Copy copies text with the configured provider and returns its name, or ""
+// when copying is off.
+func Copy(text string) (string, error) {
+	p, err := Detect(config.Clipboard)
+	if err != nil || p == nil {
+		return "", err
+	}
+	return p.Name(), p.Copy(text)
+}
@@ -0,0 +1,130 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+// fakeEnv makes Detect see the given OS, environment and installed commands.
+func fakeEnv(t *testing.T, system string, env map[string]string, installed ...string) {
+	oldLook, oldEnv, oldOS := lookPath, getenv, goos
+	t.Cleanup(func() { lookPath, getenv, goos = oldLook, oldEnv, oldOS })
+	goos = system
+	getenv = func(k string) string { return env[k] }
+	lookPath = func(name string) (string, error) {
+		for _, i := range installed {
+			if i == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name      string
+		goos      string
+		env       map[string]string
+		installed []string
+		want      string
+	}{
+		{"macOS", "darwin", nil, []string{"pbcopy"}, "pbcopy"},
+		{"Wayland", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, []string{"wl-copy", "xclip"}, "wl-copy"},
+		{"X11", "linux", map[string]string{"DISPLAY": ":0"}, []string{"xclip", "xsel"}, "xclip"},
+		{"X11 with xsel only", "linux", map[string]string{"DISPLAY": ":0"}, []string{"xsel"}, "xsel"},
+		{"SSH", "linux", map[string]string{"SSH_TTY": "/dev/pts/0"}, []string{"xclip"}, config.CLIPBOARD_OSC52},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeEnv(t, tt.goos, tt.env, tt.installed...)
+			p, err := Detect(config.ClipboardConfig{})
+			if err != nil || p.Name() != tt.want {
+				t.Errorf("Detect() = %v, %v; want %s", p, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect_Configured(t *testing.T) {
+	fakeEnv(t, "linux", nil, "xsel")
+	if p, err := Detect(config.ClipboardConfig{Provider: "off"}); p != nil || err != nil {
+		t.Errorf("Expected no provider when off, got %v, %v", p, err)
+	}
+	if p, err := Detect(config.ClipboardConfig{Provider: "xsel"}); err != nil || p.Name() != "xsel" {
+		t.Errorf("Detect(xsel) = %v, %v", p, err)
+	}
+	if _, err := Detect(config.ClipboardConfig{Provider: "xclip"}); err == nil {
+		t.Error("Expected error for a provider that is not installed")
+	}
+	if _, err := Detect(config.ClipboardConfig{Provider: "clippy"}); err == nil {
+		t.Error("Expected error for an unknown provider")
+	}
+	if _, err := Detect(config.ClipboardConfig{Provider: "command"}); err == nil {
+		t.Error("Expected error for command without a command")
+	}
+	p, err := Detect(config.ClipboardConfig{Provider: "command", Command: "tmux load-buffer -"})
+	if c, ok := p.(Command); !ok || err != nil || c.Path != "tmux" || len(c.Args) != 2 {
+		t.Errorf("Detect(command) = %#v, %v", p, err)
+	}
+}
+
+func TestCommandCopy(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "clip")
+	c := Command{Path: "sh", Args: []string{"-c", "cat > " + out}}
+	if err := c.Copy("https://example.com/a.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "https://example.com/a.mp3" {
+		t.Errorf("Copied %q", data)
+	}
+	if err := (Command{Path: "false"}).Copy("x"); err == nil {
+		t.Error("Expected error from a failing command")
+	}
+
+	// Like xclip, leave a child serving the selection with the pipes open.
+	start := time.Now()
+	if err := (Command{Path: "sh", Args: []string{"-c", "cat > /dev/null; sleep 10 &"}}).Copy("x"); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Copy waited %v for the child", took)
+	}
+}
+
+type bufferCloser struct{ bytes.Buffer }
+
+func (*bufferCloser) Close() error { return nil }
+
+func TestOSC52(t *testing.T) {
+	fakeEnv(t, "linux", map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"})
+	var buf bufferCloser
+	old := openTTY
+	defer func() { openTTY = old }()
+	openTTY = func() io.WriteCloser { return &buf }
+
+	if err := (OSC52{}).Copy("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "\x1bPtmux;\x1b\x1b]52;c;aGk=\x07\x1b\\"; got != want {
+		t.Errorf("Wrote %q, want %q", got, want)
+	}
+	if seq, _ := osc52Sequence("hi", false); seq != "\x1b]52;c;aGk=\x07" {
+		t.Errorf("osc52Sequence = %q", seq)
+	}
+	if _, err := osc52Sequence(string(make([]byte, MAX_OSC52_SIZE)), false); err == nil {
+		t.Error("Expected error for a payload terminals reject")
+	}
+
+	openTTY = func() io.WriteCloser { return nil }
+	if err := (OSC52{}).Copy("hi"); err == nil {
+		t.Error("Expected error without a terminal")
+	}
+}
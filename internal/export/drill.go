@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Segments of a drill template.
+const (
+	DRILL_TARGET      = "target"
+	DRILL_TRANSLATION = "translation"
+)
+
+// DEFAULT_DRILL_TEMPLATE hears the translation, then the target twice, with
+// time to recall it and to repeat it.
+const DEFAULT_DRILL_TEMPLATE = "translation → 1s → target → 3s → target → 3s"
+
+var templateSeparators = regexp.MustCompile(`\s*(?:→|->|,)\s*`)
+
+// Segment is a step of a drill template: the target text, its translation,
+// or a gap of silence.
+type Segment struct {
+	// Kind is DRILL_TARGET or DRILL_TRANSLATION, empty for a gap.
+	Kind string
+	Gap  time.Duration
+}
+
+// ParseTemplate parses a drill template, its segments separated by arrows or
+// commas, e.g. "translation → 1s → target → 3s gap → target".
+func ParseTemplate(s string) ([]Segment, error) {
+	var segments []Segment
+	for _, part := range templateSeparators.Split(strings.TrimSpace(s), -1) {
+		switch fields := strings.Fields(strings.ToLower(part)); {
+		case len(fields) == 0:
+			return nil, fmt.Errorf("empty segment in template %q", s)
+		case len(fields) == 1 && (fields[0] == DRILL_TARGET || fields[0] == DRILL_TRANSLATION):
+			segments = append(segments, Segment{Kind: fields[0]})
+		default:
+			// "3s gap" reads better than a bare "3s"; both are gaps.
+			if len(fields) > 2 || len(fields) == 2 && fields[1] != "gap" && fields[1] != "silence" {
+				return nil, fmt.Errorf("invalid segment %q in template %q", part, s)
+			}
+			d, err := time.ParseDuration(fields[0])
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid segment %q in template %q: want target, translation or a duration", part, s)
+			}
+			segments = append(segments, Segment{Gap: d})
+		}
+	}
+	return segments, nil
+}
+
+// DrillItem is a line of a drill list: a text to learn and, optionally, its
+// translation.
+type DrillItem struct {
+	Text        string
+	Translation string
+}
+
+// ReadDrillList reads a drill list: one item per line, the text and its
+// translation separated by a tab. Blank lines and lines starting with # are
+// skipped.
+func ReadDrillList(r io.Reader) ([]DrillItem, error) {
+	var items []DrillItem
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		text, translation, _ := strings.Cut(line, "\t")
+		items = append(items, DrillItem{Text: strings.TrimSpace(text), Translation: strings.TrimSpace(translation)})
+	}
+	return items, sc.Err()
+}
+
+// Chapter is where an item of a drill track starts.
+type Chapter struct {
+	Title string
+	Start time.Duration
+}
+
+// CUE writes a cue sheet of the drill track in audio, one track per chapter.
+func CUE(w io.Writer, title, audio string, chapters []Chapter) error {
+	bw := bufio.NewWriter(w)
+	fileType := "WAVE"
+	if strings.EqualFold(filepath.Ext(audio), ".mp3") {
+		fileType = "MP3"
+	}
+	fmt.Fprintf(bw, "TITLE %s\n", cueString(title))
+	fmt.Fprintf(bw, "FILE %s %s\n", cueString(filepath.Base(audio)), fileType)
+	for i, c := range chapters {
+		fmt.Fprintf(bw, "  TRACK %02d AUDIO\n", i+1)
+		fmt.Fprintf(bw, "    TITLE %s\n", cueString(c.Title))
+		fmt.Fprintf(bw, "    INDEX 01 %s\n", cueTime(c.Start))
+	}
+	return bw.Flush()
+}
+
+// cueString quotes s for a cue sheet, which has no escapes.
+func cueString(s string) string {
+	return `"` + strings.ReplaceAll(strings.Join(strings.Fields(s), " "), `"`, "'") + `"`
+}
+
+// cueTime formats d as the mm:ss:ff of cue sheets, ff counting the 75 frames
+// of a second.
+func cueTime(d time.Duration) string {
+	frames := d.Milliseconds() * 75 / 1000
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
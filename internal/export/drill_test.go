@@ -0,0 +1,49 @@
+package export
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTemplate(t *testing.T) {
+	got, err := ParseTemplate("translation → 1s → target -> 3s gap, target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{{Kind: DRILL_TRANSLATION}, {Gap: time.Second}, {Kind: DRILL_TARGET}, {Gap: 3 * time.Second}, {Kind: DRILL_TARGET}}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseTemplate = %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"target → → target", "target → soon", "target → -1s", "3s pause"} {
+		if _, err := ParseTemplate(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestReadDrillList(t *testing.T) {
+	items, err := ReadDrillList(strings.NewReader("# lesson 3\nBonjour\thello\n\n  Merci beaucoup \t thank you \nAu revoir\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DrillItem{{"Bonjour", "hello"}, {"Merci beaucoup", "thank you"}, {"Au revoir", ""}}
+	if !slices.Equal(items, want) {
+		t.Errorf("ReadDrillList = %+v, want %+v", items, want)
+	}
+}
+
+func TestCUE(t *testing.T) {
+	var b strings.Builder
+	chapters := []Chapter{{"Bonjour — hello", 0}, {`Il a dit "oui"`, 61*time.Second + 500*time.Millisecond}}
+	if err := CUE(&b, "lesson3", "/tmp/out/lesson3.mp3", chapters); err != nil {
+		t.Fatalf("CUE failed: %v", err)
+	}
+	want := "TITLE \"lesson3\"\nFILE \"lesson3.mp3\" MP3\n" +
+		"  TRACK 01 AUDIO\n    TITLE \"Bonjour — hello\"\n    INDEX 01 00:00:00\n" +
+		"  TRACK 02 AUDIO\n    TITLE \"Il a dit 'oui'\"\n    INDEX 01 01:01:37\n"
+	if b.String() != want {
+		t.Errorf("CUE wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
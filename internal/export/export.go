@@ -0,0 +1,77 @@
+// Package export writes readings in the formats of study tools: Anki notes,
+// M3U playlists and the cue sheets of drill tracks.
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Item is one reading to export.
+type Item struct {
+	Text string
+	Note string
+	Tags []string
+	// Audio is the file or URL of the audio. Anki notes refer to its base
+	// name, which must be in the media folder of the collection.
+	Audio    string
+	Duration time.Duration
+}
+
+// Anki writes items as an Anki text import of Basic notes: the text and its
+// audio on the front, the note on the back, and the tags.
+func Anki(w io.Writer, deck string, items []Item) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#separator:tab")
+	fmt.Fprintln(bw, "#html:true")
+	fmt.Fprintln(bw, "#notetype:Basic")
+	if deck != "" {
+		fmt.Fprintf(bw, "#deck:%s\n", deck)
+	}
+	fmt.Fprintln(bw, "#tags column:3")
+	for _, it := range items {
+		front := ankiField(it.Text)
+		if it.Audio != "" {
+			front += fmt.Sprintf("<br>[sound:%s]", filepath.Base(it.Audio))
+		}
+		tags := make([]string, len(it.Tags))
+		for i, t := range it.Tags {
+			// Anki tags are separated by spaces.
+			tags[i] = strings.Join(strings.Fields(t), "_")
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", front, ankiField(it.Note), strings.Join(tags, " "))
+	}
+	return bw.Flush()
+}
+
+// ankiField escapes s for an HTML field of a tab separated line.
+func ankiField(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\t", " ")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// M3U writes items as an extended M3U playlist titled title.
+func M3U(w io.Writer, title string, items []Item) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if title != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(title))
+	}
+	for _, it := range items {
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", int(math.Ceil(it.Duration.Seconds())), oneLine(it.Text))
+		fmt.Fprintln(bw, it.Audio)
+	}
+	return bw.Flush()
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var items = []Item{
+	{Text: "Bonjour <tout>\nle monde", Note: "hello\teveryone", Tags: []string{"lesson3", "small talk"},
+		Audio: "/cache/abc.wav", Duration: 1500 * time.Millisecond},
+	{Text: "Au revoir", Audio: "https://example.com/def.mp3", Duration: 2 * time.Second},
+}
+
+func TestAnki(t *testing.T) {
+	var b strings.Builder
+	if err := Anki(&b, "French::lesson3", items); err != nil {
+		t.Fatalf("Anki failed: %v", err)
+	}
+	want := "#separator:tab\n#html:true\n#notetype:Basic\n#deck:French::lesson3\n#tags column:3\n" +
+		"Bonjour &lt;tout&gt;<br>le monde<br>[sound:abc.wav]\thello everyone\tlesson3 small_talk\n" +
+		"Au revoir<br>[sound:def.mp3]\t\t\n"
+	if b.String() != want {
+		t.Errorf("Anki wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestM3U(t *testing.T) {
+	var b strings.Builder
+	if err := M3U(&b, "lesson3", items); err != nil {
+		t.Fatalf("M3U failed: %v", err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:lesson3\n" +
+		"#EXTINF:2,Bonjour <tout> le monde\n/cache/abc.wav\n" +
+		"#EXTINF:2,Au revoir\nhttps://example.com/def.mp3\n"
+	if b.String() != want {
+		t.Errorf("M3U wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,169 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	ITUNES_NAMESPACE = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	ATOM_NAMESPACE   = "http://www.w3.org/2005/Atom"
+	GENERATOR        = "tts-reader"
+)
+
+// Channel describes the podcast as a whole.
+type Channel struct {
+	Title       string
+	Link        string
+	Description string
+	Language    string
+	Author      string
+	Image       string
+	Category    string
+	// SelfURL is the public URL of the feed itself, if it is published.
+	SelfURL string
+}
+
+// Item is one episode of the podcast.
+type Item struct {
+	Title       string
+	Description string
+	GUID        string
+	URL         string
+	MIMEType    string
+	Size        int64
+	Duration    time.Duration
+	Published   time.Time
+}
+
+type rss struct {
+	XMLName  xml.Name   `xml:"rss"`
+	Version  string     `xml:"version,attr"`
+	ITunesNS string     `xml:"xmlns:itunes,attr"`
+	AtomNS   string     `xml:"xmlns:atom,attr"`
+	Channel  rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title          string           `xml:"title"`
+	Link           string           `xml:"link"`
+	Description    string           `xml:"description"`
+	Language       string           `xml:"language,omitempty"`
+	Generator      string           `xml:"generator"`
+	LastBuildDate  string           `xml:"lastBuildDate"`
+	AtomLink       *atomLink        `xml:"atom:link,omitempty"`
+	ITunesAuthor   string           `xml:"itunes:author,omitempty"`
+	ITunesSummary  string           `xml:"itunes:summary"`
+	ITunesExplicit string           `xml:"itunes:explicit"`
+	ITunesImage    *hrefElement     `xml:"itunes:image,omitempty"`
+	ITunesCategory *textAttrElement `xml:"itunes:category,omitempty"`
+	Items          []rssItem        `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type hrefElement struct {
+	Href string `xml:"href,attr"`
+}
+
+type textAttrElement struct {
+	Text string `xml:"text,attr"`
+}
+
+type rssItem struct {
+	Title          string       `xml:"title"`
+	Description    string       `xml:"description"`
+	GUID           rssGUID      `xml:"guid"`
+	PubDate        string       `xml:"pubDate"`
+	Enclosure      rssEnclosure `xml:"enclosure"`
+	ITunesDuration string       `xml:"itunes:duration"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// FormatDuration formats d as the HH:MM:SS value of itunes:duration.
+func FormatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// Render returns the RSS 2.0 document of the channel, with items sorted from
+// the newest to the oldest.
+func Render(ch Channel, items []Item) ([]byte, error) {
+	if ch.Title == "" || ch.Link == "" {
+		return nil, fmt.Errorf("a feed needs a title and a link")
+	}
+	items = slices.Clone(items)
+	slices.SortStableFunc(items, func(a, b Item) int {
+		return b.Published.Compare(a.Published)
+	})
+
+	lastBuild := time.Now()
+	if len(items) > 0 {
+		lastBuild = items[0].Published
+	}
+	doc := rss{
+		Version:  "2.0",
+		ITunesNS: ITUNES_NAMESPACE,
+		AtomNS:   ATOM_NAMESPACE,
+		Channel: rssChannel{
+			Title:          ch.Title,
+			Link:           ch.Link,
+			Description:    ch.Description,
+			Language:       ch.Language,
+			Generator:      GENERATOR,
+			LastBuildDate:  lastBuild.Format(time.RFC1123Z),
+			ITunesAuthor:   ch.Author,
+			ITunesSummary:  ch.Description,
+			ITunesExplicit: "false",
+		},
+	}
+	if ch.SelfURL != "" {
+		doc.Channel.AtomLink = &atomLink{Href: ch.SelfURL, Rel: "self", Type: "application/rss+xml"}
+	}
+	if ch.Image != "" {
+		doc.Channel.ITunesImage = &hrefElement{Href: ch.Image}
+	}
+	if ch.Category != "" {
+		doc.Channel.ITunesCategory = &textAttrElement{Text: ch.Category}
+	}
+
+	for _, it := range items {
+		if it.URL == "" {
+			return nil, fmt.Errorf("item %q has no enclosure URL", it.Title)
+		}
+		guid := it.GUID
+		if guid == "" {
+			guid = it.URL
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:          it.Title,
+			Description:    it.Description,
+			GUID:           rssGUID{Value: guid},
+			PubDate:        it.Published.Format(time.RFC1123Z),
+			Enclosure:      rssEnclosure{URL: it.URL, Length: it.Size, Type: it.MIMEType},
+			ITunesDuration: FormatDuration(it.Duration),
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
@@ -0,0 +1,54 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	if got := FormatDuration(3725*time.Second + 400*time.Millisecond); got != "01:02:05" {
+		t.Errorf("FormatDuration = %s, want 01:02:05", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	ch := Channel{Title: "French A1", Link: "https://example.com", Description: "Lessons", Language: "fr-FR"}
+	older := Item{Title: "one", URL: "https://example.com/a.mp3", MIMEType: "audio/mpeg", Size: 1024,
+		Duration: 90 * time.Second, Published: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := Item{Title: "two", URL: "https://example.com/b.wav", MIMEType: "audio/wav", Size: 2048,
+		Duration: 5 * time.Second, Published: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)}
+
+	data, err := Render(ch, []Item{older, newer})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		`xmlns:itunes="` + ITUNES_NAMESPACE + `"`,
+		`<enclosure url="https://example.com/b.wav" length="2048" type="audio/wav"></enclosure>`,
+		`<itunes:duration>00:01:30</itunes:duration>`,
+		`<pubDate>Sat, 01 Feb 2025 00:00:00 +0000</pubDate>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in feed:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "<title>two</title>") > strings.Index(out, "<title>one</title>") {
+		t.Error("Expected newest item first")
+	}
+
+	var doc struct {
+		Items []struct {
+			Title string `xml:"title"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil || len(doc.Items) != 2 {
+		t.Errorf("Feed does not parse back: %v, %d items", err, len(doc.Items))
+	}
+
+	if _, err := Render(Channel{Title: "x"}, nil); err == nil {
+		t.Error("Expected error for channel without link")
+	}
+}
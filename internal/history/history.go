@@ -0,0 +1,435 @@
+// Package history is the local log of every reading: an append-only JSONL
+// file, queried offline, next to an index of where each key and each day
+// starts in it.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/utils"
+)
+
+const (
+	LOG_FILE   = "history.jsonl"
+	INDEX_FILE = "history.idx"
+	// DAY_FORMAT keys the day index, in local time.
+	DAY_FORMAT = "2006-01-02"
+)
+
+// Stage is the outcome of one step of a run.
+type Stage struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Queued is set when the stage failed but was queued in the outbox.
+	Queued bool          `json:"queued,omitempty"`
+	Took   time.Duration `json:"took"`
+}
+
+// Entry is one run.
+type Entry struct {
+	Time     time.Time     `json:"time"`
+	Content  string        `json:"content"`
+	Lang     string        `json:"lang"`
+	Voice    string        `json:"voice,omitempty"`
+	Speed    float64       `json:"speed,omitempty"`
+	Md5      string        `json:"md5"`
+	Path     string        `json:"path,omitempty"`
+	URL      string        `json:"url,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Note     string        `json:"note,omitempty"`
+	Stages   []Stage       `json:"stages,omitempty"`
+}
+
+// HasTags reports whether e carries every tag of tags, ignoring case.
+func (e Entry) HasTags(tags []string) bool {
+	return HasTags(e.Tags, tags)
+}
+
+// HasTags reports whether have holds every tag of want, ignoring case.
+func HasTags(have, want []string) bool {
+	for _, w := range want {
+		if !slices.ContainsFunc(have, func(h string) bool { return strings.EqualFold(h, w) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeTags trims tags and drops the empty ones and the repeated ones,
+// ignoring case.
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" && !HasTags(out, []string{t}) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// OK reports whether every stage of the run succeeded or was queued.
+func (e Entry) OK() bool {
+	for _, s := range e.Stages {
+		if !s.OK && !s.Queued {
+			return false
+		}
+	}
+	return true
+}
+
+// Index locates entries in the log without reading all of it.
+type Index struct {
+	// Size is how much of the log the index covers.
+	Size int64 `json:"size"`
+	// Keys holds the offsets of the entries of each md5.
+	Keys map[string][]int64 `json:"keys"`
+	// Days holds the offset of the first entry of each day.
+	Days map[string]int64 `json:"days"`
+}
+
+// Store is the history of a directory.
+type Store struct {
+	dir string
+}
+
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) logPath() string {
+	return filepath.Join(s.dir, LOG_FILE)
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, INDEX_FILE)
+}
+
+// Append adds e to the log and the index.
+func (s *Store) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	unlock, err := cache.Lock(s.dir, LOG_FILE)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ix, err := s.index()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.logPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	ix.add(e, ix.Size)
+	ix.Size += int64(len(line)) + 1
+	return s.saveIndex(ix)
+}
+
+func (ix *Index) add(e Entry, offset int64) {
+	ix.Keys[e.Md5] = append(ix.Keys[e.Md5], offset)
+	day := e.Time.Local().Format(DAY_FORMAT)
+	if _, ok := ix.Days[day]; !ok {
+		ix.Days[day] = offset
+	}
+}
+
+// index loads the index and brings it up to date with the log, which another
+// version may have written to, rebuilding it when the log shrank.
+func (s *Store) index() (*Index, error) {
+	ix := &Index{}
+	if data, err := os.ReadFile(s.indexPath()); err == nil {
+		if json.Unmarshal(data, ix) != nil {
+			ix = &Index{}
+		}
+	}
+	fi, err := os.Stat(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return &Index{Keys: map[string][]int64{}, Days: map[string]int64{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ix.Keys == nil || ix.Days == nil || ix.Size > fi.Size() {
+		ix = &Index{Keys: map[string][]int64{}, Days: map[string]int64{}}
+	}
+	if ix.Size == fi.Size() {
+		return ix, nil
+	}
+	err = s.scan(ix.Size, func(e Entry, offset int64) bool {
+		ix.add(e, offset)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	ix.Size = fi.Size()
+	return ix, nil
+}
+
+func (s *Store) saveIndex(ix *Index) error {
+	data, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.indexPath(), data, 0644)
+}
+
+// scan reads the log from offset, calling fn with each entry until it
+// returns false. Lines that do not parse, such as a torn last line, are
+// skipped.
+func (s *Store) scan(offset int64, fn func(e Entry, offset int64) bool) error {
+	f, err := os.Open(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if json.Unmarshal(line, &e) == nil && !fn(e, offset) {
+				return nil
+			}
+		}
+		offset += int64(len(line))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readAt returns the entry starting at offset.
+func (s *Store) readAt(f *os.File, offset int64) (Entry, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return Entry{}, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return Entry{}, err
+	}
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return Entry{}, fmt.Errorf("history entry at %d: %w", offset, err)
+	}
+	return e, nil
+}
+
+// Query narrows a listing. Zero fields match everything.
+type Query struct {
+	Since time.Time
+	Until time.Time
+	// Lang is a short or full language name.
+	Lang string
+	// Text matches content case-insensitively.
+	Text string
+	// Md5 matches as a prefix.
+	Md5 string
+	// Tags must all be carried by an entry.
+	Tags  []string
+	Limit int
+}
+
+func (q Query) matches(e Entry) bool {
+	return (q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Time.Before(q.Until)) &&
+		(q.Lang == "" || strings.EqualFold(e.Lang, q.Lang) || strings.HasPrefix(strings.ToLower(q.Lang), strings.ToLower(e.Lang)+"-")) &&
+		(q.Text == "" || strings.Contains(strings.ToLower(e.Content), strings.ToLower(q.Text))) &&
+		strings.HasPrefix(e.Md5, q.Md5) &&
+		e.HasTags(q.Tags)
+}
+
+// Query returns the entries matching q, newest first. The index skips the
+// days before q.Since, and serves md5 lookups directly.
+func (s *Store) Query(q Query) ([]Entry, error) {
+	ix, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if q.Md5 != "" {
+		entries, err = s.byKey(ix, q)
+	} else {
+		err = s.scan(s.startOffset(ix, q.Since), func(e Entry, _ int64) bool {
+			if q.matches(e) {
+				entries = append(entries, e)
+			}
+			return true
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int { return b.Time.Compare(a.Time) })
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+// startOffset returns where the entries of since's day, or of the next day
+// with entries, begin.
+func (s *Store) startOffset(ix *Index, since time.Time) int64 {
+	if since.IsZero() {
+		return 0
+	}
+	day := since.Local().Format(DAY_FORMAT)
+	start := int64(-1)
+	for d, offset := range ix.Days {
+		if d >= day && (start < 0 || offset < start) {
+			start = offset
+		}
+	}
+	if start < 0 {
+		return ix.Size
+	}
+	return start
+}
+
+func (s *Store) byKey(ix *Index, q Query) ([]Entry, error) {
+	f, err := os.Open(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	for key, offsets := range ix.Keys {
+		if !strings.HasPrefix(key, q.Md5) {
+			continue
+		}
+		for _, offset := range offsets {
+			e, err := s.readAt(f, offset)
+			if err != nil {
+				return nil, err
+			}
+			if q.matches(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Latest keeps the first entry of each md5 of entries, which are newest
+// first: the one reading of the same audio.
+func Latest(entries []Entry) []Entry {
+	seen := map[string]bool{}
+	var out []Entry
+	for _, e := range entries {
+		if seen[e.Md5] {
+			continue
+		}
+		seen[e.Md5] = true
+		out = append(out, e)
+	}
+	return out
+}
+
+// TagGroup is the entries carrying one tag.
+type TagGroup struct {
+	Tag     string  `json:"tag"`
+	Entries []Entry `json:"entries"`
+}
+
+// GroupByTag groups entries by tag, ignoring case, with the most recently
+// used tag first. An entry is in as many groups as it has tags, entries
+// without tags in none.
+func GroupByTag(entries []Entry) []TagGroup {
+	var groups []TagGroup
+	index := map[string]int{}
+	for _, e := range entries {
+		for _, t := range e.Tags {
+			key := strings.ToLower(t)
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, TagGroup{Tag: t})
+			}
+			groups[i].Entries = append(groups[i].Entries, e)
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b TagGroup) int {
+		return b.Entries[0].Time.Compare(a.Entries[0].Time)
+	})
+	return groups
+}
+
+// Find returns the latest entry of the one key starting with prefix.
+func (s *Store) Find(prefix string) (Entry, error) {
+	if prefix == "" {
+		return Entry{}, fmt.Errorf("no md5 given")
+	}
+	entries, err := s.Query(Query{Md5: prefix})
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, fmt.Errorf("no history entry for %s", prefix)
+	}
+	for _, e := range entries[1:] {
+		if e.Md5 != entries[0].Md5 {
+			return Entry{}, fmt.Errorf("md5 prefix %s matches several entries", prefix)
+		}
+	}
+	return entries[0], nil
+}
+
+// ParseTime parses the bounds of --since and --until: a date, a date and
+// time, or an age such as 36h or 7d before now.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{DAY_FORMAT, "2006-01-02 15:04", time.DateTime, time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a date such as 2025-01-02 or an age such as 36h or 7d", s)
+}
@@ -0,0 +1,168 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func seed(t *testing.T, s *Store) time.Time {
+	base := time.Date(2025, 3, 10, 9, 0, 0, 0, time.Local)
+	for i, e := range []Entry{
+		{Md5: "aaa111", Lang: "fr", Content: "Bonjour le monde", Tags: []string{"lesson3", "greetings"}},
+		{Md5: "bbb222", Lang: "en", Content: "Hello world", Tags: []string{"greetings"}},
+		{Md5: "aaa333", Lang: "fr", Content: "Au revoir", Tags: []string{"Lesson3"}, Stages: []Stage{{Name: "storage.Upload", OK: false, Error: "offline"}}},
+		{Md5: "ccc444", Lang: "pl", Content: "Dzień dobry"},
+	} {
+		e.Time = base.AddDate(0, 0, i)
+		if err := s.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+func TestQuery(t *testing.T) {
+	s := Open(t.TempDir())
+	base := seed(t, s)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"all, newest first", Query{}, []string{"ccc444", "aaa333", "bbb222", "aaa111"}},
+		{"limit", Query{Limit: 2}, []string{"ccc444", "aaa333"}},
+		{"language", Query{Lang: "fr"}, []string{"aaa333", "aaa111"}},
+		{"full language name", Query{Lang: "fr-FR"}, []string{"aaa333", "aaa111"}},
+		{"text", Query{Text: "WORLD"}, []string{"bbb222"}},
+		{"since", Query{Since: base.AddDate(0, 0, 2)}, []string{"ccc444", "aaa333"}},
+		{"since mid-day", Query{Since: base.AddDate(0, 0, 1).Add(time.Hour)}, []string{"ccc444", "aaa333"}},
+		{"until", Query{Until: base.AddDate(0, 0, 1)}, []string{"aaa111"}},
+		{"md5 prefix", Query{Md5: "aaa"}, []string{"aaa333", "aaa111"}},
+		{"md5 and since", Query{Md5: "aaa", Since: base.AddDate(0, 0, 1)}, []string{"aaa333"}},
+		{"tag, ignoring case", Query{Tags: []string{"LESSON3"}}, []string{"aaa333", "aaa111"}},
+		{"every tag", Query{Tags: []string{"lesson3", "greetings"}}, []string{"aaa111"}},
+		{"nothing after the last day", Query{Since: base.AddDate(0, 0, 9)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := s.Query(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Md5)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Query = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Query = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	s := Open(t.TempDir())
+	seed(t, s)
+	e, err := s.Find("aaa3")
+	if err != nil || e.Content != "Au revoir" || e.OK() {
+		t.Errorf("Find = %+v, %v", e, err)
+	}
+	if _, err := s.Find("aaa"); err == nil {
+		t.Error("Expected error for an ambiguous prefix")
+	}
+	if _, err := s.Find("zzz"); err == nil {
+		t.Error("Expected error for an unknown md5")
+	}
+}
+
+func TestIndexFollowsTheLog(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(dir)
+	seed(t, s)
+
+	// A torn line and an entry appended without the index are both handled.
+	f, _ := os.OpenFile(filepath.Join(dir, LOG_FILE), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"md5": "torn`)
+	f.WriteString("\n" + `{"time": "2025-04-01T10:00:00Z", "md5": "ddd555", "lang": "jp", "content": "こんにちは"}` + "\n")
+	f.Close()
+	if e, err := s.Find("ddd"); err != nil || e.Lang != "jp" {
+		t.Errorf("Find after an external append = %+v, %v", e, err)
+	}
+
+	// A log replaced by a shorter one makes the index rebuild.
+	os.WriteFile(filepath.Join(dir, LOG_FILE), []byte(`{"time": "2025-05-01T10:00:00Z", "md5": "eee666"}`+"\n"), 0644)
+	entries, err := s.Query(Query{})
+	if err != nil || len(entries) != 1 || entries[0].Md5 != "eee666" {
+		t.Errorf("Query after the log shrank = %+v, %v", entries, err)
+	}
+	if entries, _ := s.Query(Query{Md5: "aaa"}); len(entries) != 0 {
+		t.Errorf("Expected stale index entries to be gone, got %+v", entries)
+	}
+
+	if entries, err := Open(t.TempDir()).Query(Query{}); entries != nil || err != nil {
+		t.Errorf("Expected an empty history, got %v, %v", entries, err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"":                 {},
+		"7d":               now.AddDate(0, 0, -7),
+		"36h":              now.Add(-36 * time.Hour),
+		"2025-01-02":       time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local),
+		"2025-01-02 15:04": time.Date(2025, 1, 2, 15, 4, 0, 0, time.Local),
+	}
+	for in, want := range tests {
+		if got, err := ParseTime(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseTime("last week", now); err == nil {
+		t.Error("Expected error for an invalid time")
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" food", "lesson3", "", "Food", "lesson3 "})
+	if len(got) != 2 || got[0] != "food" || got[1] != "lesson3" {
+		t.Errorf("NormalizeTags = %q, want [food lesson3]", got)
+	}
+}
+
+func TestGroupByTag(t *testing.T) {
+	s := Open(t.TempDir())
+	seed(t, s)
+	// A second reading of the same audio counts once.
+	if err := s.Append(Entry{Md5: "aaa111", Lang: "fr", Content: "Bonjour le monde", Tags: []string{"lesson3"},
+		Time: time.Date(2025, 3, 20, 9, 0, 0, 0, time.Local)}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := GroupByTag(Latest(entries))
+	if len(groups) != 2 || groups[0].Tag != "lesson3" || groups[1].Tag != "greetings" {
+		t.Fatalf("GroupByTag = %+v, want lesson3 then greetings", groups)
+	}
+	var got []string
+	for _, e := range groups[0].Entries {
+		got = append(got, e.Md5)
+	}
+	if len(got) != 2 || got[0] != "aaa111" || got[1] != "aaa333" {
+		t.Errorf("lesson3 holds %v, want [aaa111 aaa333]", got)
+	}
+	if len(groups[1].Entries) != 1 || groups[1].Entries[0].Md5 != "bbb222" {
+		// aaa111 was re-read without the greetings tag.
+		t.Errorf("greetings holds %+v, want bbb222 only", groups[1].Entries)
+	}
+}
@@ -0,0 +1,245 @@
+// Package outbox keeps the work that failed for want of network, such as an
+// upload or a record append, so that it can be replayed later. Each item is a
+// JSON file, written atomically, in the outbox directory.
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// BASE_BACKOFF is the wait before the first retry, doubled by each
+	// failed one up to MAX_BACKOFF.
+	BASE_BACKOFF = 30 * time.Second
+	MAX_BACKOFF  = 6 * time.Hour
+	ITEM_EXT     = ".json"
+)
+
+// ErrPermanent marks failures retrying cannot fix, e.g. a file that was
+// deleted since. Items failing with it are dropped.
+var ErrPermanent = errors.New("permanent failure")
+
+// ErrQueued is returned by the work that failed and was queued in the
+// outbox instead: it did not happen yet, but will be retried.
+var ErrQueued = errors.New("queued in the outbox")
+
+// Item is one piece of queued work.
+type Item struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Created     time.Time       `json:"created"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Handler replays the payload of an item of its kind.
+type Handler func(payload json.RawMessage) error
+
+// Outbox is a directory of items.
+type Outbox struct {
+	dir string
+	now func() time.Time
+}
+
+func New(dir string) *Outbox {
+	return &Outbox{dir: dir, now: time.Now}
+}
+
+func (o *Outbox) Dir() string {
+	return o.dir
+}
+
+func (o *Outbox) path(id string) string {
+	return filepath.Join(o.dir, id+ITEM_EXT)
+}
+
+// Backoff returns the wait after the given number of failed attempts.
+func Backoff(attempts int) time.Duration {
+	d := BASE_BACKOFF
+	for i := 1; i < attempts && d < MAX_BACKOFF; i++ {
+		d *= 2
+	}
+	return min(d, MAX_BACKOFF)
+}
+
+// newID returns an id that sorts by creation time.
+func newID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(b)
+}
+
+// Add queues payload after a first attempt failed with cause.
+func (o *Outbox) Add(kind string, payload any, cause error) (Item, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Item{}, err
+	}
+	now := o.now()
+	it := Item{ID: newID(now), Kind: kind, Payload: data, Created: now, Attempts: 1, NextAttempt: now.Add(Backoff(1))}
+	if cause != nil {
+		it.LastError = cause.Error()
+	}
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return Item{}, err
+	}
+	return it, o.save(it)
+}
+
+func (o *Outbox) save(it Item) error {
+	data, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(o.path(it.ID), data, 0644)
+}
+
+func (o *Outbox) load(id string) (Item, error) {
+	data, err := os.ReadFile(o.path(id))
+	if err != nil {
+		return Item{}, err
+	}
+	var it Item
+	if err := json.Unmarshal(data, &it); err != nil {
+		return Item{}, fmt.Errorf("%s: %w", o.path(id), err)
+	}
+	return it, nil
+}
+
+// List returns the queued items, oldest first. A missing directory is an
+// empty outbox.
+func (o *Outbox) List() ([]Item, error) {
+	entries, err := os.ReadDir(o.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ITEM_EXT)
+		if !ok || strings.HasPrefix(id, ".") {
+			continue
+		}
+		it, err := o.load(id)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // flushed meanwhile
+		}
+		if err != nil {
+			logger.LogWarn("Skipping unreadable outbox item: %v", err)
+			continue
+		}
+		items = append(items, it)
+	}
+	slices.SortFunc(items, func(a, b Item) int { return strings.Compare(a.ID, b.ID) })
+	return items, nil
+}
+
+// Remove drops the item with id. Ids may be shortened to a unique prefix.
+func (o *Outbox) Remove(id string) error {
+	items, err := o.List()
+	if err != nil {
+		return err
+	}
+	var match []Item
+	for _, it := range items {
+		if strings.HasPrefix(it.ID, id) {
+			match = append(match, it)
+		}
+	}
+	switch len(match) {
+	case 0:
+		return fmt.Errorf("no outbox item %s", id)
+	case 1:
+		return os.Remove(o.path(match[0].ID))
+	}
+	return fmt.Errorf("outbox item %s is ambiguous: %d items", id, len(match))
+}
+
+// FlushResult counts what a flush did.
+type FlushResult struct {
+	Sent    int
+	Failed  int
+	Dropped int
+	// Waiting items were not due yet, or being flushed by another process.
+	Waiting int
+}
+
+// Flush replays the due items, or every item with all, through the handler
+// of their kind. Sent and dropped items are removed; failed ones wait longer
+// before the next attempt.
+func (o *Outbox) Flush(handlers map[string]Handler, all bool) (FlushResult, error) {
+	var r FlushResult
+	items, err := o.List()
+	if err != nil {
+		return r, err
+	}
+	for _, it := range items {
+		if !all && o.now().Before(it.NextAttempt) {
+			r.Waiting++
+			continue
+		}
+		unlock, ok, err := cache.TryLock(o.dir, it.ID)
+		if err != nil {
+			return r, err
+		}
+		if !ok {
+			r.Waiting++
+			continue
+		}
+		o.flushItem(it.ID, handlers, &r)
+		unlock()
+	}
+	return r, nil
+}
+
+// flushItem replays one item, holding its lock.
+func (o *Outbox) flushItem(id string, handlers map[string]Handler, r *FlushResult) {
+	// Reload: another process may have flushed it before the lock was taken.
+	it, err := o.load(id)
+	if err != nil {
+		return
+	}
+	handler, ok := handlers[it.Kind]
+	if !ok {
+		logger.LogWarn("No handler for outbox item %s of kind %s", it.ID, it.Kind)
+		r.Failed++
+		return
+	}
+	err = handler(it.Payload)
+	switch {
+	case err == nil:
+		logger.LogInfo("Outbox: sent %s %s after %d attempts", it.Kind, it.ID, it.Attempts+1)
+		os.Remove(o.path(it.ID))
+		r.Sent++
+	case errors.Is(err, ErrPermanent):
+		logger.LogWarn("Outbox: dropping %s %s: %v", it.Kind, it.ID, err)
+		os.Remove(o.path(it.ID))
+		r.Dropped++
+	default:
+		it.Attempts++
+		it.LastError = err.Error()
+		it.NextAttempt = o.now().Add(Backoff(it.Attempts))
+		logger.LogDebug("Outbox: %s %s failed again, next attempt at %s: %v", it.Kind, it.ID, it.NextAttempt.Format(time.DateTime), err)
+		if err := o.save(it); err != nil {
+			logger.LogWarn("Could not update outbox item %s: %v", it.ID, err)
+		}
+		r.Failed++
+	}
+}
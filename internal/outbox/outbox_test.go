@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/cache"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: MAX_BACKOFF} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	o := New(t.TempDir())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	o.now = func() time.Time { return now }
+
+	for _, name := range []string{"ok", "flaky", "gone"} {
+		if _, err := o.Add("test", name, errors.New("offline")); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Millisecond)
+	}
+	o.Add("unknown", 1, nil)
+	var calls []string
+	handlers := map[string]Handler{"test": func(p json.RawMessage) error {
+		var name string
+		json.Unmarshal(p, &name)
+		calls = append(calls, name)
+		switch name {
+		case "flaky":
+			return errors.New("still offline")
+		case "gone":
+			return fmt.Errorf("%w: file removed", ErrPermanent)
+		}
+		return nil
+	}}
+
+	// Nothing is due before the first backoff.
+	if r, err := o.Flush(handlers, false); err != nil || r.Waiting != 4 || len(calls) != 0 {
+		t.Fatalf("Early Flush = %+v, %v, calls %v", r, err, calls)
+	}
+
+	now = now.Add(BASE_BACKOFF)
+	r, err := o.Flush(handlers, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != (FlushResult{Sent: 1, Failed: 2, Dropped: 1}) {
+		t.Errorf("Flush = %+v", r)
+	}
+	items, _ := o.List()
+	if len(items) != 2 || items[0].Kind != "test" || items[1].Kind != "unknown" {
+		t.Fatalf("Expected the flaky and unknown items to stay, got %+v", items)
+	}
+	flaky := items[0]
+	if flaky.Attempts != 2 || flaky.LastError != "still offline" || !flaky.NextAttempt.Equal(now.Add(Backoff(2))) {
+		t.Errorf("Unexpected retry state: %+v", flaky)
+	}
+
+	// --all ignores the backoff, but not the lock of another process.
+	unlock, _, _ := cache.TryLock(o.Dir(), flaky.ID)
+	calls = nil
+	if r, _ := o.Flush(handlers, true); r.Waiting != 1 || len(calls) != 0 {
+		t.Errorf("Expected the locked item to be skipped, got %+v, calls %v", r, calls)
+	}
+	unlock()
+	if r, _ := o.Flush(handlers, true); r.Failed != 2 || len(calls) != 1 {
+		t.Errorf("Flush(all) = %+v, calls %v", r, calls)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	o := New(t.TempDir())
+	a, _ := o.Add("test", "a", nil)
+	o.Add("test", "b", nil)
+	if err := o.Remove(a.ID[:4]); err == nil {
+		t.Error("Expected error for an ambiguous prefix")
+	}
+	if err := o.Remove(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := o.List(); len(items) != 1 {
+		t.Errorf("Expected 1 item left, got %d", len(items))
+	}
+	if err := o.Remove("nope"); err == nil {
+		t.Error("Expected error for an unknown id")
+	}
+	if items, err := New(t.TempDir() + "/missing").List(); items != nil || err != nil {
+		t.Errorf("Expected an empty outbox, got %v, %v", items, err)
+	}
+}
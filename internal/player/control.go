@@ -0,0 +1,237 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"golang.org/x/term"
+)
+
+const (
+	SEEK_STEP          = 5 * time.Second
+	SPEED_STEP         = 0.1
+	MIN_PLAYBACK_SPEED = 0.5
+	MAX_PLAYBACK_SPEED = 2.0
+	PROGRESS_WIDTH     = 30
+	// REFRESH_INTERVAL is how often the progress bar is redrawn.
+	REFRESH_INTERVAL = 100 * time.Millisecond
+)
+
+// CONTROLS_HELP lists the keys of PlayInteractive.
+const CONTROLS_HELP = "space pause · r replay · ←/→ seek · +/- speed · q quit"
+
+// Keys of the controls, as read from a raw terminal.
+const (
+	keyLeft   = "\x1b[D"
+	keyRight  = "\x1b[C"
+	keyCtrlC  = "\x03"
+	keyEscape = "\x1b"
+)
+
+// controller runs a player in the foreground: it tracks where the playback
+// is, and restarts the player to seek or change the speed.
+type controller struct {
+	p        Player
+	file     string
+	duration time.Duration
+	speed    float64
+	// pos is where the playback was when it last started or paused.
+	pos time.Duration
+	// resumed is when it last started or resumed, zero while paused.
+	resumed time.Time
+	pb      *Playback
+	// done gets the end of the current playback.
+	done   chan error
+	status string
+	now    func() time.Time
+}
+
+func newController(p Player, file string, duration time.Duration) *controller {
+	return &controller{p: p, file: file, duration: duration, speed: 1, now: time.Now}
+}
+
+// position returns where the playback is.
+func (c *controller) position() time.Duration {
+	if c.resumed.IsZero() {
+		return c.pos
+	}
+	played := time.Duration(float64(c.now().Sub(c.resumed)) * c.speed)
+	return min(c.pos+played, c.duration)
+}
+
+func (c *controller) paused() bool {
+	return c.pb != nil && c.resumed.IsZero()
+}
+
+// start plays from at, replacing the current player.
+func (c *controller) start(at time.Duration) error {
+	c.stop()
+	at = max(0, min(at, c.duration))
+	pb, err := c.p.Start(c.file, Options{Speed: c.speed, Start: at})
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- pb.Wait() }()
+	c.pb, c.done, c.pos, c.resumed = pb, done, at, c.now()
+	return nil
+}
+
+func (c *controller) stop() {
+	if c.pb == nil {
+		return
+	}
+	c.pb.Stop()
+	<-c.done
+	c.pb, c.done = nil, nil
+}
+
+// handle acts on a key, and reports whether it quits.
+func (c *controller) handle(key string) (quit bool, err error) {
+	c.status = ""
+	switch key {
+	case "q", "Q", keyCtrlC, keyEscape:
+		return true, nil
+	case " ":
+		if c.paused() {
+			if err := c.pb.Resume(); err != nil {
+				return false, err
+			}
+			c.resumed = c.now()
+			return false, nil
+		}
+		c.pos = c.position()
+		if err := c.pb.Pause(); err != nil {
+			return false, err
+		}
+		c.resumed = time.Time{}
+	case "r", "R":
+		return false, c.start(0)
+	case keyLeft:
+		return false, c.seek(-SEEK_STEP)
+	case keyRight:
+		return false, c.seek(SEEK_STEP)
+	case "+", "=":
+		return false, c.setSpeed(c.speed + SPEED_STEP)
+	case "-", "_":
+		return false, c.setSpeed(c.speed - SPEED_STEP)
+	}
+	return false, nil
+}
+
+func (c *controller) seek(d time.Duration) error {
+	wasPaused := c.paused()
+	if err := c.start(c.position() + d); err != nil {
+		return err
+	}
+	if wasPaused {
+		c.resumed = time.Time{}
+		return c.pb.Pause()
+	}
+	return nil
+}
+
+func (c *controller) setSpeed(speed float64) error {
+	if !c.p.Capabilities().Speed {
+		c.status = c.p.Name() + " cannot change the speed"
+		return nil
+	}
+	// The position so far was played at the old speed.
+	if !c.paused() {
+		c.pos, c.resumed = c.position(), c.now()
+	}
+	speed = math.Round(speed*10) / 10
+	c.speed = max(MIN_PLAYBACK_SPEED, min(speed, MAX_PLAYBACK_SPEED))
+	return c.seek(0)
+}
+
+// render returns the status line of the playback.
+func (c *controller) render() string {
+	pos := c.position()
+	filled := 0
+	if c.duration > 0 {
+		filled = int(float64(PROGRESS_WIDTH) * float64(pos) / float64(c.duration))
+	}
+	icon := "▶"
+	if c.paused() {
+		icon = "⏸"
+	}
+	line := fmt.Sprintf("%s [%s%s] %s / %s  %.1fx", icon, strings.Repeat("#", filled),
+		strings.Repeat("-", PROGRESS_WIDTH-filled), formatClock(pos), formatClock(c.duration), c.speed)
+	if c.status != "" {
+		line += "  " + c.status
+	}
+	return line
+}
+
+func formatClock(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// PlayInteractive plays file in the foreground with keyboard controls and a
+// progress bar, until it ends or is quit. Without a terminal on stdin, it
+// only waits for the end.
+func PlayInteractive(file string, out io.Writer) error {
+	mime := audio.MIMEType(file)
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		pb, err := Play(file, Options{})
+		if err != nil {
+			return err
+		}
+		return pb.Wait()
+	}
+	duration, err := audio.FileDuration(file)
+	if err != nil {
+		return err
+	}
+	p, err := Select(config.PlayerOrder(), config.Player, mime, Options{})
+	if err != nil {
+		return err
+	}
+	restore, err := rawInput(fd)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	c := newController(p, file, duration)
+	if err := c.start(0); err != nil {
+		return err
+	}
+	defer c.stop()
+	fmt.Fprintf(out, "%s\n", CONTROLS_HELP)
+	defer fmt.Fprintln(out)
+	for {
+		fmt.Fprintf(out, "\r\x1b[K%s", c.render())
+		select {
+		case err := <-c.done:
+			c.pb, c.done = nil, nil
+			c.pos, c.resumed = c.duration, time.Time{}
+			fmt.Fprintf(out, "\r\x1b[K%s", c.render())
+			return err
+		default:
+		}
+		key, err := readKey(fd, REFRESH_INTERVAL)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			continue
+		}
+		quit, err := c.handle(key)
+		if quit {
+			return nil
+		}
+		if err != nil {
+			c.status = err.Error()
+		}
+	}
+}
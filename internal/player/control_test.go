@@ -0,0 +1,103 @@
+package player
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sleeper is a player that plays nothing for a while, and remembers the
+// options of each start.
+type sleeper struct {
+	speed  bool
+	starts []Options
+}
+
+func (s *sleeper) Name() string { return "sleeper" }
+
+func (s *sleeper) Capabilities() Capabilities { return Capabilities{Speed: s.speed, Seek: true} }
+
+func (s *sleeper) Start(file string, o Options) (*Playback, error) {
+	s.starts = append(s.starts, o)
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Playback{cmd: cmd}, nil
+}
+
+func TestController(t *testing.T) {
+	p := &sleeper{speed: true}
+	clock := time.Unix(0, 0)
+	c := newController(p, "a.wav", 20*time.Second)
+	c.now = func() time.Time { return clock }
+	if err := c.start(0); err != nil {
+		t.Fatal(err)
+	}
+	defer c.stop()
+
+	keys := []struct {
+		key     string
+		elapsed time.Duration
+		pos     time.Duration
+		speed   float64
+		starts  int
+	}{
+		{keyRight, 2 * time.Second, 7 * time.Second, 1, 2},
+		{"+", time.Second, 8 * time.Second, 1.1, 3},
+		{" ", 10 * time.Second, 19 * time.Second, 1.1, 3},
+		// Paused, the position holds and seeking keeps it paused.
+		{keyLeft, 5 * time.Second, 14 * time.Second, 1.1, 4},
+		{" ", time.Second, 14 * time.Second, 1.1, 4},
+		{"r", time.Second, 0, 1.1, 5},
+	}
+	for _, k := range keys {
+		clock = clock.Add(k.elapsed)
+		if quit, err := c.handle(k.key); quit || err != nil {
+			t.Fatalf("handle(%q) = %v, %v", k.key, quit, err)
+		}
+		if c.position() != k.pos || c.speed != k.speed || len(p.starts) != k.starts {
+			t.Errorf("After %q: position %v, speed %v, %d starts; want %v, %v, %d",
+				k.key, c.position(), c.speed, len(p.starts), k.pos, k.speed, k.starts)
+		}
+	}
+	if last := p.starts[len(p.starts)-1]; last.Start != 0 || last.Speed != 1.1 {
+		t.Errorf("Replay started with %+v", last)
+	}
+	if c.paused() {
+		t.Error("Expected the replay to play")
+	}
+
+	clock = clock.Add(time.Minute)
+	if c.position() != c.duration {
+		t.Errorf("Position %v past the end", c.position())
+	}
+	if quit, _ := c.handle("q"); !quit {
+		t.Error("Expected q to quit")
+	}
+}
+
+func TestController_SpeedUnsupported(t *testing.T) {
+	p := &sleeper{}
+	c := newController(p, "a.wav", 10*time.Second)
+	if err := c.start(0); err != nil {
+		t.Fatal(err)
+	}
+	defer c.stop()
+	if _, err := c.handle("-"); err != nil {
+		t.Fatal(err)
+	}
+	if c.speed != 1 || len(p.starts) != 1 || !strings.Contains(c.render(), "cannot change the speed") {
+		t.Errorf("Expected the speed kept and a message, got %q", c.render())
+	}
+}
+
+func TestControllerRender(t *testing.T) {
+	c := newController(&sleeper{}, "a.wav", 80*time.Second)
+	c.pos = 20 * time.Second
+	want := "▶ [#######-----------------------] 0:20 / 1:20  1.0x"
+	if got := c.render(); got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,43 @@
+package player
+
+import (
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// PlayDrill plays files in turn, repeat times over, waiting gap between two
+// plays. It blocks until the last one ends.
+func PlayDrill(files []string, repeat int, gap time.Duration) error {
+	return playDrill(files, repeat, gap, PlayWait)
+}
+
+// PlayWait plays file and blocks until it ends. While the playback queue
+// daemon runs, the file waits for its turn there, and plays at once with
+// --interrupt.
+func PlayWait(file string) error {
+	if it, ok := enqueue(QueueItem{File: file}); ok {
+		return waitQueued(config.PlayerSocket(), it.ID)
+	}
+	pb, err := Play(file, Options{})
+	if err != nil {
+		return err
+	}
+	return pb.Wait()
+}
+
+func playDrill(files []string, repeat int, gap time.Duration, play func(file string) error) error {
+	for round := range repeat {
+		for i, file := range files {
+			if round > 0 || i > 0 {
+				time.Sleep(gap)
+			}
+			logger.LogDebug("Drill %d/%d: %s", round+1, repeat, file)
+			if err := play(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
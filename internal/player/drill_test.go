@@ -0,0 +1,32 @@
+package player
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPlayDrill(t *testing.T) {
+	var played []string
+	play := func(file string) error {
+		played = append(played, file)
+		return nil
+	}
+	if err := playDrill([]string{"0.6", "0.8", "1.0"}, 2, 0, play); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0.6", "0.8", "1.0", "0.6", "0.8", "1.0"}
+	if !slices.Equal(played, want) {
+		t.Errorf("Played %v, want %v", played, want)
+	}
+
+	played = nil
+	fail := errors.New("no player")
+	err := playDrill([]string{"a", "b"}, 3, 0, func(file string) error {
+		played = append(played, file)
+		return fail
+	})
+	if !errors.Is(err, fail) || len(played) != 1 {
+		t.Errorf("Expected the drill to stop at the first error, got %v after %v", err, played)
+	}
+}
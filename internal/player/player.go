@@ -1,12 +1,335 @@
+// Package player plays audio with whichever program the machine has: ffplay,
+// mpv, PipeWire, PulseAudio or ALSA, or a command of the config, picking the
+// first one of the configured order able to play the file.
 package player
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
 	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
 	"github.com/zhasm/tts-reader/pkg/logger"
 )
 
+// Capabilities tell which files and options a player handles.
+type Capabilities struct {
+	// Speed is set when the player can change the playback rate.
+	Speed bool
+	// Formats lists the MIME types it plays, nil for any.
+	Formats []string
+	// Stdin is set when it can read the audio from its standard input.
+	Stdin bool
+	// Seek is set when it can start playing past the beginning. Players
+	// without it start WAV files late from a trimmed copy.
+	Seek bool
+}
+
+// Plays reports whether a player with c can play audio of type mime.
+func (c Capabilities) Plays(mime string) bool {
+	return c.Formats == nil || slices.Contains(c.Formats, mime)
+}
+
+// Options are the settings of one playback.
+type Options struct {
+	// Speed is the playback rate, 0 or 1 for the normal one.
+	Speed float64
+	// Stdin sends the audio on the standard input of the player rather than
+	// naming the file.
+	Stdin bool
+	// Start is where in the audio to start playing.
+	Start time.Duration
+}
+
+func (o Options) changesSpeed() bool {
+	return o.Speed != 0 && o.Speed != 1
+}
+
+// Player plays audio files.
+type Player interface {
+	Name() string
+	Capabilities() Capabilities
+	// Start begins playing file in the background.
+	Start(file string, o Options) (*Playback, error)
+}
+
+// Playback is a running player.
+type Playback struct {
+	cmd   *exec.Cmd
+	stdin io.Closer
+	// temp is a trimmed copy of the audio, removed once played.
+	temp string
+}
+
+// Wait waits for the playback to end.
+func (p *Playback) Wait() error {
+	err := p.cmd.Wait()
+	p.cleanup()
+	return err
+}
+
+func (p *Playback) cleanup() {
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	if p.temp != "" {
+		os.Remove(p.temp)
+	}
+}
+
+// Stop ends the playback.
+func (p *Playback) Stop() error {
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// Seams for tests.
+var lookPath = exec.LookPath
+
+// WAV, FLAC and Ogg are what libsndfile, behind pw-play and paplay, reads.
+var sndfileFormats = []string{"audio/wav", "audio/flac", "audio/ogg"}
+
+// commands are the players known by name.
+var commands = map[string]struct {
+	caps Capabilities
+	args func(file string, o Options) []string
+}{
+	"ffplay": {Capabilities{Speed: true, Stdin: true, Seek: true}, func(file string, o Options) []string {
+		args := []string{"-hide_banner", "-loglevel", "panic", "-nodisp", "-autoexit"}
+		if o.Start > 0 {
+			args = append(args, "-ss", formatSeconds(o.Start))
+		}
+		if o.changesSpeed() {
+			args = append(args, "-af", "atempo="+formatSpeed(o.Speed))
+		}
+		return append(args, stdinAs(file, "pipe:0"))
+	}},
+	"mpv": {Capabilities{Speed: true, Stdin: true, Seek: true}, func(file string, o Options) []string {
+		args := []string{"--no-video", "--really-quiet"}
+		if o.Start > 0 {
+			args = append(args, "--start="+formatSeconds(o.Start))
+		}
+		if o.changesSpeed() {
+			args = append(args, "--speed="+formatSpeed(o.Speed))
+		}
+		return append(args, stdinAs(file, "-"))
+	}},
+	"pw-play": {Capabilities{Formats: sndfileFormats, Stdin: true}, func(file string, o Options) []string {
+		return []string{stdinAs(file, "-")}
+	}},
+	"paplay": {Capabilities{Formats: sndfileFormats, Stdin: true}, func(file string, o Options) []string {
+		if file == "" {
+			return nil
+		}
+		return []string{file}
+	}},
+	"aplay": {Capabilities{Formats: []string{"audio/wav"}, Stdin: true}, func(file string, o Options) []string {
+		args := []string{"-q"}
+		if file != "" {
+			args = append(args, file)
+		}
+		return args
+	}},
+}
+
+// stdinAs returns file, or the name a player reads stdin by when file is
+// empty.
+func stdinAs(file, stdin string) string {
+	if file == "" {
+		return stdin
+	}
+	return file
+}
+
+func formatSpeed(speed float64) string {
+	return strconv.FormatFloat(speed, 'f', -1, 64)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// Command plays audio by running a program.
+type Command struct {
+	name string
+	Path string
+	caps Capabilities
+	args func(file string, o Options) []string
+	// stdinOnly is set for a template without {file}, which can only get the
+	// audio on stdin.
+	stdinOnly bool
+}
+
+func (c Command) Name() string { return c.name }
+
+func (c Command) Capabilities() Capabilities { return c.caps }
+
+// Start runs the program on file, or feeds file to its stdin when o.Stdin
+// is set or the program does not take a file.
+func (c Command) Start(file string, o Options) (*Playback, error) {
+	o.Stdin = o.Stdin || c.stdinOnly
+	if o.Stdin && !c.caps.Stdin {
+		return nil, fmt.Errorf("%s cannot read audio from stdin", c.name)
+	}
+	if !c.caps.Speed {
+		o.Speed = 0
+	}
+	p := &Playback{}
+	if o.Start > 0 && !c.caps.Seek {
+		temp, err := trimWAV(file, o.Start)
+		if err != nil {
+			return nil, fmt.Errorf("%s cannot start past the beginning: %w", c.name, err)
+		}
+		file, p.temp, o.Start = temp, temp, 0
+	}
+	arg := file
+	if o.Stdin {
+		arg = ""
+	}
+	p.cmd = exec.Command(c.Path, c.args(arg, o)...)
+	if o.Stdin {
+		f, err := os.Open(file)
+		if err != nil {
+			p.cleanup()
+			return nil, err
+		}
+		p.cmd.Stdin, p.stdin = f, f
+	}
+	if err := p.cmd.Start(); err != nil {
+		p.cleanup()
+		return nil, fmt.Errorf("starting %s: %w", c.name, err)
+	}
+	return p, nil
+}
+
+// trimWAV writes the WAV file past start to a temporary file.
+func trimWAV(file string, start time.Duration) (string, error) {
+	pcm, err := audio.ReadWAV(file)
+	if err != nil {
+		return "", err
+	}
+	pcm = pcm.From(start)
+	f, err := os.CreateTemp("", "tts-play-*.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(audio.EncodeWAV(pcm)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// New returns the player called name, or an error when it is unknown or not
+// installed.
+func New(name string, c config.PlayerConfig) (Player, error) {
+	if name == config.PLAYER_COMMAND {
+		return newTemplate(c)
+	}
+	known, ok := commands[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown player: %s", name)
+	}
+	path, err := lookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not installed", name)
+	}
+	return Command{name: name, Path: path, caps: known.caps, args: known.args}, nil
+}
+
+// newTemplate returns the command player of the config. Its capabilities
+// follow from the placeholders of its template.
+func newTemplate(c config.PlayerConfig) (Player, error) {
+	fields := strings.Fields(c.Command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("player command is not set")
+	}
+	path, err := lookPath(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("player command %s is not installed", fields[0])
+	}
+	caps := Capabilities{
+		Speed:   strings.Contains(c.Command, "{speed}"),
+		Formats: c.Formats,
+		Stdin:   !strings.Contains(c.Command, "{file}"),
+		Seek:    strings.Contains(c.Command, "{start}"),
+	}
+	args := func(file string, o Options) []string {
+		speed := 1.0
+		if o.changesSpeed() {
+			speed = o.Speed
+		}
+		out := make([]string, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			f = strings.ReplaceAll(f, "{file}", file)
+			f = strings.ReplaceAll(f, "{start}", formatSeconds(o.Start))
+			out = append(out, strings.ReplaceAll(f, "{speed}", formatSpeed(speed)))
+		}
+		return out
+	}
+	return Command{name: filepath.Base(fields[0]), Path: path, caps: caps, args: args, stdinOnly: caps.Stdin}, nil
+}
+
+// Select returns the first player of order able to play audio of type mime
+// with o. A player changing the speed is preferred, but when none is
+// installed the audio plays at the normal speed.
+func Select(order []string, c config.PlayerConfig, mime string, o Options) (Player, error) {
+	var (
+		fallback Player
+		skipped  []string
+	)
+	for _, name := range order {
+		p, err := New(name, c)
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		caps := p.Capabilities()
+		switch {
+		case !caps.Plays(mime):
+			skipped = append(skipped, fmt.Sprintf("%s does not play %s", name, mime))
+		case o.Stdin && !caps.Stdin:
+			skipped = append(skipped, fmt.Sprintf("%s does not read stdin", name))
+		case o.changesSpeed() && !caps.Speed:
+			skipped = append(skipped, fmt.Sprintf("%s does not change the speed", name))
+			if fallback == nil {
+				fallback = p
+			}
+		default:
+			return p, nil
+		}
+	}
+	if fallback != nil {
+		logger.LogWarn("No player changes the speed, %s plays at the normal speed", fallback.Name())
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("no player for %s: %s", mime, strings.Join(skipped, "; "))
+}
+
+// Play starts playing file with the configured players.
+func Play(file string, o Options) (*Playback, error) {
+	mime := audio.MIMEType(file)
+	p, err := Select(config.PlayerOrder(), config.Player, mime, o)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogDebug("Playing %s (%s) with %s", file, mime, p.Name())
+	return p.Start(file, o)
+}
+
 func PlayAudio(req tts.TTSRequest) (bool, error) {
 	file := req.Dest
 	// Check if file exists and is valid
@@ -15,17 +338,45 @@ func PlayAudio(req tts.TTSRequest) (bool, error) {
 		return false, err
 	}
 
-	// Play audio with ffplay command in background
-	logger.LogDebug("Playing audio: %s", file)
-	cmd := exec.Command("ffplay", "-hide_banner", "-loglevel", "panic", "-nodisp", "-autoexit", file)
-
-	// Start the command in background (non-blocking)
-	if err := cmd.Start(); err != nil {
-		logger.LogError("Error starting audio playback: %v", err)
-		logger.LogError("Make sure ffplay is installed and available in PATH")
-		return false, err
+	if config.Wait {
+		if err := PlayInteractive(file, os.Stderr); err != nil {
+			logger.LogError("Error playing audio: %v", err)
+			return false, err
+		}
+	} else if _, queued := enqueue(QueueItem{File: file, Text: req.Content, Lang: req.Lang}); !queued {
+		// Start the player in background (non-blocking)
+		pb, err := Play(file, Options{})
+		if err != nil {
+			logger.LogError("Error starting audio playback: %v", err)
+			logger.LogError("Install one of %s, or set a player command in the config", strings.Join(config.DEFAULT_PLAYER_ORDER, ", "))
+			return false, err
+		}
+		go pb.Wait()
+		logger.LogDebug("Audio playback started in background")
+	}
+	if err := cache.Touch(filepath.Dir(file), req.Md5); err != nil {
+		logger.LogDebug("Could not update the cache index: %v", err)
 	}
-
-	logger.LogDebug("Audio playback started in background")
 	return true, nil
 }
+
+// enqueue hands it to the playback queue daemon, and reports whether it
+// took it.
+func enqueue(it QueueItem) (QueueItem, bool) {
+	file, err := filepath.Abs(it.File)
+	if err != nil {
+		return QueueItem{}, false
+	}
+	it.File = file
+	it, err = Enqueue(config.PlayerSocket(), it, config.Interrupt)
+	if errors.Is(err, ErrNoDaemon) {
+		logger.LogDebug("%v, playing directly", err)
+		return QueueItem{}, false
+	}
+	if err != nil {
+		logger.LogWarn("Playback queue failed, playing directly: %v", err)
+		return QueueItem{}, false
+	}
+	logger.LogDebug("Queued for playback as #%d", it.ID)
+	return it, true
+}
@@ -2,9 +2,15 @@ package player
 
 import (
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/zhasm/tts-reader/internal/audio"
 	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
 )
 
 func TestIsAudioFileValid(t *testing.T) {
@@ -14,8 +20,8 @@ func TestIsAudioFileValid(t *testing.T) {
 	}
 	defer os.Remove(tmpfile.Name())
 
-	// Write enough data to be valid (2000 bytes)
-	if _, err := tmpfile.Write(make([]byte, 2000)); err != nil {
+	// Write a second of WAV audio, as returned by the TTS API
+	if _, err := tmpfile.Write(audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second))); err != nil {
 		t.Fatalf("Failed to write to tmpfile: %v", err)
 	}
 	tmpfile.Close()
@@ -25,6 +31,18 @@ func TestIsAudioFileValid(t *testing.T) {
 		t.Errorf("Expected valid audio file, got valid=%v, err=%v", valid, err)
 	}
 
+	// Test with a large file that is not audio
+	tmpfile3, _ := os.CreateTemp("", "audio-*.mp3")
+	defer os.Remove(tmpfile3.Name())
+	if _, err := tmpfile3.Write(make([]byte, 2000)); err != nil {
+		t.Fatalf("Failed to write to tmpfile3: %v", err)
+	}
+	tmpfile3.Close()
+	valid, err = tts.IsAudioFileValid(tmpfile3.Name())
+	if valid || err == nil {
+		t.Errorf("Expected invalid audio file, got valid=%v, err=%v", valid, err)
+	}
+
 	// Test with too small file
 	tmpfile2, _ := os.CreateTemp("", "audio-*.mp3")
 	defer os.Remove(tmpfile2.Name())
@@ -51,3 +69,126 @@ func TestPlayAudio_NonExistent(t *testing.T) {
 		t.Errorf("Expected error for non-existent file, got ok=%v, err=%v", ok, err)
 	}
 }
+
+// fakePlayers makes lookPath find a script for each of names, which writes
+// its arguments and its stdin to out.
+func fakePlayers(t *testing.T, names ...string) (out string) {
+	dir := t.TempDir()
+	out = filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$@\" > " + out + "\n[ -t 0 ] || cat >> " + out + "\n"
+	paths := map[string]string{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = path
+	}
+	old := lookPath
+	lookPath = func(name string) (string, error) {
+		if path, ok := paths[name]; ok {
+			return path, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() { lookPath = old })
+	return out
+}
+
+func TestSelect(t *testing.T) {
+	fakePlayers(t, "aplay", "mpv", "vlc")
+	template := config.PlayerConfig{Command: "vlc --rate={speed} {file}", Formats: []string{"audio/wav"}}
+	tests := []struct {
+		name  string
+		order []string
+		mime  string
+		o     Options
+		want  string
+	}{
+		{"first installed", []string{"ffplay", "aplay", "mpv"}, "audio/wav", Options{}, "aplay"},
+		{"format", []string{"aplay", "mpv"}, "audio/mpeg", Options{}, "mpv"},
+		{"speed", []string{"aplay", "mpv"}, "audio/wav", Options{Speed: 1.5}, "mpv"},
+		{"normal speed", []string{"aplay", "mpv"}, "audio/wav", Options{Speed: 1}, "aplay"},
+		{"speed fallback", []string{"aplay"}, "audio/wav", Options{Speed: 1.5}, "aplay"},
+		{"template", []string{config.PLAYER_COMMAND, "aplay"}, "audio/wav", Options{Speed: 2}, "vlc"},
+		{"template reads no stdin", []string{config.PLAYER_COMMAND, "aplay"}, "audio/wav", Options{Stdin: true}, "aplay"},
+		{"template formats", []string{config.PLAYER_COMMAND, "mpv"}, "audio/ogg", Options{}, "mpv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Select(tt.order, template, tt.mime, tt.o)
+			if err != nil || p.Name() != tt.want {
+				t.Errorf("Select = %v, %v; want %s", p, err, tt.want)
+			}
+		})
+	}
+
+	_, err := Select([]string{"ffplay", "aplay", "winamp"}, template, "audio/mpeg", Options{})
+	if err == nil || !strings.Contains(err.Error(), "ffplay is not installed") ||
+		!strings.Contains(err.Error(), "aplay does not play audio/mpeg") || !strings.Contains(err.Error(), "unknown player: winamp") {
+		t.Errorf("Expected the reasons each player was skipped, got %v", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	out := fakePlayers(t, "mpv", "aplay", "vlc")
+	file := filepath.Join(t.TempDir(), "a.wav")
+	if err := os.WriteFile(file, []byte("RIFF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		player string
+		c      config.PlayerConfig
+		o      Options
+		want   string
+	}{
+		{"file", "mpv", config.PlayerConfig{}, Options{}, "--no-video --really-quiet " + file + "\n"},
+		{"speed", "mpv", config.PlayerConfig{}, Options{Speed: 0.75}, "--no-video --really-quiet --speed=0.75 " + file + "\n"},
+		{"start", "mpv", config.PlayerConfig{}, Options{Start: 1500 * time.Millisecond}, "--no-video --really-quiet --start=1.500 " + file + "\n"},
+		{"stdin", "aplay", config.PlayerConfig{}, Options{Stdin: true}, "-q\nRIFF"},
+		{"speed ignored", "aplay", config.PlayerConfig{}, Options{Speed: 2}, "-q " + file + "\n"},
+		{"template", config.PLAYER_COMMAND, config.PlayerConfig{Command: "vlc --rate={speed} {file}"}, Options{Speed: 2}, "--rate=2 " + file + "\n"},
+		{"template start", config.PLAYER_COMMAND, config.PlayerConfig{Command: "vlc --start-time={start} {file}"}, Options{Start: 2 * time.Second}, "--start-time=2.000 " + file + "\n"},
+		{"template on stdin", config.PLAYER_COMMAND, config.PlayerConfig{Command: "vlc -"}, Options{Stdin: true}, "-\nRIFF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.player, tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pb, err := p.Start(file, tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pb.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(out); string(got) != tt.want {
+				t.Errorf("Player got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Play asks for no stdin: a template without {file} gets it anyway.
+	old := config.Player
+	defer func() { config.Player = old }()
+	config.Player = config.PlayerConfig{Command: "vlc -"}
+	t.Setenv("TTS_PLAYER", config.PLAYER_COMMAND)
+	pb, err := Play(file, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pb.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "-\nRIFF" {
+		t.Errorf("Player got %q, want the audio on stdin", got)
+	}
+
+	p, _ := New(config.PLAYER_COMMAND, config.PlayerConfig{Command: "vlc {file}"})
+	if _, err := p.Start(file, Options{Stdin: true}); err == nil {
+		t.Error("Expected an error for stdin on a player that names the file")
+	}
+}
@@ -0,0 +1,313 @@
+package player
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// Requests of the playback queue protocol: one JSON request per connection,
+// answered by one JSON response.
+const (
+	QUEUE_PLAY = "play"
+	QUEUE_LS   = "ls"
+	QUEUE_SKIP = "skip"
+	QUEUE_STOP = "stop"
+)
+
+// QUEUE_TIMEOUT bounds a request to the daemon, connection included.
+const QUEUE_TIMEOUT = 2 * time.Second
+
+// queuePoll is how often waitQueued asks the daemon whether an item is done.
+var queuePoll = 100 * time.Millisecond
+
+// ErrNoDaemon is returned by the queue clients when no daemon listens on the
+// socket.
+var ErrNoDaemon = errors.New("playback queue daemon is not running")
+
+// QueueItem is an audio file waiting in the queue, or playing.
+type QueueItem struct {
+	ID     int       `json:"id"`
+	File   string    `json:"file"`
+	Text   string    `json:"text,omitempty"`
+	Lang   string    `json:"lang,omitempty"`
+	Queued time.Time `json:"queued"`
+}
+
+type queueRequest struct {
+	Op   string    `json:"op"`
+	Item QueueItem `json:"item,omitzero"`
+	// Interrupt plays Item right away, stopping the current one.
+	Interrupt bool `json:"interrupt,omitempty"`
+}
+
+type queueResponse struct {
+	Error   string      `json:"error,omitempty"`
+	Item    *QueueItem  `json:"item,omitempty"`
+	Playing *QueueItem  `json:"playing,omitempty"`
+	Items   []QueueItem `json:"items,omitempty"`
+	// Dropped counts the items removed by a stop.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// Queue plays audio files one after the other, so that readings started in
+// a row do not talk over each other.
+type Queue struct {
+	mu      sync.Mutex
+	items   []QueueItem
+	playing *QueueItem
+	pb      *Playback
+	nextID  int
+	wake    chan struct{}
+	// play starts a file, Play with the configured players but for tests.
+	play func(file string) (*Playback, error)
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		wake: make(chan struct{}, 1),
+		play: func(file string) (*Playback, error) { return Play(file, Options{}) },
+	}
+}
+
+// Add queues it, or plays it right away when interrupt is set, and returns it
+// with its id.
+func (q *Queue) Add(it QueueItem, interrupt bool) QueueItem {
+	q.mu.Lock()
+	q.nextID++
+	it.ID, it.Queued = q.nextID, time.Now()
+	if interrupt {
+		q.items = slices.Insert(q.items, 0, it)
+		q.stopPlaying()
+	} else {
+		q.items = append(q.items, it)
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return it
+}
+
+// List returns the item playing, if any, and those waiting.
+func (q *Queue) List() (*QueueItem, []QueueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.playing, slices.Clone(q.items)
+}
+
+// Skip stops the item playing, which the next one follows, and returns it.
+func (q *Queue) Skip() *QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	playing := q.playing
+	q.stopPlaying()
+	return playing
+}
+
+// Stop stops the item playing and empties the queue. It returns the item
+// stopped and how many were dropped.
+func (q *Queue) Stop() (*QueueItem, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	playing, dropped := q.playing, len(q.items)
+	q.items = nil
+	q.stopPlaying()
+	return playing, dropped
+}
+
+func (q *Queue) stopPlaying() {
+	if q.pb != nil {
+		if err := q.pb.Stop(); err != nil {
+			logger.LogWarn("Could not stop the player: %v", err)
+		}
+	}
+}
+
+// Run plays the queued items until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		it := q.items[0]
+		q.items = q.items[1:]
+		// Starting under the lock keeps a skip from missing the player.
+		pb, err := q.play(it.File)
+		if err != nil {
+			q.mu.Unlock()
+			logger.LogError("Could not play %s: %v", it.File, err)
+			continue
+		}
+		q.playing, q.pb = &it, pb
+		q.mu.Unlock()
+		logger.LogDebug("Playing #%d %s", it.ID, it.File)
+
+		pb.Wait()
+		q.mu.Lock()
+		q.playing, q.pb = nil, nil
+		q.mu.Unlock()
+	}
+}
+
+// Serve answers the requests of the clients accepted on l, until l is
+// closed.
+func (q *Queue) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go q.serveConn(conn)
+	}
+}
+
+func (q *Queue) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(QUEUE_TIMEOUT))
+	var req queueRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		logger.LogWarn("Bad queue request: %v", err)
+		return
+	}
+	resp := q.answer(req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger.LogWarn("Could not answer the %s request: %v", req.Op, err)
+	}
+}
+
+func (q *Queue) answer(req queueRequest) queueResponse {
+	var resp queueResponse
+	switch req.Op {
+	case QUEUE_PLAY:
+		if req.Item.File == "" {
+			resp.Error = "no file to play"
+			break
+		}
+		it := q.Add(req.Item, req.Interrupt)
+		resp.Item = &it
+	case QUEUE_LS:
+		resp.Playing, resp.Items = q.List()
+	case QUEUE_SKIP:
+		resp.Item = q.Skip()
+	case QUEUE_STOP:
+		resp.Item, resp.Dropped = q.Stop()
+	default:
+		resp.Error = fmt.Sprintf("unknown queue request: %q", req.Op)
+	}
+	return resp
+}
+
+// ListenQueue listens on the Unix socket path, readable by the user only. A
+// socket left by a daemon that died is replaced, one in use is an error.
+func ListenQueue(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, QUEUE_TIMEOUT); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a playback queue daemon already listens on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// callQueue sends req to the daemon listening on socket.
+func callQueue(socket string, req queueRequest) (queueResponse, error) {
+	var resp queueResponse
+	conn, err := net.DialTimeout("unix", socket, QUEUE_TIMEOUT)
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrNoDaemon, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(QUEUE_TIMEOUT))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("reading the answer of the queue daemon: %w", err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// Enqueue sends it to the daemon on socket, to play after the queued items or
+// right away when interrupt is set.
+func Enqueue(socket string, it QueueItem, interrupt bool) (QueueItem, error) {
+	resp, err := callQueue(socket, queueRequest{Op: QUEUE_PLAY, Item: it, Interrupt: interrupt})
+	if err != nil {
+		return QueueItem{}, err
+	}
+	return *resp.Item, nil
+}
+
+// waitQueued blocks until the daemon on socket is done with the item id,
+// played or dropped.
+func waitQueued(socket string, id int) error {
+	for {
+		playing, items, err := ListQueue(socket)
+		if errors.Is(err, ErrNoDaemon) {
+			// The daemon stopped, and the item with it.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if (playing == nil || playing.ID != id) && !slices.ContainsFunc(items, func(it QueueItem) bool { return it.ID == id }) {
+			return nil
+		}
+		time.Sleep(queuePoll)
+	}
+}
+
+// ListQueue returns the item the daemon on socket plays and those waiting.
+func ListQueue(socket string) (*QueueItem, []QueueItem, error) {
+	resp, err := callQueue(socket, queueRequest{Op: QUEUE_LS})
+	return resp.Playing, resp.Items, err
+}
+
+// SkipQueue skips the item the daemon on socket plays, and returns it.
+func SkipQueue(socket string) (*QueueItem, error) {
+	resp, err := callQueue(socket, queueRequest{Op: QUEUE_SKIP})
+	return resp.Item, err
+}
+
+// StopQueue stops the daemon on socket playing and empties its queue.
+func StopQueue(socket string) (*QueueItem, int, error) {
+	resp, err := callQueue(socket, queueRequest{Op: QUEUE_STOP})
+	return resp.Item, resp.Dropped, err
+}
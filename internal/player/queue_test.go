@@ -0,0 +1,134 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startQueue serves a queue whose player sleeps, and returns its socket and
+// the files played in order.
+func startQueue(t *testing.T) (socket string, played func() []string) {
+	socket = filepath.Join(t.TempDir(), "q.sock")
+	l, err := ListenQueue(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		files []string
+	)
+	q := NewQueue()
+	q.play = func(file string) (*Playback, error) {
+		mu.Lock()
+		files = append(files, file)
+		mu.Unlock()
+		cmd := exec.Command("sleep", "10")
+		return &Playback{cmd: cmd}, cmd.Start()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+	go q.Serve(l)
+	t.Cleanup(func() {
+		q.Stop()
+		cancel()
+		l.Close()
+	})
+	return socket, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), files...)
+	}
+}
+
+// waitPlaying waits for the daemon on socket to play the item with id.
+func waitPlaying(t *testing.T, socket string, id int) []QueueItem {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		playing, items, err := ListQueue(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if playing != nil && playing.ID == id {
+			return items
+		}
+	}
+	t.Fatalf("#%d is not playing", id)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	socket, played := startQueue(t)
+	for _, file := range []string{"/a.wav", "/b.wav", "/c.wav"} {
+		if _, err := Enqueue(socket, QueueItem{File: file, Text: file}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items := waitPlaying(t, socket, 1); len(items) != 2 || items[0].File != "/b.wav" {
+		t.Errorf("Queued %+v, want b and c", items)
+	}
+
+	skipped, err := SkipQueue(socket)
+	if err != nil || skipped == nil || skipped.ID != 1 {
+		t.Fatalf("SkipQueue = %+v, %v", skipped, err)
+	}
+	waitPlaying(t, socket, 2)
+
+	it, err := Enqueue(socket, QueueItem{File: "/now.wav"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := waitPlaying(t, socket, it.ID); len(items) != 1 || items[0].File != "/c.wav" {
+		t.Errorf("Queued %+v after the interruption, want c", items)
+	}
+
+	stopped, dropped, err := StopQueue(socket)
+	if err != nil || stopped == nil || stopped.ID != it.ID || dropped != 1 {
+		t.Errorf("StopQueue = %+v, %d, %v", stopped, dropped, err)
+	}
+	want := []string{"/a.wav", "/b.wav", "/now.wav"}
+	if got := played(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Played %v, want %v", got, want)
+	}
+
+	if _, err := Enqueue(socket, QueueItem{}, false); err == nil {
+		t.Error("Expected an error for an item without a file")
+	}
+	if _, err := ListenQueue(socket); err == nil {
+		t.Error("Expected an error listening on a socket in use")
+	}
+}
+
+func TestQueue_NoDaemon(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "q.sock")
+	if _, err := Enqueue(socket, QueueItem{File: "/a.wav"}, false); !errors.Is(err, ErrNoDaemon) {
+		t.Errorf("Enqueue = %v, want ErrNoDaemon", err)
+	}
+}
+
+func TestWaitQueued(t *testing.T) {
+	queuePoll = time.Millisecond
+	socket, _ := startQueue(t)
+	it, err := Enqueue(socket, QueueItem{File: "/a.wav"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- waitQueued(socket, it.ID) }()
+	waitPlaying(t, socket, it.ID)
+	select {
+	case err := <-done:
+		t.Fatalf("waitQueued returned while playing: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if _, err := SkipQueue(socket); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("waitQueued = %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package player
+
+import (
+	"errors"
+	"time"
+)
+
+var errNoControls = errors.New("playback controls need a Unix terminal")
+
+func (p *Playback) Pause() error { return errNoControls }
+
+func (p *Playback) Resume() error { return errNoControls }
+
+func rawInput(fd int) (restore func(), err error) { return nil, errNoControls }
+
+func readKey(fd int, timeout time.Duration) (string, error) { return "", errNoControls }
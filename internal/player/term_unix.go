@@ -0,0 +1,63 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package player
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Pause suspends the player.
+func (p *Playback) Pause() error {
+	return p.cmd.Process.Signal(syscall.SIGSTOP)
+}
+
+// Resume continues a paused player.
+func (p *Playback) Resume() error {
+	return p.cmd.Process.Signal(syscall.SIGCONT)
+}
+
+// rawInput puts the terminal of fd in raw mode to read single keys. Output
+// processing is kept, so that log lines printed meanwhile still start at the
+// margin.
+func rawInput(fd int) (restore func(), err error) {
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	restore = func() { term.Restore(fd, state) }
+	t, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err == nil {
+		t.Oflag |= unix.OPOST | unix.ONLCR
+		err = unix.IoctlSetTermios(fd, ioctlWriteTermios, t)
+	}
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+// readKey returns the next key pressed on fd, with the escape sequences of
+// the arrow keys whole, or "" when none is within timeout.
+func readKey(fd int, timeout time.Duration) (string, error) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	if errors.Is(err, unix.EINTR) || n == 0 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 8)
+	n, err = unix.Read(fd, buf)
+	if err != nil {
+		return "", os.NewSyscallError("read", err)
+	}
+	return string(buf[:n]), nil
+}
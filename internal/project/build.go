@@ -0,0 +1,346 @@
+package project
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MANIFEST_FILE = ".tts-build.json"
+
+	// fingerprintVersion is bumped whenever the way outputs are built changes,
+	// so that every output becomes stale once.
+	fingerprintVersion = "tts-build/1"
+)
+
+// Result describes a built output. Md5 is the hash of the output file, which
+// the manifest records; Key is the cache key of Content read by the target's
+// voice, under which the output is published like any other synthesized text.
+type Result struct {
+	Target   Target
+	Content  string
+	Md5      string
+	Key      string
+	Size     int64
+	Duration time.Duration
+}
+
+// ManifestEntry records how an output was last built.
+type ManifestEntry struct {
+	Source      string        `json:"source"`
+	Lesson      string        `json:"lesson"`
+	Lang        string        `json:"lang"`
+	Fingerprint string        `json:"fingerprint"`
+	Md5         string        `json:"md5"`
+	Size        int64         `json:"size"`
+	Duration    time.Duration `json:"duration"`
+	Built       time.Time     `json:"built"`
+}
+
+// Manifest maps output paths, relative to the output directory, to the
+// fingerprint of the inputs they were built from.
+type Manifest struct {
+	Entries map[string]ManifestEntry `json:"entries"`
+
+	dir string
+	mu  sync.Mutex
+}
+
+// LoadManifest reads the manifest in dir. A missing manifest is empty.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Entries: map[string]ManifestEntry{}, dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, MANIFEST_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", MANIFEST_FILE, err)
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// Save writes the manifest back to its directory.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(m.dir, MANIFEST_FILE), data, 0644)
+}
+
+// Stale reports whether t needs to be rebuilt, i.e. its output is missing or
+// any of its inputs changed since the last build.
+func (m *Manifest) Stale(t Target) (bool, error) {
+	fp, err := Fingerprint(t)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(t.Output); err != nil {
+		return true, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Entries[m.rel(t.Output)].Fingerprint != fp, nil
+}
+
+// Record stores the fingerprint of a freshly built output.
+func (m *Manifest) Record(r Result) error {
+	fp, err := Fingerprint(r.Target)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[m.rel(r.Target.Output)] = ManifestEntry{
+		Source:      r.Target.Source,
+		Lesson:      r.Target.Lesson,
+		Lang:        r.Target.Lang.Name,
+		Fingerprint: fp,
+		Md5:         r.Md5,
+		Size:        r.Size,
+		Duration:    r.Duration,
+		Built:       time.Now(),
+	}
+	return nil
+}
+
+func (m *Manifest) rel(output string) string {
+	if rel, err := filepath.Rel(m.dir, output); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return output
+}
+
+// Fingerprint hashes every input that affects the audio of t: the source
+// text, the lexicon, the language config and voice, speed, gap and format.
+func Fingerprint(t Target) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", fingerprintVersion)
+
+	src, err := os.ReadFile(t.Source)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "source %d\n", len(src))
+	h.Write(src)
+
+	if t.Lexicon != "" {
+		lex, err := os.ReadFile(t.Lexicon)
+		if err != nil {
+			return "", fmt.Errorf("error reading lexicon: %w", err)
+		}
+		fmt.Fprintf(h, "lexicon %d\n", len(lex))
+		h.Write(lex)
+	}
+
+	lang, err := yaml.Marshal(t.Lang)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "lang %d\n", len(lang))
+	h.Write(lang)
+	fmt.Fprintf(h, "speed %g\ngap %s\nformat %s\n", t.Speed, t.Gap, strings.ToLower(filepath.Ext(t.Output)))
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// LoadLexicon reads a YAML map of spellings to the replacements that should
+// be sent to the synthesizer instead.
+func LoadLexicon(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lex := map[string]string{}
+	if err := yaml.Unmarshal(data, &lex); err != nil {
+		return nil, fmt.Errorf("error parsing lexicon %s: %w", path, err)
+	}
+	return lex, nil
+}
+
+// ApplyLexicon replaces every lexicon entry in text, longest entries first so
+// that overlapping spellings resolve deterministically.
+func ApplyLexicon(text string, lex map[string]string) string {
+	keys := make([]string, 0, len(lex))
+	for k := range lex {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, lex[k])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Phrases splits a source text into the phrases that are synthesized one by
+// one: every non-empty line that is not a # comment.
+func Phrases(text string) []string {
+	var phrases []string
+	for line := range strings.Lines(text) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, line)
+	}
+	return phrases
+}
+
+// BuildTarget synthesizes every phrase of t through the TTS cache and joins
+// them, separated by t.Gap, into t.Output.
+func BuildTarget(t Target) (Result, error) {
+	src, err := os.ReadFile(t.Source)
+	if err != nil {
+		return Result{}, err
+	}
+	lex, err := LoadLexicon(t.Lexicon)
+	if err != nil {
+		return Result{}, err
+	}
+	phrases := Phrases(string(src))
+	if len(phrases) == 0 {
+		return Result{}, fmt.Errorf("%s has no phrases", t.Source)
+	}
+
+	var parts []audio.PCM
+	for i, phrase := range phrases {
+		req := tts.NewTTSRequest(ApplyLexicon(phrase, lex), t.Lang.NameFUll, t.Lang.Reader, t.Speed)
+		ok, err := tts.Synthesize(req)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: phrase %d: TTS request failed: %w", t.Source, i+1, err)
+		}
+		if !ok {
+			return Result{}, fmt.Errorf("%s: phrase %d: TTS request failed", t.Source, i+1)
+		}
+		pcm, err := audio.ReadWAV(req.Dest)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: phrase %d: %w", t.Source, i+1, err)
+		}
+		if i > 0 {
+			parts = append(parts, audio.Silence(pcm.Format, t.Gap))
+		}
+		parts = append(parts, pcm)
+	}
+	track, err := audio.Concat(parts...)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", t.Source, err)
+	}
+	if err := audio.Save(t.Output, track); err != nil {
+		return Result{}, err
+	}
+
+	data, err := os.ReadFile(t.Output)
+	if err != nil {
+		return Result{}, err
+	}
+	content := strings.Join(phrases, "\n")
+	return Result{
+		Target:   t,
+		Content:  content,
+		Md5:      fmt.Sprintf("%x", md5.Sum(data)),
+		Key:      tts.NewTTSRequest(content, t.Lang.NameFUll, t.Lang.Reader, t.Speed).Md5,
+		Size:     int64(len(data)),
+		Duration: track.Duration(),
+	}, nil
+}
+
+// Build rebuilds the stale targets with up to jobs workers in parallel and
+// records them in the manifest. With force, every target is rebuilt. The
+// results of the successful builds are returned along with the joined errors
+// of the failed ones.
+func Build(m *Manifest, targets []Target, jobs int, force bool) ([]Result, error) {
+	var stale []Target
+	for _, t := range targets {
+		isStale, err := m.Stale(t)
+		if err != nil {
+			return nil, err
+		}
+		if force || isStale {
+			stale = append(stale, t)
+		} else {
+			logger.LogDebug("Up to date: %s", t.Output)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []Result
+		errs    []error
+	)
+	queue := make(chan Target)
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				start := time.Now()
+				r, err := BuildTarget(t)
+				if err == nil {
+					err = m.Record(r)
+				}
+				mu.Lock()
+				if err != nil {
+					logger.LogWarn("Building %s failed: %v", t.Output, err)
+					errs = append(errs, err)
+				} else {
+					logger.LogInfo("Built %s, took %.3f(s)", t.Output, time.Since(start).Seconds())
+					results = append(results, r)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, t := range stale {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := m.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	slices.SortFunc(results, func(a, b Result) int {
+		return strings.Compare(a.Target.Output, b.Target.Output)
+	})
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,210 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DEFAULT_PROJECT_FILE = "tts-project.yml"
+	DEFAULT_OUTPUT_DIR   = "build"
+	DEFAULT_NAMING       = "{lesson}/{name}.wav"
+	DEFAULT_GAP          = 800 * time.Millisecond
+)
+
+// Settings are the synthesis options shared by the project defaults and each
+// lesson. Zero values inherit from the level above.
+type Settings struct {
+	Lang   string        `yaml:"lang"`
+	Voice  string        `yaml:"voice"`
+	Speed  float64       `yaml:"speed"`
+	Gap    time.Duration `yaml:"gap"`
+	Naming string        `yaml:"naming"`
+}
+
+// Lesson groups source files that are built with the same settings.
+type Lesson struct {
+	Name     string   `yaml:"name"`
+	Sources  []string `yaml:"sources"`
+	Lexicon  string   `yaml:"lexicon"`
+	Settings `yaml:",inline"`
+}
+
+// Project is the content of a tts-project.yml file.
+type Project struct {
+	Name     string   `yaml:"name"`
+	Output   string   `yaml:"output"`
+	Lexicon  string   `yaml:"lexicon"`
+	Defaults Settings `yaml:"defaults"`
+	Lessons  []Lesson `yaml:"lessons"`
+
+	// Path is the project file the project was loaded from.
+	Path string `yaml:"-"`
+}
+
+// Target is one output file together with everything needed to build it.
+type Target struct {
+	Lesson  string
+	Index   int
+	Source  string
+	Lexicon string
+	Output  string
+	Lang    config.Lang
+	Speed   float64
+	Gap     time.Duration
+}
+
+// Load reads and validates a project file.
+func Load(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing project file %s: %w", path, err)
+	}
+	if len(p.Lessons) == 0 {
+		return nil, fmt.Errorf("project file %s has no lessons", path)
+	}
+	for i, l := range p.Lessons {
+		if l.Name == "" {
+			return nil, fmt.Errorf("lesson %d in %s has no name", i+1, path)
+		}
+		if len(l.Sources) == 0 {
+			return nil, fmt.Errorf("lesson %s in %s has no sources", l.Name, path)
+		}
+	}
+	p.Path = path
+	return &p, nil
+}
+
+// Dir returns the directory relative paths in the project are resolved from.
+func (p *Project) Dir() string {
+	return filepath.Dir(p.Path)
+}
+
+// OutputDir returns the absolute directory outputs are written to.
+func (p *Project) OutputDir() string {
+	out := p.Output
+	if out == "" {
+		out = DEFAULT_OUTPUT_DIR
+	}
+	return p.resolve(out)
+}
+
+func (p *Project) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(p.Dir(), path)
+}
+
+// Targets expands the source globs of every lesson into build targets. When
+// lessons is not empty, only the named lessons are expanded.
+func (p *Project) Targets(lessons ...string) ([]Target, error) {
+	var targets []Target
+	seen := map[string]string{}
+	for _, l := range p.Lessons {
+		if len(lessons) > 0 && !slices.Contains(lessons, l.Name) {
+			continue
+		}
+		s := p.settings(l)
+		lang, found := config.GetLang(s.Lang)
+		if !found {
+			return nil, fmt.Errorf("lesson %s: language not found: %s", l.Name, s.Lang)
+		}
+		if s.Voice != "" {
+			lang.Reader = s.Voice
+		}
+
+		var sources []string
+		for _, pattern := range l.Sources {
+			matches, err := filepath.Glob(p.resolve(pattern))
+			if err != nil {
+				return nil, fmt.Errorf("lesson %s: bad source pattern %q: %w", l.Name, pattern, err)
+			}
+			sources = append(sources, matches...)
+		}
+		slices.Sort(sources)
+		sources = slices.Compact(sources)
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("lesson %s: no source matches %v", l.Name, l.Sources)
+		}
+
+		lexicon := l.Lexicon
+		if lexicon == "" {
+			lexicon = p.Lexicon
+		}
+		for i, src := range sources {
+			t := Target{
+				Lesson:  l.Name,
+				Index:   i + 1,
+				Source:  src,
+				Lexicon: p.resolve(lexicon),
+				Lang:    lang,
+				Speed:   s.Speed,
+				Gap:     s.Gap,
+			}
+			t.Output = filepath.Join(p.OutputDir(), p.outputName(s.Naming, t))
+			if prev, dup := seen[t.Output]; dup {
+				return nil, fmt.Errorf("output %s is produced by both %s and %s", t.Output, prev, src)
+			}
+			seen[t.Output] = src
+			targets = append(targets, t)
+		}
+	}
+	if len(lessons) > 0 && len(targets) == 0 {
+		return nil, fmt.Errorf("no lesson matches %v", lessons)
+	}
+	return targets, nil
+}
+
+// settings merges the lesson's settings over the project defaults and the
+// command line defaults.
+func (p *Project) settings(l Lesson) Settings {
+	s := Settings{
+		Lang:   config.Language,
+		Speed:  config.Speed,
+		Gap:    DEFAULT_GAP,
+		Naming: DEFAULT_NAMING,
+	}
+	for _, o := range []Settings{p.Defaults, l.Settings} {
+		if o.Lang != "" {
+			s.Lang = o.Lang
+		}
+		if o.Voice != "" {
+			s.Voice = o.Voice
+		}
+		if o.Speed != 0 {
+			s.Speed = o.Speed
+		}
+		if o.Gap != 0 {
+			s.Gap = o.Gap
+		}
+		if o.Naming != "" {
+			s.Naming = o.Naming
+		}
+	}
+	return s
+}
+
+// outputName expands the naming template. Supported placeholders are
+// {project}, {lesson}, {name}, {index} and {lang}.
+func (p *Project) outputName(naming string, t Target) string {
+	name := strings.TrimSuffix(filepath.Base(t.Source), filepath.Ext(t.Source))
+	return strings.NewReplacer(
+		"{project}", p.Name,
+		"{lesson}", t.Lesson,
+		"{name}", name,
+		"{index}", fmt.Sprintf("%02d", t.Index),
+		"{lang}", t.Lang.Name,
+	).Replace(naming)
+}
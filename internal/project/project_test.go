@@ -0,0 +1,144 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+const testProject = `name: French A1
+output: out
+defaults:
+  lang: fr
+  speed: 0.8
+  gap: 500ms
+lessons:
+  - name: lesson1
+    sources: [lesson1/*.txt]
+  - name: lesson2
+    sources: [lesson2/*.txt]
+    lang: pl
+    voice: pl-PL-MarekNeural
+    speed: 0.6
+    naming: "{lang}/{index}-{name}.wav"
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupProject(t *testing.T) *Project {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, DEFAULT_PROJECT_FILE), testProject)
+	writeFile(t, filepath.Join(dir, "lesson1", "greetings.txt"), "Bonjour\n# comment\n\nMerci\n")
+	writeFile(t, filepath.Join(dir, "lesson2", "a.txt"), "Dzień dobry\n")
+	p, err := Load(filepath.Join(dir, DEFAULT_PROJECT_FILE))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return p
+}
+
+// seedCache stores a second of silence as the cached audio of each phrase so
+// that building does not call the TTS API.
+func seedCache(t *testing.T, lang config.Lang, speed float64, phrases ...string) {
+	t.Helper()
+	for _, phrase := range phrases {
+		req := tts.NewTTSRequest(phrase, lang.NameFUll, lang.Reader, speed)
+		// The TTS API returns WAV data even though cache files end in .mp3.
+		writeFile(t, req.Dest, string(audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second))))
+	}
+}
+
+func TestTargets(t *testing.T) {
+	p := setupProject(t)
+	targets, err := p.Targets()
+	if err != nil {
+		t.Fatalf("Targets failed: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+	if want := filepath.Join(p.Dir(), "out", "lesson1", "greetings.wav"); targets[0].Output != want {
+		t.Errorf("Output = %s, want %s", targets[0].Output, want)
+	}
+	if targets[0].Gap != 500*time.Millisecond || targets[0].Speed != 0.8 {
+		t.Errorf("Unexpected inherited settings: %+v", targets[0])
+	}
+	second := targets[1]
+	if want := filepath.Join(p.Dir(), "out", "pl", "01-a.wav"); second.Output != want {
+		t.Errorf("Output = %s, want %s", second.Output, want)
+	}
+	if second.Lang.Name != "pl" || second.Lang.Reader != "pl-PL-MarekNeural" || second.Speed != 0.6 {
+		t.Errorf("Unexpected lesson overrides: %+v", second)
+	}
+
+	if _, err := p.Targets("missing"); err == nil {
+		t.Error("Expected error for unknown lesson")
+	}
+}
+
+func TestApplyLexicon(t *testing.T) {
+	lex := map[string]string{"M.": "Monsieur", "M": "em"}
+	if got := ApplyLexicon("M. Dupont", lex); got != "Monsieur Dupont" {
+		t.Errorf("ApplyLexicon = %q", got)
+	}
+}
+
+func TestBuild_Staleness(t *testing.T) {
+	config.TTS_PATH = t.TempDir()
+	p := setupProject(t)
+	targets, err := p.Targets("lesson1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedCache(t, targets[0].Lang, targets[0].Speed, "Bonjour", "Merci")
+
+	m, err := LoadManifest(p.OutputDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Build(m, targets, 2, false)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Build = %d results, err %v", len(results), err)
+	}
+	if results[0].Duration != 2500*time.Millisecond {
+		t.Errorf("Duration = %v, want 2.5s", results[0].Duration)
+	}
+	// The output is published under the key of its text, not of its bytes.
+	want := tts.NewTTSRequest("Bonjour\nMerci", targets[0].Lang.NameFUll, targets[0].Lang.Reader, targets[0].Speed).Md5
+	if results[0].Key != want {
+		t.Errorf("Key = %q, want %q", results[0].Key, want)
+	}
+
+	// A fresh manifest read from disk sees the output as up to date.
+	m, _ = LoadManifest(p.OutputDir())
+	if stale, _ := m.Stale(targets[0]); stale {
+		t.Error("Expected output to be up to date")
+	}
+
+	// Changing the voice makes it stale again.
+	changed := targets[0]
+	changed.Lang.Reader = "fr-FR-HenriNeural"
+	if stale, _ := m.Stale(changed); !stale {
+		t.Error("Expected output to be stale after a voice change")
+	}
+
+	// So does editing the source.
+	writeFile(t, targets[0].Source, "Bonjour\n")
+	if stale, _ := m.Stale(targets[0]); !stale {
+		t.Error("Expected output to be stale after a source change")
+	}
+}
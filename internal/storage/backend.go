@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// Storage is where published audio lives. Keys are file names such as
+// <md5>.mp3.
+type Storage interface {
+	// Put copies the local file at path to key, replacing what is there.
+	Put(path, key string) error
+	// Stat returns the size of key, -1 when the backend does not tell, or
+	// ErrObjectNotFound.
+	Stat(key string) (int64, error)
+	// Get returns the content of key, or ErrObjectNotFound.
+	Get(key string) ([]byte, error)
+	// PublicURL returns where others can fetch key.
+	PublicURL(key string) string
+	// Delete removes key. Deleting a missing key succeeds.
+	Delete(key string) error
+	List() ([]Object, error)
+}
+
+// ObjectError is an unexpected answer of a storage backend's server.
+type ObjectError struct {
+	StatusCode int
+	msg        string
+}
+
+func (e *ObjectError) Error() string {
+	return e.msg
+}
+
+// isRetryable reports whether an operation failing with err may succeed
+// later unchanged: the network or the server failed, or asked to come back
+// later. Missing settings and refused credentials are not.
+func isRetryable(err error) bool {
+	var oe *ObjectError
+	if errors.As(err, &oe) {
+		code := oe.StatusCode
+		return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// Configured returns the backend chosen in the storage section of the config.
+func Configured() (Storage, error) {
+	backend, err := config.StorageBackend()
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case config.STORAGE_LOCAL:
+		return NewLocalStorage(config.Storage.Dir, PublicBase())
+	case config.STORAGE_WEBDAV:
+		c, err := config.ResolveWebDAV()
+		if err != nil {
+			return nil, err
+		}
+		return NewWebDAVStorage(c, PublicBase())
+	}
+	return &S3Storage{publicURL: PublicBase()}, nil
+}
+
+// PublicBase returns the base URL of published audio: the public_url of the
+// storage section, or what the backend serves by default.
+func PublicBase() string {
+	if config.Storage.PublicURL != "" {
+		return strings.TrimSuffix(config.Storage.PublicURL, "/")
+	}
+	backend, _ := config.StorageBackend()
+	switch backend {
+	case config.STORAGE_LOCAL:
+		if dir, err := filepath.Abs(config.Storage.Dir); err == nil && config.Storage.Dir != "" {
+			return "file://" + filepath.ToSlash(dir)
+		}
+	case config.STORAGE_WEBDAV:
+		if c, err := config.ResolveWebDAV(); err == nil {
+			return strings.TrimSuffix(c.URL, "/")
+		}
+	}
+	return R2_URL_PREFIX
+}
+
+// S3Storage publishes to the S3-compatible bucket of the s3 section. The
+// credentials are only needed, and checked, once the bucket is used.
+type S3Storage struct {
+	publicURL string
+}
+
+func (s *S3Storage) Put(path, key string) error {
+	client, err := defaultS3Client()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return client.PutObject(key, data, audio.MIMEType(path))
+}
+
+func (s *S3Storage) Stat(key string) (int64, error) {
+	client, err := defaultS3Client()
+	if err != nil {
+		return 0, err
+	}
+	size, _, err := client.Head(key)
+	return size, err
+}
+
+func (s *S3Storage) Get(key string) ([]byte, error) {
+	client, err := defaultS3Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(key)
+}
+
+func (s *S3Storage) PublicURL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+func (s *S3Storage) Delete(key string) error {
+	client, err := defaultS3Client()
+	if err != nil {
+		return err
+	}
+	return client.Delete(key)
+}
+
+func (s *S3Storage) List() ([]Object, error) {
+	client, err := defaultS3Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.List()
+}
+
+// UploadFile copies a local file to the configured storage under key, unless
+// an object of the same size is already there. A truncated or otherwise
+// different object is replaced.
+func UploadFile(filename, key string) error {
+	backend, err := Configured()
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	size, err := backend.Stat(key)
+	switch {
+	case err == nil && (size < 0 || size == info.Size()):
+		logger.LogDebug("%s is already stored, skipping the upload", key)
+		return nil
+	case err == nil:
+		logger.LogWarn("%s is stored with %d bytes instead of %d, uploading again", key, size, info.Size())
+	case !errors.Is(err, ErrObjectNotFound):
+		logger.LogError("Upload failed: %v", err)
+		return err
+	}
+	logger.LogDebug("Uploading %s to %s...", filename, key)
+	if err := backend.Put(filename, key); err != nil {
+		logger.LogError("Upload failed: %v", err)
+		return err
+	}
+	logger.LogDebug("Successfully uploaded %s", filename)
+	return nil
+}
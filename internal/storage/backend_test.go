@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+// testStorage runs the same checks against any backend.
+func testStorage(t *testing.T, s Storage) {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "abc.mp3")
+	os.WriteFile(src, []byte("audio"), 0644)
+
+	if _, err := s.Stat("abc.mp3"); err != ErrObjectNotFound {
+		t.Fatalf("Stat before Put = %v, want ErrObjectNotFound", err)
+	}
+	if _, err := s.Get("abc.mp3"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+	if err := s.Put(src, "abc.mp3"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if size, err := s.Stat("abc.mp3"); size != 5 || err != nil {
+		t.Errorf("Stat after Put = %d, %v", size, err)
+	}
+	if data, err := s.Get("abc.mp3"); string(data) != "audio" || err != nil {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+	objects, err := s.List()
+	if err != nil || len(objects) != 1 || objects[0].Key != "abc.mp3" || objects[0].Size != 5 {
+		t.Errorf("List = %+v, %v", objects, err)
+	}
+	if err := s.Delete("abc.mp3"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := s.Delete("abc.mp3"); err != nil {
+		t.Errorf("Deleting a missing key failed: %v", err)
+	}
+	if _, err := s.Stat("abc.mp3"); err != ErrObjectNotFound {
+		t.Error("Expected the key to be gone")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, "https://nas.example.com/tts/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leftovers of unfinished writes are not listed.
+	os.WriteFile(filepath.Join(dir, ".abc.mp3.123.tmp"), []byte("partial"), 0644)
+	testStorage(t, s)
+	if got := s.PublicURL("abc.mp3"); got != "https://nas.example.com/tts/abc.mp3" {
+		t.Errorf("PublicURL = %s", got)
+	}
+	if _, err := s.Get("../etc/passwd"); err == nil {
+		t.Error("Expected error for a key outside the directory")
+	}
+}
+
+// fakeWebDAV is an in-memory WebDAV collection at /dav/ that requires basic
+// authentication.
+type fakeWebDAV struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (f *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "me" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/dav/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "PROPFIND":
+		if key != "" || r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		keys := make([]string, 0, len(f.files))
+		for k := range f.files {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		fmt.Fprint(w, `<d:response><d:href>/dav/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		for _, k := range keys {
+			fmt.Fprintf(w, `<d:response><d:href>/dav/%s</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>%d</d:getcontentlength><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, xmlEscape(k), len(f.files[k]))
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		_, existed := f.files[key]
+		f.files[key] = data
+		if existed {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodHead, http.MethodGet:
+		data, ok := f.files[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case http.MethodDelete:
+		if _, ok := f.files[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	server := httptest.NewServer(&fakeWebDAV{files: map[string][]byte{}})
+	defer server.Close()
+	s, err := NewWebDAVStorage(config.WebDAVConfig{URL: server.URL + "/dav/", User: "me", Password: "secret"}, server.URL+"/dav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+
+	s.password = "wrong"
+	if _, err := s.Stat("abc.mp3"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	old := config.Storage
+	defer func() { config.Storage = old }()
+
+	config.Storage = config.StorageConfig{}
+	if b, err := Configured(); err != nil || b.PublicURL("a.mp3") != R2_URL_PREFIX+"/a.mp3" {
+		t.Errorf("Expected the R2 bucket by default, got %v, %v", b, err)
+	}
+
+	dir := t.TempDir()
+	config.Storage = config.StorageConfig{Backend: "local", Dir: dir}
+	b, err := Configured()
+	if _, ok := b.(*LocalStorage); !ok || err != nil {
+		t.Fatalf("Configured() = %T, %v", b, err)
+	}
+	if got := b.PublicURL("a.mp3"); got != "file://"+filepath.ToSlash(dir)+"/a.mp3" {
+		t.Errorf("PublicURL = %s", got)
+	}
+
+	t.Setenv("WEBDAV_URL", "")
+	config.Storage = config.StorageConfig{Backend: "webdav"}
+	if _, err := Configured(); err == nil {
+		t.Error("Expected error for WebDAV without a URL")
+	}
+	config.Storage = config.StorageConfig{Backend: "ftp"}
+	if _, err := Configured(); err == nil {
+		t.Error("Expected error for an unknown backend")
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	old := config.Storage
+	defer func() { config.Storage = old }()
+	dir := t.TempDir()
+	config.Storage = config.StorageConfig{Backend: "local", Dir: dir}
+
+	src := filepath.Join(t.TempDir(), "abc.mp3")
+	os.WriteFile(src, []byte("audio data"), 0644)
+	if err := UploadFile(src, "abc.mp3"); err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	stored := filepath.Join(dir, "abc.mp3")
+	if data, _ := os.ReadFile(stored); string(data) != "audio data" {
+		t.Fatalf("Stored %q", data)
+	}
+
+	// An object of the same size is left alone.
+	os.WriteFile(stored, []byte("other data"), 0644)
+	if err := UploadFile(src, "abc.mp3"); err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(stored); string(data) != "other data" {
+		t.Errorf("Expected the upload to be skipped, stored %q", data)
+	}
+
+	// A truncated object is replaced.
+	os.WriteFile(stored, []byte("audio"), 0644)
+	if err := UploadFile(src, "abc.mp3"); err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(stored); string(data) != "audio data" {
+		t.Errorf("Expected the truncated object to be replaced, stored %q", data)
+	}
+}
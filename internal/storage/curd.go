@@ -1,25 +1,32 @@
 package storage
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"time"
 
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/outbox"
 	"github.com/zhasm/tts-reader/internal/tts"
-	"github.com/zhasm/tts-reader/internal/utils"
 	"github.com/zhasm/tts-reader/pkg/config"
 	"github.com/zhasm/tts-reader/pkg/logger"
 )
 
 const (
 	CRUD_HOST = "https://tts-server.rex-zhasm6886.workers.dev/api/item"
-)
 
-func AppendRecord(req tts.TTSRequest) (bool, error) {
+	// RECORD_SCHEMA_VERSION is the version of the record fields sent. Version
+	// 1 records, all that older servers accept, hold language, content,
+	// FileSizeKb and md5.
+	RECORD_SCHEMA_VERSION = 2
+)
 
+// NewRecord returns the record of the request's audio.
+func NewRecord(req tts.TTSRequest) (Record, error) {
 	// Normalize language code
 	lang := ""
 	for _, l := range config.Langs {
@@ -30,64 +37,192 @@ func AppendRecord(req tts.TTSRequest) (bool, error) {
 	}
 	if lang == "" {
 		logger.LogError("Unsupported language: %s", req.Lang)
-		return false, fmt.Errorf("unsupported language: %s", req.Lang)
+		return Record{}, fmt.Errorf("unsupported language: %s", req.Lang)
 	}
 
 	// Get file size in KB
 	fileInfo, err := os.Stat(req.Dest)
 	if err != nil {
 		logger.LogError("Error getting file info: %v", err)
-		return false, err
+		return Record{}, err
+	}
+	r := Record{
+		Version:    RECORD_SCHEMA_VERSION,
+		Language:   lang,
+		Content:    req.Content,
+		FileSizeKb: fmt.Sprintf("%d", fileInfo.Size()/1024),
+		Md5:        req.Md5,
+		Size:       fileInfo.Size(),
+		Speed:      req.Speed,
+		Voice:      req.Reader,
+		URL:        PublicURL(req),
+		Client:     ClientID(),
+		Tags:       req.Tags,
+		Note:       req.Note,
+	}
+	if info, err := audio.Probe(req.Dest); err == nil {
+		r.Format = info.MIMEType
+		r.Duration = info.Duration.Seconds()
 	}
-	fileSizeKb := fmt.Sprintf("%d", fileInfo.Size()/1024)
-	// Build JSON data
-	data := map[string]string{
-		"language":   lang,
-		"content":    req.Content,
-		"FileSizeKb": fileSizeKb,
-		"md5":        req.Md5,
+	return r, nil
+}
+
+// ClientID identifies the program and host records come from.
+func ClientID() string {
+	version := config.VersionInfo
+	if version == "" {
+		version = "dev"
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
 	}
-	jsonBytes, err := json.Marshal(data)
+	return fmt.Sprintf("tts-reader/%s (%s)", version, host)
+}
+
+// AppendRecord stores the record of the request's audio. When the records
+// service cannot be reached, the record is queued in the outbox instead.
+func AppendRecord(req tts.TTSRequest) (bool, error) {
+	r, err := NewRecord(req)
 	if err != nil {
-		logger.LogError("Error marshaling JSON: %v", err)
 		return false, err
 	}
-	body := bytes.NewBuffer(jsonBytes)
+	if _, err := DefaultRecordsClient().Create(r); err != nil {
+		// Retrying a record the service refuses would fail forever.
+		if isPermanent(err) {
+			return false, err
+		}
+		if _, qerr := DefaultOutbox().Add(OUTBOX_RECORD, r, err); qerr != nil {
+			return false, errors.Join(err, qerr)
+		}
+		logger.LogWarn("Appending record failed, queued in the outbox: %v", err)
+		return false, fmt.Errorf("%w: %v", outbox.ErrQueued, err)
+	}
+	return true, nil
+}
+
+// AppendRecords stores records in batches. When the service fails, the
+// records it did not take are queued in the outbox, one item each, and
+// reported with outbox.ErrQueued; when it refuses them, they are not.
+func AppendRecords(records []Record) error {
+	saved, err := DefaultRecordsClient().CreateBatch(records)
+	if err == nil {
+		return nil
+	}
+	if isPermanent(err) {
+		return err
+	}
+	rest := records[len(saved):]
+	logger.LogWarn("Appending %d records failed, queued in the outbox: %v", len(rest), err)
+	ob := DefaultOutbox()
+	for _, r := range rest {
+		if _, qerr := ob.Add(OUTBOX_RECORD, r, err); qerr != nil {
+			return errors.Join(err, qerr)
+		}
+	}
+	return fmt.Errorf("%w: %v", outbox.ErrQueued, err)
+}
 
-	// Create client
-	client := &http.Client{}
+// Record is an item stored by the records service.
+type Record struct {
+	ID         RecordID `json:"id,omitempty"`
+	Version    int      `json:"version,omitempty"`
+	Language   string   `json:"language"`
+	Content    string   `json:"content"`
+	FileSizeKb string   `json:"FileSizeKb"`
+	Md5        string   `json:"md5"`
+	CreatedAt  string   `json:"created_at,omitempty"`
 
-	httpHeaders := map[string]string{
-		"Content-Type": "application/json",
+	// Since version 2.
+	Size  int64   `json:"size,omitempty"`
+	Speed float64 `json:"speed,omitempty"`
+	Voice string  `json:"voice,omitempty"`
+	// Format is the MIME type of the audio.
+	Format string `json:"format,omitempty"`
+	// Duration is in seconds.
+	Duration float64  `json:"duration,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Client   string   `json:"client,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// legacy returns the version 1 payload of r.
+func (r Record) legacy() map[string]string {
+	return map[string]string{
+		"language":   r.Language,
+		"content":    r.Content,
+		"FileSizeKb": r.FileSizeKb,
+		"md5":        r.Md5,
 	}
-	httpReq, err := utils.NewHTTPRequest("POST", CRUD_HOST, body, httpHeaders)
-	if err != nil {
-		logger.LogError("Error creating HTTP request: %v", err)
-		return false, err
+}
+
+// RecordID is the id the records service gives an item, a number or a
+// string depending on its storage.
+type RecordID string
+
+func (id *RecordID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = RecordID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid record id %s", data)
 	}
+	*id = RecordID(n.String())
+	return nil
+}
 
-	// Headers
-	httpReq.Header.Add("Content-Type", "application/json")
-	httpReq.Header.Add("Authorization", "Bearer "+config.R2_DB_TOKEN)
+// Created parses CreatedAt, returning the zero time when it is missing or in
+// an unknown layout.
+func (r Record) Created() time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, r.CreatedAt); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
 
-	// Fetch Request
-	resp, err := utils.HTTPRequest(client, httpReq)
-	if err != nil {
-		logger.LogError("Failure : ", err)
-		return false, err
+// Key returns the storage key of the audio of r: the name in its URL, or
+// its md5 with the extension of its format. Legacy records, which have
+// neither, were published as mp3.
+func (r Record) Key() string {
+	if r.URL != "" {
+		if u, err := url.Parse(r.URL); err == nil && audio.HasAudioExtension(u.Path) {
+			return path.Base(u.Path)
+		}
 	}
-	defer resp.Body.Close()
+	ext := audio.Extension(r.Format)
+	if ext == "" {
+		ext = ".mp3"
+	}
+	return r.Md5 + ext
+}
 
-	// Read Response Body
-	respBody, _ := io.ReadAll(resp.Body)
+// PublicURL returns the URL of the audio of r: the one it was published at,
+// or where the configured storage would serve it.
+func (r Record) PublicURL() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return PublicBase() + "/" + r.Key()
+}
+
+// ListRecords fetches the records stored by the records service.
+func ListRecords() ([]Record, error) {
+	return DefaultRecordsClient().List(RecordQuery{})
+}
 
-	// Display Results
-	logger.LogDebug("response Status : ", resp.Status)
-	logger.LogDebug("response Headers : ", resp.Header)
-	logger.LogDebug("response Body : ", string(respBody))
-	if resp.StatusCode != 200 {
-		fmt.Println("Appending record Error!")
-		os.Exit(1)
+// DeleteRecord removes a record from the records service.
+func DeleteRecord(r Record) error {
+	if r.ID == "" {
+		return fmt.Errorf("record %s has no id", r.Md5)
 	}
-	return true, nil
+	if err := DefaultRecordsClient().Delete(r.ID); err != nil {
+		return fmt.Errorf("deleting record %s failed: %w", r.Md5, err)
+	}
+	return nil
 }
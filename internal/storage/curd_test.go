@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/zhasm/tts-reader/internal/tts"
@@ -21,3 +22,34 @@ func TestAppendRecord_FileNotExist(t *testing.T) {
 		t.Errorf("Expected error for non-existent file, got ok=%v, err=%v", ok, err)
 	}
 }
+
+func TestRecordID(t *testing.T) {
+	var records []Record
+	if err := json.Unmarshal([]byte(`[{"id": 42, "md5": "a"}, {"id": "b7", "md5": "b"}, {"md5": "c"}]`), &records); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if records[0].ID != "42" || records[1].ID != "b7" || records[2].ID != "" {
+		t.Errorf("Unexpected ids: %q %q %q", records[0].ID, records[1].ID, records[2].ID)
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	tests := []struct {
+		r    Record
+		want string
+	}{
+		{Record{Md5: "abc"}, "abc.mp3"},
+		{Record{Md5: "abc", Format: "audio/wav"}, "abc.wav"},
+		{Record{Md5: "abc", Format: "audio/wav", URL: "https://cdn.example.com/audio/def.ogg"}, "def.ogg"},
+		{Record{Md5: "abc", Format: "audio/ogg", URL: "https://cdn.example.com/play?id=abc"}, "abc.ogg"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Key(); got != tt.want {
+			t.Errorf("Key() of %+v = %s, want %s", tt.r, got, tt.want)
+		}
+	}
+	r := Record{Md5: "abc", URL: "https://cdn.example.com/audio/abc.wav"}
+	if got := r.PublicURL(); got != r.URL {
+		t.Errorf("PublicURL() = %s, want %s", got, r.URL)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zhasm/tts-reader/internal/outbox"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// OUTBOX_DIR is the outbox directory in TTS_PATH.
+	OUTBOX_DIR = "outbox"
+
+	// Kinds of outbox items.
+	OUTBOX_UPLOAD = "upload"
+	OUTBOX_RECORD = "record"
+)
+
+// uploadPayload is a queued upload of a local file.
+type uploadPayload struct {
+	File string `json:"file"`
+	Key  string `json:"key"`
+}
+
+// DefaultOutbox returns the outbox of TTS_PATH.
+func DefaultOutbox() *outbox.Outbox {
+	return outbox.New(filepath.Join(config.TTS_PATH, OUTBOX_DIR))
+}
+
+var outboxHandlers = map[string]outbox.Handler{
+	OUTBOX_UPLOAD: replayUpload,
+	OUTBOX_RECORD: replayRecord,
+}
+
+func replayUpload(payload json.RawMessage) error {
+	var p uploadPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("%w: %v", outbox.ErrPermanent, err)
+	}
+	if _, err := os.Stat(p.File); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %v", outbox.ErrPermanent, err)
+	}
+	return UploadFile(p.File, p.Key)
+}
+
+func replayRecord(payload json.RawMessage) error {
+	var r Record
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return fmt.Errorf("%w: %v", outbox.ErrPermanent, err)
+	}
+	_, err := DefaultRecordsClient().Create(r)
+	if isPermanent(err) {
+		return fmt.Errorf("%w: %v", outbox.ErrPermanent, err)
+	}
+	return err
+}
+
+// QueuedRecords returns the records waiting in the outbox.
+func QueuedRecords() ([]Record, error) {
+	items, err := DefaultOutbox().List()
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, it := range items {
+		if it.Kind != OUTBOX_RECORD {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(it.Payload, &r); err != nil {
+			logger.LogWarn("Skipping outbox item %s: %v", it.ID, err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// FlushOutboxItems replays the due items of the outbox, or all of them.
+func FlushOutboxItems(all bool) (outbox.FlushResult, error) {
+	return DefaultOutbox().Flush(outboxHandlers, all)
+}
+
+// FlushOutbox is the pipeline stage replaying the due items of the outbox
+// next to the new work. Items that fail again wait for a later run.
+func FlushOutbox(tts.TTSRequest) (bool, error) {
+	r, err := FlushOutboxItems(false)
+	if err != nil {
+		return false, err
+	}
+	if r.Sent+r.Failed+r.Dropped > 0 {
+		logger.LogInfo("Outbox: %d sent, %d failed, %d dropped, %d waiting", r.Sent, r.Failed, r.Dropped, r.Waiting)
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhasm/tts-reader/internal/outbox"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func TestAppendRecord_QueuesWhenOffline(t *testing.T) {
+	oldPath, oldURL, oldToken := config.TTS_PATH, recordsURL, config.R2_DB_TOKEN
+	defer func() { config.TTS_PATH, recordsURL, config.R2_DB_TOKEN = oldPath, oldURL, oldToken }()
+	config.TTS_PATH = t.TempDir()
+	config.R2_DB_TOKEN = "token"
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	recordsURL = down.URL
+
+	dest := filepath.Join(config.TTS_PATH, "abc.mp3")
+	os.WriteFile(dest, make([]byte, 2048), 0644)
+	ok, err := AppendRecord(tts.TTSRequest{Lang: "fr-FR", Content: "Bonjour", Dest: dest, Md5: "abc"})
+	if ok || !errors.Is(err, outbox.ErrQueued) {
+		t.Fatalf("AppendRecord = %v, %v; want the record queued", ok, err)
+	}
+	items, _ := DefaultOutbox().List()
+	if len(items) != 1 || items[0].Kind != OUTBOX_RECORD {
+		t.Fatalf("Expected one queued record, got %+v", items)
+	}
+
+	// The worker is back: the record is sent and leaves the outbox.
+	worker := &fakeWorker{}
+	server := httptest.NewServer(worker)
+	defer server.Close()
+	recordsURL = server.URL
+	r, err := FlushOutboxItems(true)
+	if err != nil || r.Sent != 1 {
+		t.Fatalf("FlushOutboxItems = %+v, %v", r, err)
+	}
+	if len(worker.items) != 1 || worker.items[0].Md5 != "abc" || worker.items[0].Language != "fr" || worker.items[0].FileSizeKb != "2" {
+		t.Errorf("Unexpected records: %+v", worker.items)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", items)
+	}
+}
+
+func TestAppendRecord_RefusedIsNotQueued(t *testing.T) {
+	oldPath, oldURL, oldToken := config.TTS_PATH, recordsURL, config.R2_DB_TOKEN
+	defer func() { config.TTS_PATH, recordsURL, config.R2_DB_TOKEN = oldPath, oldURL, oldToken }()
+	config.TTS_PATH = t.TempDir()
+	config.R2_DB_TOKEN = "token"
+
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer refusing.Close()
+	recordsURL = refusing.URL
+
+	dest := filepath.Join(config.TTS_PATH, "abc.mp3")
+	os.WriteFile(dest, make([]byte, 2048), 0644)
+	ok, err := AppendRecord(tts.TTSRequest{Lang: "fr-FR", Content: "Bonjour", Dest: dest, Md5: "abc"})
+	if ok || err == nil || errors.Is(err, outbox.ErrQueued) {
+		t.Fatalf("AppendRecord = %v, %v; want a failure", ok, err)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", items)
+	}
+	if err := replayRecord([]byte(`{"language": "fr", "content": "Bonjour", "md5": "abc"}`)); !errors.Is(err, outbox.ErrPermanent) {
+		t.Errorf("Expected a permanent failure, got %v", err)
+	}
+}
+
+func TestAppendRecords_QueuesOnlyFailures(t *testing.T) {
+	oldPath, oldURL, oldToken := config.TTS_PATH, recordsURL, config.R2_DB_TOKEN
+	defer func() { config.TTS_PATH, recordsURL, config.R2_DB_TOKEN = oldPath, oldURL, oldToken }()
+	config.TTS_PATH = t.TempDir()
+	config.R2_DB_TOKEN = "token"
+	status := http.StatusConflict
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	recordsURL = server.URL
+
+	records := []Record{{Language: "fr", Content: "Bonjour", Md5: "abc"}, {Language: "fr", Content: "Salut", Md5: "def"}}
+	if err := AppendRecords(records); err == nil || errors.Is(err, outbox.ErrQueued) {
+		t.Errorf("AppendRecords refused = %v, want a failure", err)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 0 {
+		t.Fatalf("Expected refused records not to be queued, got %+v", items)
+	}
+
+	status = http.StatusBadGateway
+	if err := AppendRecords(records); !errors.Is(err, outbox.ErrQueued) {
+		t.Errorf("AppendRecords offline = %v, want the records queued", err)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 2 {
+		t.Errorf("Expected two queued records, got %+v", items)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusConflict:            true,
+		http.StatusUnauthorized:        false,
+		http.StatusForbidden:           false,
+		http.StatusRequestTimeout:      false,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		if got := isPermanent(&StatusError{StatusCode: code}); got != want {
+			t.Errorf("isPermanent(%d) = %v, want %v", code, got, want)
+		}
+	}
+	if isPermanent(errors.New("connection refused")) {
+		t.Error("Expected a transport error to be retried")
+	}
+}
+
+func TestReplayUpload_MissingFile(t *testing.T) {
+	old := config.TTS_PATH
+	defer func() { config.TTS_PATH = old }()
+	config.TTS_PATH = t.TempDir()
+	err := replayUpload([]byte(`{"file": "/nonexistent/abc.mp3", "key": "abc.mp3"}`))
+	if !errors.Is(err, outbox.ErrPermanent) {
+		t.Fatalf("Expected a permanent failure, got %v", err)
+	}
+	if _, err := FlushOutbox(tts.TTSRequest{}); err != nil {
+		t.Errorf("FlushOutbox failed: %v", err)
+	}
+}
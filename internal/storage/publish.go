@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/clipboard"
+	"github.com/zhasm/tts-reader/internal/outbox"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	R2_URL_PREFIX = "https://pub-c6b11003307646e98afc7540d5f09c41.r2.dev"
+)
+
+// ObjectKey returns the bucket key of the request's audio: its md5 followed by
+// the extension of the local file.
+func ObjectKey(req tts.TTSRequest) string {
+	ext := filepath.Ext(req.Dest)
+	if ext == "" {
+		ext = ".mp3"
+	}
+	return req.Md5 + ext
+}
+
+// PublicURL returns the public URL of the request's audio in the configured
+// storage.
+func PublicURL(req tts.TTSRequest) string {
+	return fmt.Sprintf("%s/%s", PublicBase(), ObjectKey(req))
+}
+
+// Upload publishes the request's audio to the configured storage and copies
+// its public URL to the clipboard. An upload failing for the network or the
+// server is queued in the outbox, and reported with outbox.ErrQueued.
+func Upload(req tts.TTSRequest) (bool, error) {
+	// Check if file exists and is not empty
+	filename := req.Dest
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		logger.LogWarn("File does not exist: %s", filename)
+		return false, err
+	}
+
+	if fileInfo.Size() == 0 {
+		logger.LogWarn("File is empty: %s", filename)
+		return false, fmt.Errorf("file is empty")
+	}
+
+	if err := UploadFile(filename, ObjectKey(req)); err != nil {
+		// Settings and credentials must be fixed first: queueing would
+		// only fail again.
+		if !isRetryable(err) {
+			return false, err
+		}
+		payload := uploadPayload{File: filename, Key: ObjectKey(req)}
+		if _, qerr := DefaultOutbox().Add(OUTBOX_UPLOAD, payload, err); qerr != nil {
+			return false, errors.Join(err, qerr)
+		}
+		logger.LogWarn("Upload failed, queued in the outbox: %v", err)
+		return false, fmt.Errorf("%w: %v", outbox.ErrQueued, err)
+	}
+
+	// The upload succeeded: a clipboard failure is only worth a warning.
+	url := PublicURL(req)
+	if provider, err := clipboard.Copy(url); err != nil {
+		logger.LogWarn("Could not copy %s to the clipboard: %v", url, err)
+	} else if provider != "" {
+		logger.LogDebug("Copied %s to the clipboard with %s", url, provider)
+	}
+	return true, nil
+}
+
+// Object is a file stored in the bucket.
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ListObjects lists the files of the configured storage.
+func ListObjects() ([]Object, error) {
+	backend, err := Configured()
+	if err != nil {
+		return nil, err
+	}
+	return backend.List()
+}
+
+// DownloadFile copies key of the configured storage to filename.
+func DownloadFile(key, filename string) error {
+	backend, err := Configured()
+	if err != nil {
+		return err
+	}
+	logger.LogDebug("Downloading %s...", key)
+	data, err := backend.Get(key)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filename, data, 0644)
+}
+
+// DeleteObject removes key from the configured storage.
+func DeleteObject(key string) error {
+	backend, err := Configured()
+	if err != nil {
+		return err
+	}
+	logger.LogDebug("Deleting %s...", key)
+	return backend.Delete(key)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhasm/tts-reader/internal/outbox"
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func TestUpload_FileNotExist(t *testing.T) {
+	req := tts.TTSRequest{Dest: "nonexistent.mp3", Md5: "abc"}
+	ok, err := Upload(req)
+	if ok || err == nil {
+		t.Errorf("Expected error for non-existent file, got ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestPublicURL(t *testing.T) {
+	req := tts.TTSRequest{Dest: "/tmp/tts/abc.mp3", Md5: "abc"}
+	if got, want := PublicURL(req), R2_URL_PREFIX+"/abc.mp3"; got != want {
+		t.Errorf("PublicURL = %s, want %s", got, want)
+	}
+	req = tts.TTSRequest{Dest: "/tmp/course/lesson1.wav", Md5: "def"}
+	if got, want := ObjectKey(req), "def.wav"; got != want {
+		t.Errorf("ObjectKey = %s, want %s", got, want)
+	}
+}
+
+func TestUpload_QueuesOnlyRetryableFailures(t *testing.T) {
+	oldPath, oldStorage := config.TTS_PATH, config.Storage
+	defer func() { config.TTS_PATH, config.Storage = oldPath, oldStorage }()
+	config.TTS_PATH = t.TempDir()
+	dest := filepath.Join(config.TTS_PATH, "abc.mp3")
+	os.WriteFile(dest, []byte("audio data"), 0644)
+	req := tts.TTSRequest{Dest: dest, Md5: "abc"}
+
+	server := httptest.NewServer(&fakeWebDAV{files: map[string][]byte{}})
+	t.Setenv("WEBDAV_USER", "me")
+	t.Setenv("WEBDAV_PASSWORD", "wrong")
+	t.Setenv("WEBDAV_URL", server.URL+"/dav/")
+	config.Storage = config.StorageConfig{Backend: "webdav"}
+	if ok, err := Upload(req); ok || err == nil || errors.Is(err, outbox.ErrQueued) {
+		t.Errorf("Upload with refused credentials = %v, %v; want a failure", ok, err)
+	}
+	t.Setenv("R2_ENDPOINT", "")
+	config.Storage = config.StorageConfig{Backend: "s3"}
+	if ok, err := Upload(req); ok || err == nil || errors.Is(err, outbox.ErrQueued) {
+		t.Errorf("Upload without settings = %v, %v; want a failure", ok, err)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 0 {
+		t.Fatalf("Expected an empty outbox, got %+v", items)
+	}
+
+	server.Close()
+	config.Storage = config.StorageConfig{Backend: "webdav"}
+	if ok, err := Upload(req); ok || !errors.Is(err, outbox.ErrQueued) {
+		t.Errorf("Upload to a server that is down = %v, %v; want it queued", ok, err)
+	}
+	if items, _ := DefaultOutbox().List(); len(items) != 1 || items[0].Kind != OUTBOX_UPLOAD {
+		t.Errorf("Expected one queued upload, got %+v", items)
+	}
+}
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/history"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+const (
+	// RECORDS_PAGE_SIZE is how many records a list request asks for.
+	RECORDS_PAGE_SIZE = 100
+	// RECORDS_BATCH_SIZE is how many records a batch append sends at once.
+	RECORDS_BATCH_SIZE = 100
+)
+
+var (
+	// ErrRecordNotFound is returned for ids and md5s the service does not hold.
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrAmbiguousRecord is returned when an md5 prefix matches several records.
+	ErrAmbiguousRecord = errors.New("md5 prefix matches several records")
+)
+
+// StatusError is an unsuccessful answer of the records service.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("records service: %s %s: %s", e.Method, e.Path, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// statusCode returns the HTTP status of err, or 0 when it is not a
+// StatusError.
+func statusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+	return 0
+}
+
+// rejectsPayload reports whether err is the answer of a service refusing the
+// fields it was sent, as older workers do with version 2 records.
+func rejectsPayload(err error) bool {
+	switch statusCode(err) {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// isPermanent reports whether err is an answer of the service that sending
+// the same request again cannot change: a client error other than a timeout
+// or a rate limit. Refused credentials are not the record's fault, they are
+// fixed in the config and the record is kept.
+func isPermanent(err error) bool {
+	switch code := statusCode(err); code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	default:
+		return code >= 400 && code < 500
+	}
+}
+
+// serviceLimits remembers, per service URL, what a service turned out not to
+// support, so that later clients skip straight to what works.
+type serviceLimits struct {
+	// legacy is set when the service only accepts version 1 records.
+	legacy bool
+	// noBatch is set when the service has no batch endpoint.
+	noBatch bool
+}
+
+var (
+	limitsMu sync.Mutex
+	limits   = map[string]serviceLimits{}
+)
+
+func (c *RecordsClient) limits() serviceLimits {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	return limits[c.baseURL]
+}
+
+func (c *RecordsClient) setLimits(update func(*serviceLimits)) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	l := limits[c.baseURL]
+	update(&l)
+	limits[c.baseURL] = l
+}
+
+// RecordsClient talks to the item API of the records service: GET, POST on
+// the collection and GET, PUT, DELETE on CRUD_HOST/<id>.
+type RecordsClient struct {
+	baseURL  string
+	token    string
+	client   *http.Client
+	pageSize int
+}
+
+func NewRecordsClient(baseURL, token string) *RecordsClient {
+	return &RecordsClient{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		pageSize: RECORDS_PAGE_SIZE,
+	}
+}
+
+// recordsURL is CRUD_HOST, but for tests.
+var recordsURL = CRUD_HOST
+
+// DefaultRecordsClient returns a client for CRUD_HOST with R2_DB_TOKEN.
+func DefaultRecordsClient() *RecordsClient {
+	return NewRecordsClient(recordsURL, config.R2_DB_TOKEN)
+}
+
+// RecordQuery narrows a listing. The fields are sent as query parameters and
+// also applied to the results, for services that ignore them.
+type RecordQuery struct {
+	Md5      string
+	Language string
+	// Text matches content case-insensitively.
+	Text string
+	// Tags must all be carried by a record.
+	Tags []string
+}
+
+func (q RecordQuery) values() url.Values {
+	v := url.Values{}
+	if q.Md5 != "" {
+		v.Set("md5", q.Md5)
+	}
+	if q.Language != "" {
+		v.Set("language", q.Language)
+	}
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	for _, t := range q.Tags {
+		v.Add("tag", t)
+	}
+	return v
+}
+
+// Matches reports whether r satisfies q. Md5 matches as a prefix.
+func (q RecordQuery) Matches(r Record) bool {
+	return strings.HasPrefix(r.Md5, q.Md5) &&
+		(q.Language == "" || r.Language == q.Language) &&
+		(q.Text == "" || strings.Contains(strings.ToLower(r.Content), strings.ToLower(q.Text))) &&
+		history.HasTags(r.Tags, q.Tags)
+}
+
+// do sends a request to the service, with in as JSON when given, and returns
+// the body of a successful answer.
+func (c *RecordsClient) do(method, path string, query url.Values, in any) ([]byte, error) {
+	var body io.Reader
+	headers := map[string]string{"Authorization": "Bearer " + c.token}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		headers["Content-Type"] = "application/json"
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	httpReq, err := utils.NewHTTPRequest(method, u, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := utils.HTTPRequest(c.client, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{Method: method, Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return respBody, nil
+}
+
+// recordPage is a listing answer: a bare array or an object holding an items
+// array and, optionally, the total count.
+type recordPage struct {
+	Items []Record
+	Total int
+}
+
+func (p *recordPage) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.Items); err == nil {
+		return nil
+	}
+	var wrapped struct {
+		Items []Record `json:"items"`
+		Total int      `json:"total"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return err
+	}
+	p.Items, p.Total = wrapped.Items, wrapped.Total
+	return nil
+}
+
+// Page returns up to limit records from offset, and the total when the
+// service tells it.
+func (c *RecordsClient) Page(q RecordQuery, offset, limit int) ([]Record, int, error) {
+	v := q.values()
+	v.Set("limit", strconv.Itoa(limit))
+	v.Set("offset", strconv.Itoa(offset))
+	body, err := c.do(http.MethodGet, "", v, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var page recordPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, 0, fmt.Errorf("error parsing records: %w", err)
+	}
+	return page.Items, page.Total, nil
+}
+
+// List returns every record matching q, following pages until one comes back
+// short or, for services that ignore paging, adds nothing new.
+func (c *RecordsClient) List(q RecordQuery) ([]Record, error) {
+	var (
+		records []Record
+		seen    = map[string]bool{}
+	)
+	for offset := 0; ; {
+		page, total, err := c.Page(q, offset, c.pageSize)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, r := range page {
+			id := string(r.ID)
+			if id == "" {
+				id = r.Md5 + "\x00" + r.Content
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			added++
+			if q.Matches(r) {
+				records = append(records, r)
+			}
+		}
+		offset += len(page)
+		if len(page) < c.pageSize || added == 0 || (total > 0 && offset >= total) {
+			return records, nil
+		}
+	}
+}
+
+// Get returns the record with id.
+func (c *RecordsClient) Get(id RecordID) (Record, error) {
+	body, err := c.do(http.MethodGet, "/"+url.PathEscape(string(id)), nil, nil)
+	if err != nil {
+		return Record{}, err
+	}
+	var r Record
+	if err := json.Unmarshal(body, &r); err != nil {
+		return Record{}, fmt.Errorf("error parsing record %s: %w", id, err)
+	}
+	return r, nil
+}
+
+// Find returns the one record whose md5 starts with prefix.
+func (c *RecordsClient) Find(prefix string) (Record, error) {
+	if prefix == "" {
+		return Record{}, ErrRecordNotFound
+	}
+	records, err := c.List(RecordQuery{Md5: prefix})
+	if err != nil {
+		return Record{}, err
+	}
+	switch len(records) {
+	case 0:
+		return Record{}, fmt.Errorf("%w: %s", ErrRecordNotFound, prefix)
+	case 1:
+		return records[0], nil
+	}
+	for _, r := range records {
+		if r.Md5 == prefix {
+			return r, nil
+		}
+	}
+	return Record{}, fmt.Errorf("%w: %s (%d records)", ErrAmbiguousRecord, prefix, len(records))
+}
+
+// Create stores r and returns it with the id the service gave it, when the
+// answer holds one. Services refusing version 2 records get the version 1
+// fields instead, and are remembered as such.
+func (c *RecordsClient) Create(r Record) (Record, error) {
+	body, err := c.create(r)
+	if err != nil {
+		return Record{}, err
+	}
+	var saved struct {
+		ID RecordID `json:"id"`
+	}
+	if json.Unmarshal(body, &saved) == nil && saved.ID != "" {
+		r.ID = saved.ID
+	}
+	return r, nil
+}
+
+func (c *RecordsClient) create(r Record) ([]byte, error) {
+	if c.limits().legacy {
+		return c.do(http.MethodPost, "", nil, r.legacy())
+	}
+	body, err := c.do(http.MethodPost, "", nil, r)
+	if err != nil && rejectsPayload(err) {
+		c.setLimits(func(l *serviceLimits) { l.legacy = true })
+		return c.do(http.MethodPost, "", nil, r.legacy())
+	}
+	return body, err
+}
+
+// CreateBatch stores records, RECORDS_BATCH_SIZE at a time through the batch
+// endpoint, or one by one on services without it. It returns the records
+// stored, with their ids when the service tells them, which on error are the
+// first ones of records.
+func (c *RecordsClient) CreateBatch(records []Record) ([]Record, error) {
+	saved := make([]Record, 0, len(records))
+	for start := 0; start < len(records); start += RECORDS_BATCH_SIZE {
+		chunk := records[start:min(start+RECORDS_BATCH_SIZE, len(records))]
+		stored, err := c.createChunk(chunk)
+		saved = append(saved, stored...)
+		if err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+func (c *RecordsClient) createChunk(chunk []Record) ([]Record, error) {
+	if !c.limits().noBatch {
+		body, err := c.postBatch(chunk)
+		switch code := statusCode(err); {
+		case err == nil:
+			return withIDs(chunk, body), nil
+		case code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented:
+			c.setLimits(func(l *serviceLimits) { l.noBatch = true })
+		default:
+			return nil, err
+		}
+	}
+	saved := make([]Record, 0, len(chunk))
+	for _, r := range chunk {
+		r, err := c.Create(r)
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, r)
+	}
+	return saved, nil
+}
+
+func (c *RecordsClient) postBatch(chunk []Record) ([]byte, error) {
+	if !c.limits().legacy {
+		body, err := c.do(http.MethodPost, "/batch", nil, chunk)
+		if err == nil || !rejectsPayload(err) {
+			return body, err
+		}
+		c.setLimits(func(l *serviceLimits) { l.legacy = true })
+	}
+	legacy := make([]map[string]string, len(chunk))
+	for i, r := range chunk {
+		legacy[i] = r.legacy()
+	}
+	return c.do(http.MethodPost, "/batch", nil, legacy)
+}
+
+// withIDs returns chunk with the ids of a batch answer, a listing of the
+// records stored in the same order.
+func withIDs(chunk []Record, body []byte) []Record {
+	saved := append([]Record(nil), chunk...)
+	var page recordPage
+	if json.Unmarshal(body, &page) != nil || len(page.Items) != len(saved) {
+		return saved
+	}
+	for i, r := range page.Items {
+		if r.ID != "" {
+			saved[i].ID = r.ID
+		}
+	}
+	return saved
+}
+
+// Update replaces the record with r.ID by r.
+func (c *RecordsClient) Update(r Record) error {
+	if r.ID == "" {
+		return fmt.Errorf("record %s has no id", r.Md5)
+	}
+	_, err := c.do(http.MethodPut, "/"+url.PathEscape(string(r.ID)), nil, r)
+	return err
+}
+
+// Delete removes the record with id.
+func (c *RecordsClient) Delete(id RecordID) error {
+	if id == "" {
+		return fmt.Errorf("record has no id")
+	}
+	_, err := c.do(http.MethodDelete, "/"+url.PathEscape(string(id)), nil, nil)
+	return err
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWorker is an in-memory stand-in of the records service item API.
+type fakeWorker struct {
+	mu     sync.Mutex
+	items  []Record
+	nextID int
+	// wrapped answers listings as {"items": [...], "total": n}.
+	wrapped bool
+	// noPaging ignores limit and offset, like older workers.
+	noPaging bool
+	// legacy refuses records with fields beyond version 1.
+	legacy bool
+	// batch serves POST /batch.
+	batch   bool
+	lists   int
+	creates int
+	batches int
+}
+
+// decode reads a version 1 or 2 record, refusing unknown fields in legacy mode.
+func (f *fakeWorker) decode(data json.RawMessage) (Record, bool) {
+	var rec Record
+	if f.legacy {
+		var fields map[string]any
+		json.Unmarshal(data, &fields)
+		for k := range fields {
+			switch k {
+			case "language", "content", "FileSizeKb", "md5":
+			default:
+				return rec, false
+			}
+		}
+	}
+	return rec, json.Unmarshal(data, &rec) == nil
+}
+
+func (f *fakeWorker) add(rec Record) Record {
+	f.nextID++
+	rec.ID = RecordID(strconv.Itoa(f.nextID))
+	f.items = append(f.items, rec)
+	return rec
+}
+
+func newFakeWorker(t *testing.T, f *fakeWorker) *RecordsClient {
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	c := NewRecordsClient(server.URL+"/api/item", "token")
+	c.pageSize = 2
+	return c
+}
+
+func (f *fakeWorker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/item"), "/")
+	find := func() int {
+		for i, it := range f.items {
+			if string(it.ID) == id {
+				return i
+			}
+		}
+		return -1
+	}
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		f.lists++
+		items := f.items
+		if !f.noPaging {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			items = items[min(offset, len(items)):min(offset+limit, len(items))]
+		}
+		if f.wrapped {
+			json.NewEncoder(w).Encode(map[string]any{"items": items, "total": len(f.items)})
+		} else {
+			json.NewEncoder(w).Encode(items)
+		}
+	case r.Method == http.MethodPost && id == "":
+		f.creates++
+		var data json.RawMessage
+		json.NewDecoder(r.Body).Decode(&data)
+		rec, ok := f.decode(data)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rec = f.add(rec)
+		fmt.Fprintf(w, `{"success": true, "id": %s}`, rec.ID)
+	case r.Method == http.MethodPost && id == "batch" && f.batch:
+		f.batches++
+		var data []json.RawMessage
+		json.NewDecoder(r.Body).Decode(&data)
+		var recs []Record
+		for _, d := range data {
+			rec, ok := f.decode(d)
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			recs = append(recs, rec)
+		}
+		var ids []map[string]RecordID
+		for _, rec := range recs {
+			ids = append(ids, map[string]RecordID{"id": f.add(rec).ID})
+		}
+		json.NewEncoder(w).Encode(ids)
+	case find() < 0:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(f.items[find()])
+	case r.Method == http.MethodPut:
+		var rec Record
+		json.NewDecoder(r.Body).Decode(&rec)
+		f.items[find()] = rec
+	case r.Method == http.MethodDelete:
+		i := find()
+		f.items = append(f.items[:i], f.items[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func seedRecords(t *testing.T, c *RecordsClient) {
+	for _, r := range []Record{
+		{Md5: "aaa111", Language: "fr", Content: "Bonjour le monde"},
+		{Md5: "aaa222", Language: "fr", Content: "Au revoir"},
+		{Md5: "bbb333", Language: "en", Content: "Hello world", Tags: []string{"lesson3"}},
+		{Md5: "ccc444", Language: "pl", Content: "Dzień dobry"},
+		{Md5: "ddd555", Language: "en", Content: "Goodbye WORLD"},
+	} {
+		saved, err := c.Create(r)
+		if err != nil || saved.ID == "" {
+			t.Fatalf("Create = %+v, %v", saved, err)
+		}
+	}
+}
+
+func TestRecordsClient_List(t *testing.T) {
+	for _, f := range []*fakeWorker{{}, {wrapped: true}, {noPaging: true}} {
+		c := newFakeWorker(t, f)
+		seedRecords(t, c)
+		records, err := c.List(RecordQuery{})
+		if err != nil || len(records) != 5 || records[4].Md5 != "ddd555" {
+			t.Errorf("List (wrapped=%v noPaging=%v) = %d records, %v", f.wrapped, f.noPaging, len(records), err)
+		}
+		if f.noPaging && f.lists != 2 {
+			t.Errorf("Expected List to stop once a page adds nothing, made %d requests", f.lists)
+		}
+
+		records, _ = c.List(RecordQuery{Text: "world"})
+		if len(records) != 2 {
+			t.Errorf("Search for world found %d records, want 2", len(records))
+		}
+		records, _ = c.List(RecordQuery{Text: "o", Language: "fr"})
+		if len(records) != 2 {
+			t.Errorf("Search for o in fr found %d records, want 2", len(records))
+		}
+		records, _ = c.List(RecordQuery{Tags: []string{"Lesson3"}})
+		if len(records) != 1 || records[0].Md5 != "bbb333" {
+			t.Errorf("Search for tag lesson3 found %+v, want bbb333", records)
+		}
+	}
+}
+
+func TestRecordsClient_Find(t *testing.T) {
+	c := newFakeWorker(t, &fakeWorker{})
+	seedRecords(t, c)
+	if r, err := c.Find("bbb"); err != nil || r.Content != "Hello world" {
+		t.Errorf("Find(bbb) = %+v, %v", r, err)
+	}
+	if _, err := c.Find("aaa"); !errors.Is(err, ErrAmbiguousRecord) {
+		t.Errorf("Expected ErrAmbiguousRecord, got %v", err)
+	}
+	if _, err := c.Find("fff"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestRecordsClient_CRUD(t *testing.T) {
+	f := &fakeWorker{}
+	c := newFakeWorker(t, f)
+	r, err := c.Create(Record{Md5: "eee666", Language: "jp", Content: "こんにちは"})
+	if err != nil || r.ID != "1" {
+		t.Fatalf("Create = %+v, %v", r, err)
+	}
+	r.Content = "こんばんは"
+	if err := c.Update(r); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got, err := c.Get(r.ID); err != nil || got.Content != "こんばんは" {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+	if err := c.Delete(r.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := c.Get(r.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound after Delete, got %v", err)
+	}
+	if err := c.Delete(""); err == nil {
+		t.Error("Expected error for a record without id")
+	}
+
+	c.token = "wrong"
+	if _, err := c.List(RecordQuery{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an authorization error, got %v", err)
+	}
+}
+
+func TestRecordsClient_CreateLegacy(t *testing.T) {
+	f := &fakeWorker{legacy: true}
+	c := newFakeWorker(t, f)
+	r := Record{Version: RECORD_SCHEMA_VERSION, Md5: "eee666", Language: "fr", Content: "Salut", Speed: 0.8, Tags: []string{"a"}}
+	saved, err := c.Create(r)
+	if err != nil || saved.ID != "1" {
+		t.Fatalf("Create = %+v, %v", saved, err)
+	}
+	if got := f.items[0]; got.Md5 != "eee666" || got.Speed != 0 || got.Version != 0 {
+		t.Errorf("Stored %+v, want the version 1 fields only", got)
+	}
+	// The downgrade is remembered: one request per record from now on.
+	f.creates = 0
+	if _, err := c.Create(r); err != nil || f.creates != 1 {
+		t.Errorf("Create = %v after %d requests, want 1", err, f.creates)
+	}
+
+	f2 := &fakeWorker{}
+	c2 := newFakeWorker(t, f2)
+	if _, err := c2.Create(r); err != nil || f2.items[0].Speed != 0.8 || len(f2.items[0].Tags) != 1 {
+		t.Errorf("Create = %v, stored %+v; want the version 2 fields", err, f2.items)
+	}
+}
+
+func TestRecordsClient_CreateBatch(t *testing.T) {
+	records := make([]Record, RECORDS_BATCH_SIZE+5)
+	for i := range records {
+		records[i] = Record{Version: RECORD_SCHEMA_VERSION, Md5: fmt.Sprintf("md5-%d", i), Language: "en", Content: "Hello", Duration: 1.5}
+	}
+	for name, f := range map[string]*fakeWorker{
+		"batch":        {batch: true},
+		"legacy batch": {batch: true, legacy: true},
+		"no batch":     {},
+	} {
+		c := newFakeWorker(t, f)
+		saved, err := c.CreateBatch(records)
+		if err != nil || len(saved) != len(records) || len(f.items) != len(records) {
+			t.Fatalf("%s: CreateBatch = %d records, %v; stored %d", name, len(saved), err, len(f.items))
+		}
+		if saved[3].ID != "4" || saved[len(saved)-1].ID != RecordID(strconv.Itoa(len(records))) {
+			t.Errorf("%s: ids %q, %q", name, saved[3].ID, saved[len(saved)-1].ID)
+		}
+		if f.batch && (f.batches < 2 || f.creates != 0) {
+			t.Errorf("%s: %d batch and %d create requests, want one batch per chunk", name, f.batches, f.creates)
+		}
+		if !f.batch && f.creates != len(records) {
+			t.Errorf("%s: %d create requests, want %d", name, f.creates, len(records))
+		}
+	}
+}
+
+func TestRecordsClient_CreateBatchError(t *testing.T) {
+	f := &fakeWorker{}
+	c := newFakeWorker(t, f)
+	c.token = "wrong"
+	saved, err := c.CreateBatch([]Record{{Md5: "a"}, {Md5: "b"}})
+	if statusCode(err) != http.StatusUnauthorized || len(saved) != 0 {
+		t.Errorf("CreateBatch = %v, %v; want a 401 and nothing saved", saved, err)
+	}
+}
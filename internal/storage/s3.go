@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// MULTIPART_THRESHOLD is the size from which files are uploaded in parts.
+	MULTIPART_THRESHOLD = 16 << 20
+	// PART_SIZE is the size of each part but the last, at least the 5 MiB S3
+	// requires.
+	PART_SIZE = 8 << 20
+
+	S3_SERVICE        = "s3"
+	S3_SIGN_ALGORITHM = "AWS4-HMAC-SHA256"
+	S3_TIME_FORMAT    = "20060102T150405Z"
+	// EMPTY_SHA256 is the payload hash of requests without a body.
+	EMPTY_SHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ErrObjectNotFound is returned for keys the bucket does not hold.
+var ErrObjectNotFound = errors.New("object not found")
+
+// S3Client talks to an S3-compatible bucket, such as R2, with path-style
+// requests signed with Signature Version 4.
+type S3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	// now is replaced in tests to sign with a fixed time.
+	now func() time.Time
+	// partSize and multipartThreshold are lowered in tests.
+	partSize           int
+	multipartThreshold int64
+}
+
+func NewS3Client(c config.S3Config) (*S3Client, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(c.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", c.Endpoint)
+	}
+	return &S3Client{
+		endpoint:           endpoint,
+		bucket:             c.Bucket,
+		region:             c.Region,
+		accessKey:          c.AccessKeyID,
+		secretKey:          c.SecretAccessKey,
+		client:             &http.Client{Timeout: 5 * time.Minute},
+		now:                time.Now,
+		partSize:           PART_SIZE,
+		multipartThreshold: MULTIPART_THRESHOLD,
+	}, nil
+}
+
+// defaultS3Client returns a client for the configured bucket.
+func defaultS3Client() (*S3Client, error) {
+	c, err := config.ResolveS3()
+	if err != nil {
+		return nil, err
+	}
+	return NewS3Client(c)
+}
+
+// objectURL returns the path-style URL of key with the given query.
+func (c *S3Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	u.Path = c.endpoint.Path + "/" + c.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	// Sent as signed: Go would leave characters such as '+' unescaped.
+	u.RawPath = uriEncode(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request and returns the response body. Every attempt
+// builds a new request, as bodies and signatures cannot be reused.
+func (c *S3Client) do(method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	var (
+		resp     *http.Response
+		respBody []byte
+	)
+	err := utils.RetryWithBackoff(func(retryIdx int) error {
+		req, err := http.NewRequest(method, c.objectURL(key, query).String(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		c.sign(req, body)
+		resp, err = c.client.Do(req)
+		if err != nil {
+			logger.LogWarn("S3 %s %s failed [%d]: %v", method, key, retryIdx, err)
+			return err
+		}
+		defer resp.Body.Close()
+		respBody, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		// Server errors are worth retrying, client errors are final.
+		if resp.StatusCode >= 500 {
+			logger.LogWarn("S3 %s %s failed [%d]: %s", method, key, retryIdx, resp.Status)
+			return &ObjectError{resp.StatusCode, fmt.Sprintf("S3 %s %s: %s", method, key, resp.Status)}
+		}
+		return nil
+	}, utils.MAX_RETRY, time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
+
+// s3Error turns an unexpected response into an error with the S3 error code.
+func s3Error(op, key string, resp *http.Response, body []byte) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return &ObjectError{resp.StatusCode, fmt.Sprintf("S3 %s %s: %s: %s (%s)", op, key, resp.Status, e.Code, e.Message)}
+	}
+	return &ObjectError{resp.StatusCode, fmt.Sprintf("S3 %s %s: %s", op, key, resp.Status)}
+}
+
+// sign adds the SigV4 headers to req. The payload hash and date headers are
+// set here; Host and any Content-*, Range and x-amz-* headers are signed.
+func (c *S3Client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	amzDate := now.Format(S3_TIME_FORMAT)
+	payloadHash := EMPTY_SHA256
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || strings.HasPrefix(lk, "content-") || lk == "range" {
+			headers[lk] = strings.Join(v, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, strings.TrimSpace(headers[k]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format("20060102"), c.region, S3_SERVICE)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{S3_SIGN_ALGORITHM, amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), now.Format("20060102"))
+	for _, part := range []string{c.region, S3_SERVICE, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		S3_SIGN_ALGORITHM, c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes every byte of path but the unreserved characters and '/',
+// as SigV4 canonical URIs require.
+func uriEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes q sorted by key, with spaces as %20 as SigV4 wants.
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// Head returns the size and ETag of key, or ErrObjectNotFound.
+func (c *S3Client) Head(key string) (int64, string, error) {
+	resp, body, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, strings.Trim(resp.Header.Get("ETag"), `"`), nil
+	case http.StatusNotFound:
+		return 0, "", ErrObjectNotFound
+	}
+	return 0, "", s3Error("HEAD", key, resp, body)
+}
+
+// Put stores data under key in a single request.
+func (c *S3Client) Put(key string, data []byte, contentType string) error {
+	sum := md5.Sum(data)
+	resp, body, err := c.do(http.MethodPut, key, nil, data, map[string]string{
+		"Content-Type": contentType,
+		"Content-MD5":  base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", key, resp, body)
+	}
+	return nil
+}
+
+// PutMultipart stores data under key in parts of partSize bytes. A failed
+// upload is aborted so that the bucket does not keep its parts.
+func (c *S3Client) PutMultipart(key string, data []byte, contentType string) error {
+	resp, body, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("create multipart upload", key, resp, body)
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &created); err != nil || created.UploadID == "" {
+		return fmt.Errorf("S3 create multipart upload %s: no upload id", key)
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+	uploadErr := func() error {
+		for n, off := 1, 0; off < len(data); n, off = n+1, off+c.partSize {
+			chunk := data[off:min(off+c.partSize, len(data))]
+			sum := md5.Sum(chunk)
+			query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {created.UploadID}}
+			resp, body, err := c.do(http.MethodPut, key, query, chunk, map[string]string{
+				"Content-MD5": base64.StdEncoding.EncodeToString(sum[:]),
+			})
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK {
+				return s3Error(fmt.Sprintf("upload part %d of", n), key, resp, body)
+			}
+			parts = append(parts, part{n, resp.Header.Get("ETag")})
+			logger.LogDebug("Uploaded part %d of %s (%d bytes)", n, key, len(chunk))
+		}
+
+		complete, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"CompleteMultipartUpload"`
+			Parts   []part   `xml:"Part"`
+		}{Parts: parts})
+		if err != nil {
+			return err
+		}
+		resp, body, err := c.do(http.MethodPost, key, url.Values{"uploadId": {created.UploadID}}, complete, nil)
+		if err != nil {
+			return err
+		}
+		// S3 may report a failed completion with a 200 and an Error body.
+		if resp.StatusCode != http.StatusOK || bytes.Contains(body, []byte("<Error>")) {
+			return s3Error("complete multipart upload", key, resp, body)
+		}
+		return nil
+	}()
+	if uploadErr != nil {
+		if _, _, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {created.UploadID}}, nil, nil); err != nil {
+			logger.LogWarn("Could not abort the upload of %s: %v", key, err)
+		}
+		return uploadErr
+	}
+	return nil
+}
+
+// PutObject stores data under key, in parts when it is large.
+func (c *S3Client) PutObject(key string, data []byte, contentType string) error {
+	if int64(len(data)) >= c.multipartThreshold {
+		return c.PutMultipart(key, data, contentType)
+	}
+	return c.Put(key, data, contentType)
+}
+
+// Get returns the content of key, or ErrObjectNotFound.
+func (c *S3Client) Get(key string) ([]byte, error) {
+	resp, body, err := c.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, ErrObjectNotFound
+	}
+	return nil, s3Error("GET", key, resp, body)
+}
+
+// Delete removes key. Deleting a missing key succeeds, as in S3.
+func (c *S3Client) Delete(key string) error {
+	resp, body, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error("DELETE", key, resp, body)
+	}
+	return nil
+}
+
+// List returns every object of the bucket, following continuation tokens.
+func (c *S3Client) List() ([]Object, error) {
+	var (
+		objects []Object
+		token   string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, body, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s3Error("list", c.bucket, resp, body)
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("error parsing the object list: %w", err)
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, Object{Key: o.Key, Size: o.Size, ModTime: o.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
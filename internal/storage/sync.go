@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/tts"
+)
+
+// Kinds of drift between the local cache, the bucket and the records.
+const (
+	NOT_UPLOADED   = "not_uploaded"   // only in the local cache
+	MISSING_OBJECT = "missing_object" // recorded and cached, but not in the bucket
+	UNRECORDED     = "unrecorded"     // cached and uploaded, but not recorded
+	NOT_DOWNLOADED = "not_downloaded" // uploaded and recorded, but not cached
+	ORPHAN_OBJECT  = "orphan_object"  // only in the bucket
+	ORPHAN_RECORD  = "orphan_record"  // only in the records
+	QUEUED_RECORD  = "queued_record"  // uploaded, its record waits in the outbox
+)
+
+// Fixes applied by sync, in the order they run for an item.
+const (
+	FIX_UPLOAD   = "upload"
+	FIX_RECORD   = "record"
+	FIX_DOWNLOAD = "download"
+	FIX_DELETE   = "delete"
+)
+
+var FIXES = []string{FIX_UPLOAD, FIX_RECORD, FIX_DOWNLOAD, FIX_DELETE}
+
+// LocalFile is an audio file of the local cache. Content and Lang are empty
+// when the cache index does not know them.
+type LocalFile struct {
+	Key string
+	// Aliases are the keys the file had before being re-keyed, which its
+	// object and record may still be stored under.
+	Aliases []string
+	Path    string
+	Content string
+	Lang    string
+}
+
+// SyncItem is one key that is not on all three sides.
+type SyncItem struct {
+	Key     string   `json:"key"`
+	Kind    string   `json:"kind"`
+	Fixes   []string `json:"fixes,omitempty"`
+	File    string   `json:"file,omitempty"`
+	Object  string   `json:"object,omitempty"`
+	Record  *Record  `json:"record,omitempty"`
+	Content string   `json:"content,omitempty"`
+	Lang    string   `json:"lang,omitempty"`
+	// Done and Error are filled in when fixes are applied.
+	Done  []string `json:"done,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// SyncReport compares the three sides.
+type SyncReport struct {
+	Local   int `json:"local"`
+	Objects int `json:"objects"`
+	// Ignored counts the objects that are not cached audio, e.g. the feed.
+	Ignored int        `json:"ignored"`
+	Records int        `json:"records"`
+	InSync  int        `json:"in_sync"`
+	Items   []SyncItem `json:"items"`
+}
+
+// Diff matches local files, objects and records by key, the md5 the object
+// and file names start with, and lists what is missing where. Objects and
+// records under an alias of a local file match it. Objects that are not named
+// after a key with an audio extension are left out. Queued are the records
+// waiting in the outbox: what they describe is not missing a record, and no
+// fix may delete their objects.
+func Diff(local []LocalFile, objects []Object, records []Record, queued []Record) SyncReport {
+	r := SyncReport{Local: len(local), Records: len(records)}
+	localByKey := map[string]LocalFile{}
+	aliasOf := map[string]string{}
+	for _, l := range local {
+		localByKey[l.Key] = l
+		for _, a := range l.Aliases {
+			aliasOf[a] = l.Key
+		}
+	}
+	// keyOf returns the current key of k, and whether k is an alias. What is
+	// stored under the current key wins over what is under an alias.
+	keyOf := func(k string) (string, bool) {
+		if current, ok := aliasOf[k]; ok {
+			return current, true
+		}
+		return k, false
+	}
+	objectByKey := map[string]Object{}
+	for _, o := range objects {
+		k := strings.TrimSuffix(o.Key, filepath.Ext(o.Key))
+		if !tts.IsKey(k) || !audio.HasAudioExtension(o.Key) {
+			r.Ignored++
+			continue
+		}
+		r.Objects++
+		k, alias := keyOf(k)
+		if _, found := objectByKey[k]; !found || !alias {
+			objectByKey[k] = o
+		}
+	}
+	recordByKey := map[string]Record{}
+	for _, rec := range records {
+		if rec.Md5 == "" {
+			continue
+		}
+		k, alias := keyOf(rec.Md5)
+		if _, found := recordByKey[k]; !found || !alias {
+			recordByKey[k] = rec
+		}
+	}
+	isQueued := map[string]bool{}
+	for _, rec := range queued {
+		if rec.Md5 != "" {
+			k, _ := keyOf(rec.Md5)
+			isQueued[k] = true
+		}
+	}
+
+	keys := map[string]bool{}
+	for k := range localByKey {
+		keys[k] = true
+	}
+	for k := range objectByKey {
+		keys[k] = true
+	}
+	for k := range recordByKey {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	slices.Sort(sorted)
+
+	for _, key := range sorted {
+		l, hasLocal := localByKey[key]
+		o, hasObject := objectByKey[key]
+		rec, hasRecord := recordByKey[key]
+		if hasLocal && hasObject && hasRecord {
+			r.InSync++
+			continue
+		}
+		it := SyncItem{Key: key, File: l.Path, Content: l.Content, Lang: l.Lang}
+		if hasObject {
+			it.Object = o.Key
+		}
+		if hasRecord {
+			it.Record = &rec
+			it.Content, it.Lang = rec.Content, rec.Language
+		}
+		recordQueued := !hasRecord && isQueued[key]
+		// A record can only be written when the index knows what was read,
+		// and is not when the outbox is about to write it.
+		canRecord := l.Content != "" && l.Lang != "" && !recordQueued
+		switch {
+		case hasLocal && !hasObject && !hasRecord:
+			it.Kind, it.Fixes = NOT_UPLOADED, []string{FIX_UPLOAD}
+			if canRecord {
+				it.Fixes = append(it.Fixes, FIX_RECORD)
+			}
+		case hasLocal && !hasObject:
+			it.Kind, it.Fixes = MISSING_OBJECT, []string{FIX_UPLOAD}
+		case recordQueued:
+			it.Kind = QUEUED_RECORD
+		case hasLocal && !hasRecord:
+			it.Kind = UNRECORDED
+			if canRecord {
+				it.Fixes = []string{FIX_RECORD}
+			}
+		case hasObject && hasRecord:
+			it.Kind, it.Fixes = NOT_DOWNLOADED, []string{FIX_DOWNLOAD}
+		case hasObject:
+			it.Kind, it.Fixes = ORPHAN_OBJECT, []string{FIX_DELETE}
+		default:
+			it.Kind, it.Fixes = ORPHAN_RECORD, []string{FIX_DELETE}
+		}
+		r.Items = append(r.Items, it)
+	}
+	return r
+}
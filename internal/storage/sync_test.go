@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// key returns the cache key named name, in the current scheme.
+func key(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+}
+
+func TestDiff(t *testing.T) {
+	legacy := fmt.Sprintf("%x", md5.Sum([]byte("migrated")))
+	local := []LocalFile{
+		{Key: key("all"), Path: "/c/all.mp3", Content: "a", Lang: "fr-FR"},
+		{Key: key("local"), Path: "/c/local.mp3", Content: "b", Lang: "fr-FR"},
+		{Key: key("untracked"), Path: "/c/untracked.mp3"},
+		{Key: key("norecord"), Path: "/c/norecord.mp3", Content: "c", Lang: "fr-FR"},
+		{Key: key("noobject"), Path: "/c/noobject.mp3"},
+		{Key: key("migrated"), Aliases: []string{legacy}, Path: "/c/migrated.mp3", Content: "e", Lang: "fr-FR"},
+		{Key: key("waiting"), Path: "/c/waiting.mp3", Content: "f", Lang: "fr-FR"},
+	}
+	objects := []Object{
+		{Key: key("all") + ".mp3"}, {Key: key("norecord") + ".mp3"}, {Key: key("remote") + ".mp3"},
+		{Key: key("orphan") + ".wav"}, {Key: legacy + ".mp3"},
+		{Key: "feed.xml"}, {Key: key("notes") + ".txt"}, {Key: key("pending") + ".mp3"},
+	}
+	records := []Record{
+		{Md5: key("all")}, {Md5: key("noobject")}, {Md5: key("remote"), Content: "d", Language: "fr"},
+		{Md5: key("gone")}, {Content: "no md5"}, {Md5: legacy},
+	}
+
+	queued := []Record{{Md5: key("pending")}, {Md5: key("waiting")}}
+
+	r := Diff(local, objects, records, queued)
+	if r.Local != 7 || r.Objects != 6 || r.Ignored != 2 || r.Records != 6 || r.InSync != 2 {
+		t.Errorf("Unexpected counts: %+v", r)
+	}
+	got := map[string]SyncItem{}
+	for _, it := range r.Items {
+		got[it.Key] = it
+	}
+	want := map[string]struct {
+		kind  string
+		fixes []string
+	}{
+		key("local"):     {NOT_UPLOADED, []string{FIX_UPLOAD, FIX_RECORD}},
+		key("untracked"): {NOT_UPLOADED, []string{FIX_UPLOAD}},
+		key("norecord"):  {UNRECORDED, []string{FIX_RECORD}},
+		key("noobject"):  {MISSING_OBJECT, []string{FIX_UPLOAD}},
+		key("remote"):    {NOT_DOWNLOADED, []string{FIX_DOWNLOAD}},
+		key("orphan"):    {ORPHAN_OBJECT, []string{FIX_DELETE}},
+		key("gone"):      {ORPHAN_RECORD, []string{FIX_DELETE}},
+		key("pending"):   {QUEUED_RECORD, nil},
+		key("waiting"):   {NOT_UPLOADED, []string{FIX_UPLOAD}},
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d items, got %d: %+v", len(want), len(got), r.Items)
+	}
+	for key, w := range want {
+		it := got[key]
+		if it.Kind != w.kind || !reflect.DeepEqual(it.Fixes, w.fixes) {
+			t.Errorf("%s: got %s %v, want %s %v", key, it.Kind, it.Fixes, w.kind, w.fixes)
+		}
+	}
+	if it := got[key("remote")]; it.Content != "d" || it.Object != key("remote")+".mp3" {
+		t.Errorf("Expected the record content and object key, got %+v", it)
+	}
+}
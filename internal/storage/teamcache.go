@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// MAX_REMOTE_AUDIO_SIZE bounds a download from the team cache.
+	MAX_REMOTE_AUDIO_SIZE = 64 << 20
+)
+
+// TeamCache reads the audio others published to the public bucket. It is a
+// tts.RemoteCache.
+type TeamCache struct {
+	client *http.Client
+}
+
+func NewTeamCache() *TeamCache {
+	return &TeamCache{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// baseURL returns where the team cache is, or "" when it is disabled. It
+// defaults to the public URL of the storage when that is served over HTTP.
+func (c *TeamCache) baseURL() string {
+	switch config.Cache.Remote {
+	case "":
+		if base := PublicBase(); strings.HasPrefix(base, "http") {
+			return base
+		}
+		return ""
+	case config.REMOTE_CACHE_OFF:
+		return ""
+	}
+	return strings.TrimSuffix(config.Cache.Remote, "/")
+}
+
+// Fetch downloads the object stored under key. A missing object, including
+// the 403 that public buckets answer for it, is tts.ErrNotFound.
+func (c *TeamCache) Fetch(key string) ([]byte, error) {
+	base := c.baseURL()
+	if base == "" {
+		return nil, tts.ErrNotFound
+	}
+	logger.LogDebug("Looking up %s/%s in the team cache", base, key)
+	return c.get(base, key)
+}
+
+// get downloads base/key, bounded by MAX_REMOTE_AUDIO_SIZE.
+func (c *TeamCache) get(base, key string) ([]byte, error) {
+	resp, err := c.client.Get(base + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		return nil, tts.ErrNotFound
+	default:
+		return nil, fmt.Errorf("%s returned %s for %s", base, resp.Status, key)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MAX_REMOTE_AUDIO_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_REMOTE_AUDIO_SIZE {
+		return nil, fmt.Errorf("%s is larger than %d bytes", key, MAX_REMOTE_AUDIO_SIZE)
+	}
+	return data, nil
+}
+
+// FetchPublished downloads published audio from its public URL when that is
+// served over HTTP, and from the configured storage otherwise. A missing key
+// is ErrObjectNotFound.
+func FetchPublished(key string) ([]byte, error) {
+	if base := PublicBase(); strings.HasPrefix(base, "http") {
+		data, err := NewTeamCache().get(base, key)
+		if errors.Is(err, tts.ErrNotFound) {
+			return nil, ErrObjectNotFound
+		}
+		return data, err
+	}
+	backend, err := Configured()
+	if err != nil {
+		return nil, err
+	}
+	return backend.Get(key)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zhasm/tts-reader/internal/tts"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func TestTeamCacheFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abc.mp3":
+			w.Write([]byte("RIFF audio"))
+		case "/private.mp3":
+			w.WriteHeader(http.StatusForbidden)
+		case "/broken.mp3":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func() { config.Cache.Remote = "" }()
+
+	config.Cache.Remote = server.URL + "/"
+	c := NewTeamCache()
+	if data, err := c.Fetch("abc.mp3"); err != nil || string(data) != "RIFF audio" {
+		t.Errorf("Fetch = %q, %v", data, err)
+	}
+	for _, key := range []string{"missing.mp3", "private.mp3"} {
+		if _, err := c.Fetch(key); !errors.Is(err, tts.ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", key, err)
+		}
+	}
+	if _, err := c.Fetch("broken.mp3"); err == nil || errors.Is(err, tts.ErrNotFound) {
+		t.Errorf("Expected a server error, got %v", err)
+	}
+
+	config.Cache.Remote = config.REMOTE_CACHE_OFF
+	if _, err := c.Fetch("abc.mp3"); !errors.Is(err, tts.ErrNotFound) {
+		t.Errorf("Expected a disabled cache to find nothing, got %v", err)
+	}
+}
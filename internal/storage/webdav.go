@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+// WEBDAV_PROPFIND asks for what List needs of each member of the collection.
+const WEBDAV_PROPFIND = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// WebDAVStorage publishes to a WebDAV collection, e.g. on a NAS.
+type WebDAVStorage struct {
+	base      *url.URL
+	user      string
+	password  string
+	publicURL string
+	client    *http.Client
+}
+
+func NewWebDAVStorage(c config.WebDAVConfig, publicURL string) (*WebDAVStorage, error) {
+	base, err := url.Parse(strings.TrimSuffix(c.URL, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q", c.URL)
+	}
+	return &WebDAVStorage{
+		base:      base,
+		user:      c.User,
+		password:  c.Password,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// do sends an authenticated request for key, or for the collection itself
+// when key is empty.
+func (s *WebDAVStorage) do(method, key string, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	u := *s.base
+	u.Path += "/"
+	if key != "" {
+		u.Path += key
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp, data, err
+}
+
+func webdavError(op, key string, resp *http.Response) error {
+	return &ObjectError{resp.StatusCode, fmt.Sprintf("WebDAV %s %s: %s", op, key, resp.Status)}
+}
+
+func (s *WebDAVStorage) Put(path, key string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	resp, _, err := s.do(http.MethodPut, key, data, map[string]string{"Content-Type": audio.MIMEType(path)})
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	return webdavError("put", key, resp)
+}
+
+func (s *WebDAVStorage) Stat(key string) (int64, error) {
+	resp, _, err := s.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// ContentLength is -1 when the server does not send it.
+		return resp.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, ErrObjectNotFound
+	}
+	return 0, webdavError("head", key, resp)
+}
+
+func (s *WebDAVStorage) Get(key string) ([]byte, error) {
+	resp, data, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, ErrObjectNotFound
+	}
+	return nil, webdavError("get", key, resp)
+}
+
+func (s *WebDAVStorage) PublicURL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+func (s *WebDAVStorage) Delete(key string) error {
+	resp, _, err := s.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return webdavError("delete", key, resp)
+}
+
+// webdavMultistatus is the PROPFIND response.
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				Collection    *struct{} `xml:"resourcetype>collection"`
+				ContentLength string    `xml:"getcontentlength"`
+				LastModified  string    `xml:"getlastmodified"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// List returns the files of the collection, one level deep.
+func (s *WebDAVStorage) List() ([]Object, error) {
+	resp, body, err := s.do("PROPFIND", "", []byte(WEBDAV_PROPFIND), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, webdavError("list", s.base.Path, resp)
+	}
+	var ms webdavMultistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, fmt.Errorf("WebDAV list: %w", err)
+	}
+	var objects []Object
+	for _, r := range ms.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			href = r.Href
+		}
+		key := path.Base(strings.TrimSuffix(href, "/"))
+		o := Object{Key: key}
+		collection := strings.HasSuffix(href, "/")
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.Collection != nil {
+				collection = true
+			}
+			o.Size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			o.ModTime, _ = http.ParseTime(ps.Prop.LastModified)
+		}
+		if collection || strings.HasPrefix(key, ".") {
+			continue
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
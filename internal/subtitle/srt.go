@@ -0,0 +1,97 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cue is one timed subtitle.
+type Cue struct {
+	Index int
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Duration returns how long the cue is shown.
+func (c Cue) Duration() time.Duration {
+	return c.End - c.Start
+}
+
+var (
+	timingRegex = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`)
+	// Formatting the synthesizer should not read: <i>, </font>, {\an8}.
+	markupRegex = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+)
+
+// ParseSRT reads SubRip cues. Cue numbers are optional and cues with no text
+// left after removing markup are skipped.
+func ParseSRT(r io.Reader) ([]Cue, error) {
+	var (
+		cues    []Cue
+		cur     *Cue
+		lines   []string
+		lineNum int
+	)
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.Join(strings.Fields(markupRegex.ReplaceAllString(strings.Join(lines, " "), "")), " ")
+			if cur.Text != "" {
+				cues = append(cues, *cur)
+			}
+		}
+		cur, lines = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if m := timingRegex.FindStringSubmatch(line); m != nil {
+			index := len(cues) + 1
+			// The cue number is the last text line before the timing.
+			if n := len(lines); n > 0 {
+				if i, err := strconv.Atoi(strings.TrimSpace(lines[n-1])); err == nil {
+					index = i
+					lines = lines[:n-1]
+				}
+			}
+			if cur != nil {
+				flush()
+			}
+			cur = &Cue{Index: index, Start: parseTimestamp(m[1:5]), End: parseTimestamp(m[5:9])}
+			if cur.End < cur.Start {
+				return nil, fmt.Errorf("line %d: cue ends before it starts", lineNum)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return cues, nil
+}
+
+func parseTimestamp(parts []string) time.Duration {
+	h, _ := strconv.Atoi(parts[0])
+	m, _ := strconv.Atoi(parts[1])
+	s, _ := strconv.Atoi(parts[2])
+	// "5" after the separator is 500ms, as some writers drop trailing zeros.
+	ms, _ := strconv.Atoi((parts[3] + "00")[:3])
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+}
@@ -0,0 +1,41 @@
+package subtitle
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSRT = "\ufeff1\r\n00:00:01,000 --> 00:00:03,500\r\n<i>Bonjour</i> tout\r\nle monde !\r\n\r\n" +
+	"2\n00:00:04.2 --> 00:00:05,000\n{\\an8}Merci.\n\n" +
+	"3\n00:00:06,000 --> 00:00:07,000\n<b></b>\n\n" +
+	"00:01:00,000 --> 00:01:02,000\nSans numéro\n"
+
+func TestParseSRT(t *testing.T) {
+	cues, err := ParseSRT(strings.NewReader(testSRT))
+	if err != nil {
+		t.Fatalf("ParseSRT failed: %v", err)
+	}
+	if len(cues) != 3 {
+		t.Fatalf("Expected 3 cues, got %d: %+v", len(cues), cues)
+	}
+	first := cues[0]
+	if first.Index != 1 || first.Start != time.Second || first.Duration() != 2500*time.Millisecond {
+		t.Errorf("Unexpected first cue: %+v", first)
+	}
+	if first.Text != "Bonjour tout le monde !" {
+		t.Errorf("Text = %q", first.Text)
+	}
+	if cues[1].Text != "Merci." || cues[1].Start != 4200*time.Millisecond {
+		t.Errorf("Unexpected second cue: %+v", cues[1])
+	}
+	if cues[2].Start != time.Minute || cues[2].Text != "Sans numéro" {
+		t.Errorf("Unexpected unnumbered cue: %+v", cues[2])
+	}
+}
+
+func TestParseSRT_Invalid(t *testing.T) {
+	if _, err := ParseSRT(strings.NewReader("1\n00:00:05,000 --> 00:00:01,000\nx\n")); err == nil {
+		t.Error("Expected error for cue ending before it starts")
+	}
+}
@@ -0,0 +1,188 @@
+package text
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MIN_PHRASE_WORDS is the fewest words of a phrase; shorter ones join a
+	// neighbour.
+	MIN_PHRASE_WORDS = 3
+	// MAX_PHRASE_RUNES is the longest phrase of languages written with
+	// spaces, beyond which it is cut at a space.
+	MAX_PHRASE_RUNES = 50
+	// MIN_PHRASE_RUNES and MAX_PHRASE_RUNES_CJK bound the phrases of
+	// languages written without spaces.
+	MIN_PHRASE_RUNES     = 5
+	MAX_PHRASE_RUNES_CJK = 20
+)
+
+// phraseRules tell where the clauses of a language begin and end.
+type phraseRules struct {
+	// before lists the words opening a clause, a phrase breaking before
+	// them. Entries ending with an apostrophe match elided words.
+	before []string
+	// after lists the endings closing a clause in languages written without
+	// spaces, a phrase breaking after them.
+	after []string
+	// particles break the long phrases of languages written without spaces,
+	// after them when a word not starting in hiragana follows.
+	particles string
+	// noSpaces is set for languages written without spaces between words.
+	noSpaces bool
+}
+
+// phraseRulesByLang are the rules of the languages known by their short
+// name, those of the config.
+var phraseRulesByLang = map[string]phraseRules{
+	"fr": {before: []string{
+		"et", "mais", "ou", "donc", "car", "or", "puis",
+		"qui", "que", "qu'", "dont", "où",
+		"parce que", "parce qu'", "puisque", "puisqu'", "lorsque", "lorsqu'", "quand",
+		"si", "comme", "alors que", "alors qu'", "tandis que", "tandis qu'", "bien que", "bien qu'",
+		"pour", "afin de", "afin que", "sans",
+	}},
+	"pl": {before: []string{
+		"i", "a", "ale", "lecz", "oraz", "lub", "albo", "czy", "więc", "dlatego",
+		"że", "żeby", "aby", "bo", "ponieważ", "gdyż", "gdy", "kiedy", "jeśli", "jeżeli", "chociaż", "choć",
+		"który", "która", "które", "którego", "której", "którym", "którzy", "gdzie",
+	}},
+	"jp": {noSpaces: true, after: []string{
+		"ので", "のに", "けれども", "けれど", "けど", "ながら", "ために",
+		"ですが", "ますが", "ましたが", "ませんが", "ですから", "ますから", "ましたから", "だから",
+	}, particles: "はがをにでと"},
+}
+
+// Phrases splits a sentence into the short phrases of a shadowing drill: at
+// commas and other soft punctuation, and at the clause boundaries of lang,
+// e.g. before "parce que" in French or after "ので" in Japanese. Phrases too
+// short to be worth repeating alone join a neighbour.
+func Phrases(sentence, lang string) []string {
+	rules := phraseRulesByLang[lang]
+	if rules.noSpaces {
+		return joinShort(phrasesNoSpaces(sentence, rules), "", func(p string) bool {
+			return utf8.RuneCountInString(p) < MIN_PHRASE_RUNES
+		})
+	}
+	var phrases []string
+	for _, p := range phrasesSpaced(sentence, rules) {
+		phrases = append(phrases, splitLong(p, MAX_PHRASE_RUNES)...)
+	}
+	return joinShort(phrases, " ", func(p string) bool {
+		return len(strings.Fields(p)) < MIN_PHRASE_WORDS
+	})
+}
+
+func phrasesSpaced(sentence string, rules phraseRules) []string {
+	var (
+		phrases []string
+		cur     []string
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			phrases = append(phrases, strings.Join(cur, " "))
+			cur = nil
+		}
+	}
+	words := strings.Fields(sentence)
+	for i, w := range words {
+		if len(cur) > 0 && opensClause(words[i:], rules.before) {
+			flush()
+		}
+		cur = append(cur, w)
+		if r, _ := utf8.DecodeLastRuneInString(w); strings.ContainsRune(softBreaks+"—–", r) {
+			flush()
+		}
+	}
+	flush()
+	return phrases
+}
+
+// opensClause reports whether words start with one of the clause openers.
+func opensClause(words []string, openers []string) bool {
+	for _, o := range openers {
+		fields := strings.Fields(o)
+		if len(fields) > len(words) {
+			continue
+		}
+		last := len(fields) - 1
+		matched := true
+		for j, f := range fields {
+			w := strings.ToLower(strings.TrimLeftFunc(words[j], unicode.IsPunct))
+			w = strings.ReplaceAll(w, "’", "'")
+			if j == last && strings.HasSuffix(f, "'") {
+				matched = matched && strings.HasPrefix(w, f) && len(w) > len(f)
+			} else {
+				matched = matched && strings.TrimRightFunc(w, unicode.IsPunct) == f
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func phrasesNoSpaces(sentence string, rules phraseRules) []string {
+	var (
+		phrases []string
+		cur     strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			phrases = append(phrases, s)
+		}
+		cur.Reset()
+	}
+	runes := []rune(sentence)
+	for i, r := range runes {
+		cur.WriteRune(r)
+		n := utf8.RuneCountInString(cur.String())
+		if strings.ContainsRune(softBreaks, r) || unicode.IsSpace(r) {
+			flush()
+			continue
+		}
+		// A clause ending only counts before more words, not punctuation.
+		if i+1 == len(runes) || unicode.IsPunct(runes[i+1]) || n < MIN_PHRASE_RUNES {
+			continue
+		}
+		switch {
+		case slices.ContainsFunc(rules.after, func(ending string) bool { return strings.HasSuffix(cur.String(), ending) }):
+			flush()
+		case n >= MAX_PHRASE_RUNES_CJK/2 && strings.ContainsRune(rules.particles, r) && !unicode.Is(unicode.Hiragana, runes[i+1]):
+			flush()
+		case n >= MAX_PHRASE_RUNES_CJK:
+			flush()
+		}
+	}
+	flush()
+	return phrases
+}
+
+// joinShort merges the phrases that are too short into the next one, or the
+// previous one at the end.
+func joinShort(phrases []string, sep string, short func(string) bool) []string {
+	var out []string
+	pending := ""
+	for _, p := range phrases {
+		if pending != "" {
+			p = pending + sep + p
+			pending = ""
+		}
+		if short(p) {
+			pending = p
+			continue
+		}
+		out = append(out, p)
+	}
+	if pending != "" {
+		if len(out) == 0 {
+			return []string{pending}
+		}
+		out[len(out)-1] += sep + pending
+	}
+	return out
+}
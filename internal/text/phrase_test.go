@@ -0,0 +1,36 @@
+package text
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPhrases(t *testing.T) {
+	tests := []struct {
+		name, lang, sentence string
+		want                 []string
+	}{
+		{"fr clauses", "fr", "Je reste à la maison parce que il pleut beaucoup et que je suis fatigué.",
+			[]string{"Je reste à la maison", "parce que il pleut beaucoup", "et que je suis fatigué."}},
+		{"fr punctuation and elision", "fr", "Hier soir, mon frère m'a dit qu'il viendrait demain matin.",
+			[]string{"Hier soir, mon frère m'a dit", "qu'il viendrait demain matin."}},
+		{"fr short clause joins", "fr", "Il mange et boit du vin rouge.",
+			[]string{"Il mange et boit du vin rouge."}},
+		{"pl", "pl", "Wiem, że on nie przyjdzie dzisiaj, bo jest bardzo chory.",
+			[]string{"Wiem, że on nie przyjdzie dzisiaj,", "bo jest bardzo chory."}},
+		{"jp", "jp", "雨が降っているので、今日は家で本を読みます。",
+			[]string{"雨が降っているので、", "今日は家で本を読みます。"}},
+		{"jp connective", "jp", "時間がありませんが明日もう一度来ます。",
+			[]string{"時間がありませんが", "明日もう一度来ます。"}},
+		{"jp word kept whole", "jp", "とてもあたらしいです。", []string{"とてもあたらしいです。"}},
+		{"other language, punctuation only", "en", "When it rains, we stay at home and read.",
+			[]string{"When it rains,", "we stay at home and read."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Phrases(tt.sentence, tt.lang); !slices.Equal(got, tt.want) {
+				t.Errorf("Phrases = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
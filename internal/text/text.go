@@ -0,0 +1,150 @@
+package text
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DEFAULT_CHUNK_SIZE is the longest text, in runes, sent to the TTS API in
+	// one request.
+	DEFAULT_CHUNK_SIZE = 600
+)
+
+var (
+	urlRegex = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'()\[\]]+`)
+
+	// sentenceEnds are the runes that end a sentence when followed by a space,
+	// a closing quote or the end of the text.
+	sentenceEnds = ".!?…。！？"
+
+	// softBreaks are the runes an over-long sentence may be split after.
+	softBreaks = ",;:、，；："
+)
+
+// IsURL reports whether s consists of a single http(s) URL.
+func IsURL(s string) bool {
+	s = strings.TrimSpace(s)
+	loc := urlRegex.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+// VerbalizeURLs replaces every URL inside s by its host name, so that "see
+// https://www.example.com/a?b=c" is read as "see example.com".
+func VerbalizeURLs(s string) string {
+	return urlRegex.ReplaceAllStringFunc(s, func(raw string) string {
+		// Trailing punctuation belongs to the sentence, not to the URL.
+		trimmed := strings.TrimRight(raw, ".,;:!?")
+		tail := raw[len(trimmed):]
+		u, err := url.Parse(trimmed)
+		if err != nil || u.Hostname() == "" {
+			return tail
+		}
+		return strings.TrimPrefix(u.Hostname(), "www.") + tail
+	})
+}
+
+// Sentences splits s into sentences at sentence-ending punctuation and at
+// line breaks. Whitespace inside each sentence is collapsed.
+func Sentences(s string) []string {
+	var (
+		sentences []string
+		cur       strings.Builder
+	)
+	flush := func() {
+		if sentence := strings.Join(strings.Fields(cur.String()), " "); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		cur.Reset()
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if r == '\n' {
+			flush()
+			continue
+		}
+		cur.WriteRune(r)
+		if !strings.ContainsRune(sentenceEnds, r) {
+			continue
+		}
+		// Keep runs like "?!" or "..." and closing quotes with the sentence.
+		next := i + 1
+		for next < len(runes) && (strings.ContainsRune(sentenceEnds, runes[next]) || strings.ContainsRune(`"'»”)」』`, runes[next])) {
+			next++
+		}
+		if next == i+1 && (next == len(runes) || unicode.IsSpace(runes[next]) || r >= 0x3000) {
+			flush()
+		}
+	}
+	flush()
+	return sentences
+}
+
+// Chunks groups the sentences of s into pieces of at most maxRunes runes.
+// Sentences longer than maxRunes are split at commas or, failing that, at
+// spaces.
+func Chunks(s string, maxRunes int) []string {
+	if maxRunes <= 0 {
+		maxRunes = DEFAULT_CHUNK_SIZE
+	}
+	var (
+		chunks []string
+		cur    string
+	)
+	add := func(piece string) {
+		switch {
+		case cur == "":
+			cur = piece
+		case utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(piece) <= maxRunes:
+			cur += " " + piece
+		default:
+			chunks = append(chunks, cur)
+			cur = piece
+		}
+	}
+	for _, sentence := range Sentences(s) {
+		for _, piece := range splitLong(sentence, maxRunes) {
+			add(piece)
+		}
+	}
+	if cur != "" {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// splitLong cuts s into pieces of at most maxRunes runes, preferring soft
+// breaks over spaces and spaces over arbitrary positions.
+func splitLong(s string, maxRunes int) []string {
+	var pieces []string
+	runes := []rune(s)
+	for len(runes) > maxRunes {
+		cut := -1
+		for _, breaks := range []func(rune) bool{
+			func(r rune) bool { return strings.ContainsRune(softBreaks, r) },
+			unicode.IsSpace,
+		} {
+			for i := maxRunes - 1; i > maxRunes/2; i-- {
+				if breaks(runes[i]) {
+					cut = i + 1
+					break
+				}
+			}
+			if cut > 0 {
+				break
+			}
+		}
+		if cut < 0 {
+			cut = maxRunes
+		}
+		pieces = append(pieces, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		pieces = append(pieces, string(runes))
+	}
+	return pieces
+}
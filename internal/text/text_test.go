@@ -0,0 +1,45 @@
+package text
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestIsURL(t *testing.T) {
+	if !IsURL(" https://example.com/article?id=1 ") {
+		t.Error("Expected a bare URL to be detected")
+	}
+	if IsURL("read https://example.com now") {
+		t.Error("Expected text containing a URL not to be a URL")
+	}
+}
+
+func TestVerbalizeURLs(t *testing.T) {
+	got := VerbalizeURLs("Voir https://www.lemonde.fr/article.html, merci.")
+	if got != "Voir lemonde.fr, merci." {
+		t.Errorf("VerbalizeURLs = %q", got)
+	}
+}
+
+func TestSentences(t *testing.T) {
+	got := Sentences("Bonjour. Ça va?  Oui...\nMerci 3.5 fois！次です。")
+	want := []string{"Bonjour.", "Ça va?", "Oui...", "Merci 3.5 fois！", "次です。"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Sentences = %q, want %q", got, want)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	s := strings.Repeat("Une phrase assez courte. ", 10) + strings.Repeat("mot ", 40)
+	chunks := Chunks(s, 60)
+	for _, c := range chunks {
+		if n := utf8.RuneCountInString(c); n > 60 {
+			t.Errorf("Chunk too long (%d runes): %q", n, c)
+		}
+	}
+	if joined := strings.Join(chunks, " "); strings.Join(strings.Fields(joined), " ") != strings.Join(strings.Fields(s), " ") {
+		t.Error("Chunks lost or reordered text")
+	}
+}
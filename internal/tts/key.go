@@ -0,0 +1,95 @@
+package tts
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+const (
+	// KEY_VERSION is bumped whenever KeyParams or its encoding changes, so that
+	// audio synthesized under the old schema is never mistaken for new audio.
+	KEY_VERSION = 2
+	PROVIDER    = "azure"
+)
+
+// KeyParams are every parameter that changes the synthesized audio. Their
+// JSON encoding, in field order, is what the cache key hashes.
+type KeyParams struct {
+	Version  int    `json:"version"`
+	Provider string `json:"provider"`
+	Format   string `json:"format"`
+	Lang     string `json:"lang"`
+	Voice    string `json:"voice"`
+	Gender   string `json:"gender"`
+	Style    string `json:"style"`
+	Pitch    string `json:"pitch"`
+	// Speed is the exact decimal sent to the API, so 0.85 and 0.8 differ.
+	Speed   string `json:"speed"`
+	Content string `json:"content"`
+}
+
+// Params returns the key parameters of req.
+func (req TTSRequest) Params() KeyParams {
+	return KeyParams{
+		Version:  KEY_VERSION,
+		Provider: PROVIDER,
+		Format:   X_MICROSOFT_OUTPUTFORMAT,
+		Lang:     req.Lang,
+		Voice:    req.Reader,
+		Gender:   req.Gender,
+		Style:    req.Style,
+		Pitch:    req.Pitch,
+		Speed:    strconv.FormatFloat(req.Speed, 'f', -1, 64),
+		Content:  req.Content,
+	}
+}
+
+// Key returns the hex SHA-256 of the canonical encoding of p.
+func (p KeyParams) Key() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		// A struct of strings and an int always encodes.
+		panic(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// LegacyKey returns the MD5 key used before KEY_VERSION 2, or "" when req
+// differs from every request that scheme could describe: it only knew the
+// default style and pitch, and rounded the speed to one decimal. It sent
+// every language as the default gender, which the named voice overrides.
+func LegacyKey(req TTSRequest) string {
+	speed := fmt.Sprintf("%.1f", req.Speed)
+	if rounded, _ := strconv.ParseFloat(speed, 64); rounded != req.Speed || req.Style != "" || req.Pitch != "" {
+		return ""
+	}
+	// the ending '\n' is on purpose, please do not delete.
+	keyData := fmt.Sprintf("%s-%s-%s-%s-%s\n", req.Lang, req.Reader, config.DEFAULT_GENDER, req.Content, speed)
+	return fmt.Sprintf("%x", md5.Sum([]byte(keyData)))
+}
+
+// IsLegacyKey reports whether key was made by the MD5 scheme.
+func IsLegacyKey(key string) bool {
+	return len(key) == md5.Size*2
+}
+
+// IsKey reports whether key is a cache key, of either scheme.
+func IsKey(key string) bool {
+	if len(key) != md5.Size*2 && len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// rekey sets the key and destination of req from its parameters.
+func (req *TTSRequest) rekey() {
+	req.Md5 = req.Params().Key()
+	req.Dest = fmt.Sprintf("%s/%s.mp3", config.TTS_PATH, req.Md5)
+}
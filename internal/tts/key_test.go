@@ -0,0 +1,106 @@
+package tts
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func TestKey(t *testing.T) {
+	base := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 0.8)
+	if len(base.Md5) != 64 || IsLegacyKey(base.Md5) {
+		t.Errorf("Expected a SHA-256 key, got %s", base.Md5)
+	}
+	if again := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 0.8); again.Md5 != base.Md5 {
+		t.Error("Expected the same key for the same parameters")
+	}
+
+	variants := map[string]func(r *TTSRequest){
+		"speed":  func(r *TTSRequest) { r.Speed = 0.85 },
+		"gender": func(r *TTSRequest) { r.Gender = "Female" },
+		"style":  func(r *TTSRequest) { r.Style = "cheerful" },
+		"pitch":  func(r *TTSRequest) { r.Pitch = "+5%" },
+		// Fields must not run into each other.
+		"boundary": func(r *TTSRequest) { r.Reader, r.Content = "fr-FR-DeniseNeural-Bonjour", "" },
+	}
+	for name, change := range variants {
+		req := base
+		change(&req)
+		req.rekey()
+		if req.Md5 == base.Md5 {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+}
+
+func TestLegacyKey(t *testing.T) {
+	req := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 0.8)
+	want := fmt.Sprintf("%x", md5.Sum([]byte("fr-FR-fr-FR-DeniseNeural-Male-Bonjour-0.8\n")))
+	if got := LegacyKey(req); got != want || !IsLegacyKey(got) {
+		t.Errorf("LegacyKey = %s, want %s", got, want)
+	}
+	// The MD5 scheme sent every language as Male.
+	pl := NewTTSRequest("Dzień dobry", "pl-PL", "pl-PL-AgnieszkaNeural", 1.0)
+	want = fmt.Sprintf("%x", md5.Sum([]byte("pl-PL-pl-PL-AgnieszkaNeural-Male-Dzień dobry-1.0\n")))
+	if got := LegacyKey(pl); pl.Gender != "Female" || got != want {
+		t.Errorf("LegacyKey of a %s voice = %s, want %s", pl.Gender, got, want)
+	}
+	req.Speed = 0.85
+	if got := LegacyKey(req); got != "" {
+		t.Errorf("Expected no legacy key for a speed the MD5 scheme rounded, got %s", got)
+	}
+}
+
+func TestReqTTS_AdoptsLegacyFile(t *testing.T) {
+	config.TTS_PATH = t.TempDir()
+	req := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 1.0)
+	legacy := LegacyKey(req)
+	old := config.TTS_PATH + "/" + legacy + ".mp3"
+	if err := os.WriteFile(old, audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No API is reachable: the request must be served from the legacy file.
+	if ok, err := ReqTTS(req); !ok || err != nil {
+		t.Fatalf("ReqTTS failed: ok=%v, err=%v", ok, err)
+	}
+	if _, err := os.Stat(req.Dest); err != nil {
+		t.Errorf("Expected the legacy file at %s: %v", req.Dest, err)
+	}
+	ix, err := cache.Load(config.TTS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ix.Find(legacy)
+	if err != nil || e.Key != req.Md5 || !strings.HasSuffix(e.File, req.Md5+".mp3") {
+		t.Errorf("Expected the MD5 to alias the new key, got %+v, err %v", e, err)
+	}
+}
+
+func TestReqTTS_QuarantinesCorruptFile(t *testing.T) {
+	config.TTS_PATH = t.TempDir()
+	req := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 0.85)
+	// A truncated download that the old size check accepted.
+	wav := audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second))
+	if err := os.WriteFile(req.Dest, wav[:len(wav)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if isCached(req) {
+		t.Fatal("Expected a truncated file not to count as cached")
+	}
+	if _, err := os.Stat(req.Dest); !os.IsNotExist(err) {
+		t.Error("Expected the corrupt file to be moved away")
+	}
+	quarantined, _ := os.ReadDir(config.TTS_PATH + "/" + cache.QUARANTINE_DIR)
+	if len(quarantined) != 1 || !strings.HasPrefix(quarantined[0].Name(), req.Md5) {
+		t.Errorf("Expected the file in quarantine, got %v", quarantined)
+	}
+}
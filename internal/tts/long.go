@@ -0,0 +1,77 @@
+package tts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
+	"github.com/zhasm/tts-reader/internal/text"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/config"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+const (
+	// CHUNK_PAUSE is the silence inserted between the chunks of a long text.
+	CHUNK_PAUSE = 300 * time.Millisecond
+)
+
+// Synthesize makes sure req.Dest holds the audio of req. Content longer than
+// text.DEFAULT_CHUNK_SIZE runes is split at sentence boundaries; every chunk
+// is requested and cached on its own and the chunks are joined into req.Dest.
+func Synthesize(req TTSRequest) (bool, error) {
+	if utf8.RuneCountInString(req.Content) <= text.DEFAULT_CHUNK_SIZE {
+		return ReqTTS(req)
+	}
+	if !config.OverWrite && isCached(req) {
+		return true, nil
+	}
+	unlock, err := cache.Lock(filepath.Dir(req.Dest), req.Md5)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if !config.OverWrite && isCached(req) {
+		return true, nil
+	}
+
+	chunks := text.Chunks(req.Content, text.DEFAULT_CHUNK_SIZE)
+	logger.LogInfo("Long text split into %d chunks", len(chunks))
+	var parts []audio.PCM
+	for i, chunk := range chunks {
+		chunkReq := req
+		chunkReq.Content = chunk
+		chunkReq.rekey()
+		logger.LogDebug("Chunk %d/%d: %s", i+1, len(chunks), chunkReq.Md5)
+		if ok, err := ReqTTS(chunkReq); err != nil || !ok {
+			return false, fmt.Errorf("chunk %d/%d failed: %w", i+1, len(chunks), err)
+		}
+		pcm, err := audio.ReadWAV(chunkReq.Dest)
+		if err != nil {
+			return false, fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		if i > 0 {
+			parts = append(parts, audio.Silence(pcm.Format, CHUNK_PAUSE))
+		}
+		parts = append(parts, pcm)
+	}
+	joined, err := audio.Concat(parts...)
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.Dest), 0755); err != nil {
+		return false, err
+	}
+	if err := utils.WriteFileAtomic(req.Dest, audio.EncodeWAV(joined), 0644); err != nil {
+		logger.LogError("Error writing file: %v", err)
+		return false, err
+	}
+	logger.LogDebug("Joined %d chunks (%.1fs) into %s", len(chunks), joined.Duration().Seconds(), req.Dest)
+	recordInCache(req)
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package tts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/text"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+func TestSynthesize_LongText(t *testing.T) {
+	config.TTS_PATH = t.TempDir()
+	content := strings.Repeat("Une phrase pour remplir le texte. ", 40)
+	chunks := text.Chunks(content, text.DEFAULT_CHUNK_SIZE)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+
+	// Seed the cache with a second of audio per chunk so no request is sent.
+	for _, chunk := range chunks {
+		req := NewTTSRequest(chunk, "fr-FR", "fr-FR-DeniseNeural", 0.8)
+		if err := os.MkdirAll(filepath.Dir(req.Dest), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(req.Dest, audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := NewTTSRequest(content, "fr-FR", "fr-FR-DeniseNeural", 0.8)
+	if ok, err := Synthesize(req); !ok || err != nil {
+		t.Fatalf("Synthesize failed: ok=%v, err=%v", ok, err)
+	}
+	got, err := audio.FileDuration(req.Dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Duration(len(chunks))*time.Second + time.Duration(len(chunks)-1)*CHUNK_PAUSE
+	if got != want {
+		t.Errorf("Duration = %v, want %v", got, want)
+	}
+}
+
+func TestEscapeSSML(t *testing.T) {
+	if got := escapeSSML("Fish & <chips>"); got != "Fish &amp; &lt;chips&gt;" {
+		t.Errorf("escapeSSML = %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package tts
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/utils"
+	"github.com/zhasm/tts-reader/pkg/logger"
+)
+
+// ErrNotFound is returned by a RemoteCache that does not hold a key.
+var ErrNotFound = errors.New("not found in the remote cache")
+
+// RemoteCache is a store of audio shared with others, such as the bucket the
+// team uploads to, checked before spending provider quota.
+type RemoteCache interface {
+	// Fetch returns the object stored under key, e.g. "<md5>.mp3".
+	Fetch(key string) ([]byte, error)
+}
+
+// Remote is consulted by ReqTTS when set. It lives in this package as a hook
+// because the stores it is implemented with depend on TTSRequest.
+var Remote RemoteCache
+
+// fetchRemote downloads the audio of req from Remote into req.Dest. Audio
+// published under the legacy key is looked up too.
+func fetchRemote(req TTSRequest) bool {
+	if Remote == nil {
+		return false
+	}
+	ext := filepath.Ext(req.Dest)
+	keys := []string{req.Md5}
+	if legacy := LegacyKey(req); legacy != "" {
+		keys = append(keys, legacy)
+	}
+	for _, key := range keys {
+		data, err := Remote.Fetch(key + ext)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.LogDebug("Remote cache lookup of %s failed: %v", key, err)
+			return false
+		}
+		if _, err := audio.ProbeBytes(data); err != nil {
+			logger.LogWarn("Ignoring invalid audio %s in the remote cache: %v", key+ext, err)
+			continue
+		}
+		if err := utils.WriteFileAtomic(req.Dest, data, 0644); err != nil {
+			logger.LogWarn("Could not save audio from the remote cache: %v", err)
+			return false
+		}
+		return true
+	}
+	return false
+}
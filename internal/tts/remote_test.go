@@ -0,0 +1,56 @@
+package tts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/pkg/config"
+)
+
+// fakeRemote serves objects from memory and records the keys asked for.
+type fakeRemote struct {
+	objects map[string][]byte
+	asked   []string
+}
+
+func (f *fakeRemote) Fetch(key string) ([]byte, error) {
+	f.asked = append(f.asked, key)
+	if data, ok := f.objects[key]; ok {
+		return data, nil
+	}
+	return nil, ErrNotFound
+}
+
+func TestReqTTS_TeamCache(t *testing.T) {
+	config.TTS_PATH = t.TempDir()
+	defer func() { Remote = nil }()
+	wav := audio.EncodeWAV(audio.Silence(audio.DefaultFormat, time.Second))
+
+	req := NewTTSRequest("Bonjour", "fr-FR", "fr-FR-DeniseNeural", 0.8)
+	legacy := NewTTSRequest("Salut", "fr-FR", "fr-FR-DeniseNeural", 0.8)
+	remote := &fakeRemote{objects: map[string][]byte{
+		req.Md5 + ".mp3":           wav,
+		LegacyKey(legacy) + ".mp3": wav,
+	}}
+	Remote = remote
+
+	// No API is reachable: both requests must be served by the team cache.
+	for _, r := range []TTSRequest{req, legacy} {
+		if ok, err := ReqTTS(r); !ok || err != nil {
+			t.Fatalf("ReqTTS(%q) failed: ok=%v, err=%v", r.Content, ok, err)
+		}
+		if valid, err := IsAudioFileValid(r.Dest); !valid {
+			t.Errorf("Expected %s to be downloaded: %v", r.Dest, err)
+		}
+	}
+	if len(remote.asked) != 3 {
+		t.Errorf("Expected the new key, then the legacy one for the second request, got %v", remote.asked)
+	}
+
+	// Once downloaded, the local copy is used.
+	remote.asked = nil
+	if ok, _ := ReqTTS(req); !ok || len(remote.asked) != 0 {
+		t.Errorf("Expected a local cache hit, remote was asked %v", remote.asked)
+	}
+}
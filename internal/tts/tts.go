@@ -1,14 +1,18 @@
 package tts
 
 import (
-	"crypto/md5"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/zhasm/tts-reader/internal/audio"
+	"github.com/zhasm/tts-reader/internal/cache"
 	"github.com/zhasm/tts-reader/internal/utils"
 	"github.com/zhasm/tts-reader/pkg/config"
 	"github.com/zhasm/tts-reader/pkg/logger"
@@ -20,8 +24,16 @@ type TTSRequest struct {
 	Reader  string
 	Speed   float64
 	Gender  string
+	Style   string // speaking style of the voice, e.g. "cheerful"; empty for the default
+	Pitch   string // prosody pitch, e.g. "+5%"; empty for the default
 	Dest    string // the output path
-	Md5     string
+	// Md5 is the cache key, named after the MD5 scheme it replaced. It keeps
+	// its name because records and object keys are stored under it.
+	Md5 string
+	// Tags and Note organise the reading for study. They are stored with
+	// its record and history but are not part of the key.
+	Tags []string
+	Note string
 }
 
 const (
@@ -32,39 +44,48 @@ const (
 	HTTP_REQEUEST_API          = "https://eastasia.tts.speech.microsoft.com/cognitiveservices/v1"
 )
 
-func NewTTSRequest(content, lang, reader string, speed float64) TTSRequest {
-	gender := "Male" // default gender
-
-	// Create a unique key based on parameters
-	// the ending '\n' is on purpose, please do not delete.
-	keyData := fmt.Sprintf("%s-%s-%s-%s-%.1f\n", lang, reader, gender, content, speed)
-	logger.LogDebug("Key data string: '%s'", keyData)
-	key := fmt.Sprintf("%x", md5.Sum([]byte(keyData)))
-	logger.LogDebug("Generated MD5: %s", key)
-
-	// Create destination path
-	dest := fmt.Sprintf("%s/%s.mp3", config.TTS_PATH, key)
+// httpClient is shared by all requests so that long sessions reuse their
+// connections to the TTS API.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
 
-	return TTSRequest{
+func NewTTSRequest(content, lang, reader string, speed float64) TTSRequest {
+	req := TTSRequest{
 		Content: content,
 		Lang:    lang,
 		Reader:  reader,
 		Speed:   speed,
-		Gender:  gender,
-		Dest:    dest,
-		Md5:     key,
+		Gender:  config.LangGender(lang),
 	}
+	req.rekey()
+	logger.LogDebug("Generated key: %s", req.Md5)
+	return req
 }
 
 func ReqTTS(req TTSRequest) (bool, error) {
 
 	// Check if destination file already exists and is valid
+	if !config.OverWrite && isCached(req) {
+		logger.LogInfo("Audio from the local cache: %s", shortKey(req.Md5))
+		return true, nil
+	}
+
+	// Another process asking for the same audio holds the lock until its file
+	// is written, which is then used instead of a second request.
+	unlock, err := cache.Lock(filepath.Dir(req.Dest), req.Md5)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
 	if !config.OverWrite {
-		if valid, _ := IsAudioFileValid(req.Dest); valid {
-			// Get file info for logging
-			if fileInfo, err := os.Stat(req.Dest); err == nil {
-				logger.LogDebug("File already exists: %s (size: %d bytes)", req.Dest, fileInfo.Size())
-			}
+		if isCached(req) {
+			logger.LogInfo("Audio from the local cache: %s", shortKey(req.Md5))
+			return true, nil
+		}
+		if fetchRemote(req) {
+			logger.LogInfo("Audio from the team cache: %s", shortKey(req.Md5))
+			recordInCache(req)
 			return true, nil
 		}
 	}
@@ -76,22 +97,12 @@ func ReqTTS(req TTSRequest) (bool, error) {
 	logger.LogDebug("API Key set: %t", config.TTS_API_KEY != "")
 
 	// cURL (POST https://eastasia.tts.speech.microsoft.com/cognitiveservices/v1)
-	ssmlBody := fmt.Sprintf(`
-		<speak version="1.0" xml:lang="%s">
-		<voice xml:lang="%s" xml:gender="Male" name="%s">
-		<prosody rate="%f">%s</prosody>
-		</voice>
-		</speak>`, req.Lang, req.Lang, req.Reader, req.Speed, req.Content)
+	ssmlBody := buildSSML(req)
 
 	logger.LogDebug("Generated SSML:%s\n", ssmlBody)
 
 	body := strings.NewReader(ssmlBody)
 
-	// Create client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	httpHeaders := map[string]string{
 		"X-Microsoft-Outputformat":  X_MICROSOFT_OUTPUTFORMAT,
 		"Content-Type":              HTTP_REQEUEST_CONTENT_TYPE,
@@ -119,7 +130,7 @@ func ReqTTS(req TTSRequest) (bool, error) {
 	}
 
 	// Use the new utility function for logging and sending the request
-	resp, err := utils.HTTPRequest(client, httpReq)
+	resp, err := utils.HTTPRequest(httpClient, httpReq)
 
 	if err != nil {
 		return false, err
@@ -140,7 +151,7 @@ func ReqTTS(req TTSRequest) (bool, error) {
 
 	if resp.StatusCode != 200 {
 		logger.LogError("Requesting TTS Error!")
-		os.Exit(1)
+		return false, fmt.Errorf("TTS API returned %s", resp.Status)
 	}
 
 	// Display Results
@@ -159,6 +170,12 @@ func ReqTTS(req TTSRequest) (bool, error) {
 		logger.LogDebug("Response Body (first 1000 chars): %s...", string(respBody[:1000]))
 	}
 
+	// Never cache a body that is not complete audio
+	if _, err := audio.ProbeBytes(respBody); err != nil {
+		logger.LogError("TTS API returned invalid audio: %v", err)
+		return false, fmt.Errorf("TTS API returned invalid audio: %w", err)
+	}
+
 	// Write audio content to destination file
 	logger.LogDebug("Writing audio to: %s", req.Dest)
 
@@ -170,28 +187,124 @@ func ReqTTS(req TTSRequest) (bool, error) {
 	}
 
 	// Write the audio data to file
-	if err := os.WriteFile(req.Dest, respBody, 0644); err != nil {
+	if err := utils.WriteFileAtomic(req.Dest, respBody, 0644); err != nil {
 		logger.LogError("Error writing file: %v", err)
 		return false, err
 	}
 
 	logger.LogDebug("Successfully wrote %d bytes to %s", len(respBody), req.Dest)
+	logger.LogInfo("Audio from fresh synthesis: %s", shortKey(req.Md5))
+	recordInCache(req)
 	return true, nil
 }
 
-// IsAudioFileValid checks if the audio file exists and is valid
+// isCached reports whether req.Dest already holds the audio of req, adopting
+// a file cached under the legacy key if there is one.
+// A corrupt file is quarantined, so that the audio is requested again.
+func isCached(req TTSRequest) bool {
+	valid, err := IsAudioFileValid(req.Dest)
+	if valid {
+		// Get file info for logging
+		if fileInfo, err := os.Stat(req.Dest); err == nil {
+			logger.LogDebug("File already exists: %s (size: %d bytes)", req.Dest, fileInfo.Size())
+		}
+		return true
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		if qerr := cache.Quarantine(filepath.Dir(req.Dest), req.Dest); qerr != nil {
+			logger.LogWarn("Could not quarantine %s: %v", req.Dest, qerr)
+		}
+		return false
+	}
+	return adoptLegacyFile(req)
+}
+
+// shortKey abbreviates a cache key for logs.
+func shortKey(key string) string {
+	return key[:min(len(key), 12)]
+}
+
+// recordInCache indexes the freshly written audio of req in the cache of its
+// directory. Failures are only logged, as the audio itself is fine.
+func recordInCache(req TTSRequest) {
+	e, err := cache.NewEntry(req.Md5, req.Dest)
+	if err != nil {
+		logger.LogWarn("Could not index %s: %v", req.Dest, err)
+		return
+	}
+	e.Content = req.Content
+	e.Lang = req.Lang
+	e.Voice = req.Reader
+	e.Speed = req.Speed
+	e.Created = time.Now()
+	if err := cache.Record(filepath.Dir(req.Dest), e); err != nil {
+		logger.LogWarn("Could not update the cache index: %v", err)
+	}
+}
+
+// buildSSML returns the request body for req. Style and pitch are only
+// written when set, so that default requests stay as they always were.
+func buildSSML(req TTSRequest) string {
+	prosody := fmt.Sprintf(`<prosody rate="%f">%s</prosody>`, req.Speed, escapeSSML(req.Content))
+	if req.Pitch != "" {
+		prosody = fmt.Sprintf(`<prosody rate="%f" pitch="%s">%s</prosody>`, req.Speed, escapeSSML(req.Pitch), escapeSSML(req.Content))
+	}
+	namespace := ""
+	if req.Style != "" {
+		namespace = ` xmlns:mstts="https://www.w3.org/2001/mstts"`
+		prosody = fmt.Sprintf(`<mstts:express-as style="%s">%s</mstts:express-as>`, escapeSSML(req.Style), prosody)
+	}
+	return fmt.Sprintf(`
+		<speak version="1.0"%s xml:lang="%s">
+		<voice xml:lang="%s" xml:gender="%s" name="%s">
+		%s
+		</voice>
+		</speak>`, namespace, req.Lang, req.Lang, req.Gender, req.Reader, prosody)
+}
+
+// adoptLegacyFile moves the audio cached under the MD5 key of req, if any,
+// to req.Dest, so that audio synthesized before KEY_VERSION 2 is not
+// requested again. The old key stays an alias of the new one in the index.
+func adoptLegacyFile(req TTSRequest) bool {
+	legacy := LegacyKey(req)
+	if legacy == "" {
+		return false
+	}
+	old := filepath.Join(filepath.Dir(req.Dest), legacy+filepath.Ext(req.Dest))
+	if valid, _ := IsAudioFileValid(old); !valid {
+		return false
+	}
+	if err := os.Rename(old, req.Dest); err != nil {
+		logger.LogDebug("Could not adopt %s: %v", old, err)
+		return false
+	}
+	logger.LogDebug("Adopted legacy cache file %s as %s", old, req.Dest)
+	if err := cache.Rekey(filepath.Dir(req.Dest), legacy, req.Md5, filepath.Base(req.Dest)); err != nil {
+		logger.LogWarn("Could not update the cache index: %v", err)
+	}
+	return true
+}
+
+// escapeSSML escapes the characters of content that are markup in SSML, such
+// as the "&" common in fetched articles.
+func escapeSSML(content string) string {
+	var b strings.Builder
+	if err := xml.EscapeText(&b, []byte(content)); err != nil {
+		return content
+	}
+	return b.String()
+}
+
+// IsAudioFileValid checks that the audio file exists and is complete, by
+// parsing its container headers.
 func IsAudioFileValid(file string) (bool, error) {
 	if _, err := os.Stat(file); err != nil {
 		logger.LogDebug("Warning: Audio file does not exist: %s; err: %v", file, err)
 		return false, err
 	}
-
-	// Check if file has minimum size (not empty/corrupted)
-	if fileInfo, err := os.Stat(file); err == nil {
-		if fileInfo.Size() < 1000 {
-			logger.LogWarn("Warning: Audio file appears to be corrupted or empty (size: %d bytes)", fileInfo.Size())
-			return false, fmt.Errorf("file too small: %d bytes", fileInfo.Size())
-		}
+	if _, err := audio.Probe(file); err != nil {
+		logger.LogWarn("Warning: Audio file is corrupted: %v", err)
+		return false, err
 	}
 	return true, nil
 }
@@ -99,8 +99,8 @@ func TestNewTTSRequest(t *testing.T) {
 			if got.Speed != 0.8 {
 				t.Errorf("Speed = %v, want 0.8", got.Speed)
 			}
-			if got.Gender != "Male" {
-				t.Errorf("Gender = %v, want Male", got.Gender)
+			if want := config.LangGender(tt.lang); got.Gender != want {
+				t.Errorf("Gender = %v, want %v", got.Gender, want)
 			}
 
 			// Test that Dest and Md5 are set (non-empty)
@@ -13,3 +13,28 @@ func TestToHomeRelativePath(t *testing.T) {
 		t.Errorf("Expected path to start with ~, got %s", rel)
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/out.bin"
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("new content"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "new content" {
+		t.Errorf("Unexpected content %q", data)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Errorf("Unexpected mode %v", fi.Mode())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary file left, got %d entries", len(entries))
+	}
+	if err := WriteFileAtomic(dir+"/missing/out.bin", nil, 0644); err == nil {
+		t.Error("Expected error for a missing directory")
+	}
+}
@@ -3,9 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/zhasm/tts-reader/pkg/logger"
@@ -13,11 +13,17 @@ import (
 
 const (
 	DEFAULT_LOG_LEVEL = "info"
+	DEFAULT_LANGUAGE  = "fr"
+	DEFAULT_SPEED     = 0.8
+	DEFAULT_GAP       = time.Second
+	// DEFAULT_SHADOW_FACTOR leaves a bit more time to repeat a phrase than
+	// it takes to hear it.
+	DEFAULT_SHADOW_FACTOR = 1.2
 )
 
 var (
-	Language    string
-	Speed       float64 = 0.8
+	Language    string  = DEFAULT_LANGUAGE
+	Speed       float64 = DEFAULT_SPEED
 	Content     string
 	Help        bool
 	Version     bool
@@ -27,6 +33,22 @@ var (
 	OverWrite   bool
 	LogLevel    string = DEFAULT_LOG_LEVEL
 	ConfigFile  string
+	Tags        []string
+	Note        string
+	Wait        bool
+	Interrupt   bool
+	// Repeat, Gap and Ladder make a drill of the reading: each speed of
+	// Ladder is played in turn, Repeat times over, Gap apart.
+	Repeat int           = 1
+	Gap    time.Duration = DEFAULT_GAP
+	Ladder []float64
+	// Shadow plays the reading phrase by phrase, each followed by a pause
+	// ShadowFactor times as long, then sentence by sentence.
+	Shadow       bool
+	ShadowFactor float64 = DEFAULT_SHADOW_FACTOR
+
+	// UsageFooter is printed after the flag list, e.g. to list subcommands.
+	UsageFooter string
 )
 
 // Dynamic usage function that handles all flags
@@ -49,6 +71,9 @@ func customUsage() {
 		}
 		fmt.Fprintf(os.Stderr, "    \t%s\n", f.Usage)
 	})
+	if UsageFooter != "" {
+		fmt.Fprintf(os.Stderr, "\n%s", UsageFooter)
+	}
 }
 
 func PrintHelp(code int) {
@@ -75,41 +100,29 @@ func ParseArgs() error {
 		// Register flags with both short and long names using VarP
 		pflag.StringVarP(&LogLevel, "log-level", "L", DEFAULT_LOG_LEVEL, "log level: debug(d), info(i), warn(w), error(e)")
 		pflag.StringVar(&ConfigFile, "config", "", "config file path")
-		pflag.StringVarP(&Language, "language", "l", "fr", "language ("+GetAllLangShortNamesStr()+")")
-		pflag.Float64VarP(&Speed, "speed", "s", 0.8, "speed (float)")
+		pflag.StringVarP(&Language, "language", "l", DEFAULT_LANGUAGE, "language ("+GetAllLangShortNamesStr()+")")
+		pflag.Float64VarP(&Speed, "speed", "s", DEFAULT_SPEED, "speed (float)")
 		pflag.BoolVarP(&Help, "help", "h", false, "print help")
 		pflag.BoolVar(&GenConfig, "gen-config", false, "generate default tts-langs.yml config file")
 		pflag.BoolVarP(&Version, "version", "V", false, "show version info")
 		pflag.BoolVarP(&DryRun, "dry-run", "d", false, "dry run mode (no changes will be made)")
 		pflag.BoolVarP(&OverWrite, "over-write", "o", false, "force re-download even if file exists")
+		pflag.StringSliceVarP(&Tags, "tag", "t", nil, "tag the reading, e.g. lesson3 (repeatable)")
+		pflag.StringVar(&Note, "note", "", "free-text note stored with the reading, e.g. its translation")
+		pflag.BoolVarP(&Wait, "wait", "w", false, "play in the foreground with controls: space pause, r replay, arrows seek, +/- speed, q quit")
+		pflag.IntVar(&Repeat, "repeat", 1, "play the reading this many times, for listening practice")
+		pflag.DurationVar(&Gap, "gap", DEFAULT_GAP, "silence between the plays of --repeat and --ladder, e.g. 2s")
+		pflag.Float64SliceVar(&Ladder, "ladder", nil, "play the reading at each of these speeds in turn, e.g. 0.6,0.8,1.0")
+		pflag.BoolVar(&Shadow, "shadow", false, "shadowing practice: play each phrase followed by a pause to repeat it, then the whole sentence")
+		pflag.Float64Var(&ShadowFactor, "shadow-factor", DEFAULT_SHADOW_FACTOR, "length of the --shadow pauses, as a multiple of the phrase")
+		pflag.BoolVarP(&Interrupt, "interrupt", "i", false, "with the queue daemon running, play now instead of after the queued readings")
 
 		pflag.Parse()
-		// Validate log level
-		LogLevel = strings.ToLower(LogLevel)
-		// Map single-letter aliases to full log level names
-		switch LogLevel {
-		case "d":
-			LogLevel = "debug"
-		case "i":
-			LogLevel = "info"
-		case "w":
-			LogLevel = "warn"
-		case "e":
-			LogLevel = "error"
-		}
-		validLogLevels := map[string]bool{
-			"debug": true,
-			"info":  true,
-			"warn":  true,
-			"error": true,
-		}
-		if !validLogLevels[LogLevel] {
-			fmt.Fprintf(os.Stderr, "Error: invalid log level: %s\n", LogLevel)
+		if err := applyLogLevel(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			fmt.Fprintf(os.Stderr, "Valid log levels: debug(d), info(i), warn(w), error(e)\n")
 			os.Exit(2)
 		}
-		// Set logger log level
-		logger.SetLogLevel(LogLevel)
 		// Positional argument (content)
 		remaining := pflag.Args()
 		if len(remaining) > 0 {
@@ -119,6 +132,35 @@ func ParseArgs() error {
 	return parseErr
 }
 
+// applyLogLevel normalizes LogLevel, maps single-letter aliases to full names
+// and hands the result to the logger.
+func applyLogLevel() error {
+	LogLevel = strings.ToLower(LogLevel)
+	// Map single-letter aliases to full log level names
+	switch LogLevel {
+	case "d":
+		LogLevel = "debug"
+	case "i":
+		LogLevel = "info"
+	case "w":
+		LogLevel = "warn"
+	case "e":
+		LogLevel = "error"
+	}
+	validLogLevels := map[string]bool{
+		"debug": true,
+		"info":  true,
+		"warn":  true,
+		"error": true,
+	}
+	if !validLogLevels[LogLevel] {
+		return fmt.Errorf("invalid log level: %s", LogLevel)
+	}
+	// Set logger log level
+	logger.SetLogLevel(LogLevel)
+	return nil
+}
+
 // ValidateAndHandleArgs checks for help/version flags, missing content, and language validity. Exits if any are triggered.
 func ValidateAndHandleArgs() error {
 	if Version {
@@ -143,23 +185,42 @@ func ValidateAndHandleArgs() error {
 		PrintHelp(1)
 		return fmt.Errorf("content argument is missing")
 	}
-
-	// Check if Content is an HTTP/HTTPS URL (case-insensitive)
-	urlRegex := regexp.MustCompile(`(?i)https?://`)
-	if urlRegex.MatchString(Content) {
-		logger.LogError("Content is a URL: %s", Content)
-		msg := "content must not contain http/https"
-		return fmt.Errorf("%s", msg)
+	if Repeat < 1 {
+		return fmt.Errorf("--repeat must be at least 1")
+	}
+	if Gap < 0 {
+		return fmt.Errorf("--gap must not be negative")
+	}
+	if ShadowFactor < 0 {
+		return fmt.Errorf("--shadow-factor must not be negative")
+	}
+	if Shadow && IsDrill() {
+		return fmt.Errorf("--shadow cannot be combined with --repeat or --ladder")
+	}
+	// Drills time their own pauses, which the controls of --wait would break.
+	if Wait && (Shadow || IsDrill()) {
+		return fmt.Errorf("--wait cannot be combined with --shadow, --repeat or --ladder")
 	}
 
 	return nil
 }
 
+// IsDrill reports whether the reading is to be played as a drill.
+func IsDrill() bool {
+	return Repeat > 1 || len(Ladder) > 0
+}
+
+// IsFlagSet reports whether the named flag was given on the command line.
+func IsFlagSet(name string) bool {
+	f := pflag.Lookup(name)
+	return f != nil && f.Changed
+}
+
 // ResetArgs resets all flag variables and parseOnce for testing
 func ResetArgs() {
 	LogLevel = DEFAULT_LOG_LEVEL
-	Language = "fr"
-	Speed = 0.8
+	Language = DEFAULT_LANGUAGE
+	Speed = DEFAULT_SPEED
 	Content = ""
 	Help = false
 	Version = false
@@ -168,6 +229,15 @@ func ResetArgs() {
 	DryRun = false
 	OverWrite = false
 	ConfigFile = ""
+	Tags = nil
+	Note = ""
+	Wait = false
+	Interrupt = false
+	Repeat = 1
+	Gap = DEFAULT_GAP
+	Ladder = nil
+	Shadow = false
+	ShadowFactor = DEFAULT_SHADOW_FACTOR
 	parseOnce = sync.Once{}
 	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"flag"
 	"os"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestPrintVersion(t *testing.T) {
@@ -112,6 +114,42 @@ func TestParseArgs_ShortDryRun(t *testing.T) {
 	}
 }
 
+func TestParseArgs_Drill(t *testing.T) {
+	ResetArgs()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--repeat", "3", "--gap", "2s", "--ladder", "0.6,0.8,1.0", "bonjour"}
+	_ = ParseArgs()
+	if Repeat != 3 || Gap != 2*time.Second || !slices.Equal(Ladder, []float64{0.6, 0.8, 1.0}) || !IsDrill() {
+		t.Errorf("Expected a drill of 3 repeats 2s apart at 0.6,0.8,1.0, got %d, %v, %v", Repeat, Gap, Ladder)
+	}
+	Wait = true
+	if err := ValidateAndHandleArgs(); err == nil {
+		t.Error("Expected an error for --wait with a drill")
+	}
+	Repeat, Ladder, Shadow = 1, nil, true
+	if err := ValidateAndHandleArgs(); err == nil {
+		t.Error("Expected an error for --wait with --shadow")
+	}
+	Wait, Shadow, Repeat = false, false, 0
+	if err := ValidateAndHandleArgs(); err == nil {
+		t.Error("Expected an error for --repeat 0")
+	}
+	ResetArgs()
+	if IsDrill() {
+		t.Error("Expected no drill by default")
+	}
+}
+
+func TestParseArgs_CommandNameAsContent(t *testing.T) {
+	ResetArgs()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--", "sync"}
+	_ = ParseArgs()
+	if Content != "sync" {
+		t.Errorf("Expected the text after -- to be read, got %q", Content)
+	}
+}
+
 func TestParseArgs_InvalidLang(t *testing.T) {
 	ResetArgs()
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheConfig limits the local audio cache in TTS_PATH. Zero values mean no
+// limit.
+type CacheConfig struct {
+	// MaxSize is a size such as "500MB" or "2G".
+	MaxSize string        `yaml:"max_size,omitempty"`
+	MaxAge  time.Duration `yaml:"max_age,omitempty"`
+	// Remote is the base URL of the team cache checked before synthesizing,
+	// the public storage URL by default. REMOTE_CACHE_OFF disables it.
+	Remote string `yaml:"remote,omitempty"`
+}
+
+const REMOTE_CACHE_OFF = "off"
+
+// Cache holds the cache section of the config file.
+var Cache CacheConfig
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses sizes such as "1024", "500MB" or "1.5G" into bytes. Units
+// are binary: 1KB is 1024 bytes. An empty string is zero.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	factor := int64(1)
+	for _, u := range sizeUnits {
+		if num, found := strings.CutSuffix(s, u.suffix); found {
+			s, factor = strings.TrimSpace(num), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(n * float64(factor)), nil
+}
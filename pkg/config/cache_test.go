@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":      0,
+		"1024":  1024,
+		"500MB": 500 << 20,
+		"1.5g":  3 << 29,
+		"64 KB": 64 << 10,
+		"2T":    2 << 40,
+		"100 B": 100,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseSize("lots"); err == nil {
+		t.Error("Expected error for invalid size")
+	}
+}
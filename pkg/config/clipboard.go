@@ -0,0 +1,22 @@
+package config
+
+// Clipboard providers besides the copy commands, which are named after their
+// executable.
+const (
+	CLIPBOARD_AUTO    = "auto"
+	CLIPBOARD_OFF     = "off"
+	CLIPBOARD_OSC52   = "osc52"
+	CLIPBOARD_COMMAND = "command"
+)
+
+// ClipboardConfig chooses how the URL of published audio is copied.
+type ClipboardConfig struct {
+	// Provider is auto (default), off, osc52, command, or one of pbcopy,
+	// wl-copy, xclip and xsel.
+	Provider string `yaml:"provider,omitempty"`
+	// Command receives the text on stdin when Provider is command.
+	Command string `yaml:"command,omitempty"`
+}
+
+// Clipboard holds the clipboard section of the config file.
+var Clipboard ClipboardConfig
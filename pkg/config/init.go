@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
+	"github.com/spf13/pflag"
 	"github.com/zhasm/tts-reader/pkg/logger"
 )
 
@@ -36,6 +38,12 @@ func Init() {
 		LoadConfig()
 	}
 
+	loadEnv()
+}
+
+// loadEnv reads the API credentials from the environment and exits when any
+// of them is missing.
+func loadEnv() {
 	TTS_API_KEY = os.Getenv("TTS_API_KEY")
 	if TTS_API_KEY == "" {
 		logger.LogError("Warning: TTS_API_KEY environment variable is not set")
@@ -56,3 +64,39 @@ func Init() {
 		logger.LogDebug("R2_DB_TOKEN loaded successfully (length: %d)", len(R2_DB_TOKEN))
 	}
 }
+
+// InitCommand parses the flags of a subcommand, together with the common
+// --config and --log-level flags, then loads the config file. Credentials are
+// read from the environment but not enforced; commands that need them call
+// RequireAPIKey or RequireDBToken.
+func InitCommand(fs *pflag.FlagSet, args []string) error {
+	fs.StringVarP(&LogLevel, "log-level", "L", DEFAULT_LOG_LEVEL, "log level: debug(d), info(i), warn(w), error(e)")
+	fs.StringVar(&ConfigFile, "config", "", "config file path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := applyLogLevel(); err != nil {
+		return err
+	}
+	LoadConfig()
+
+	TTS_API_KEY = os.Getenv("TTS_API_KEY")
+	R2_DB_TOKEN = os.Getenv("R2_DB_TOKEN")
+	return nil
+}
+
+// RequireAPIKey returns an error when TTS_API_KEY is not set.
+func RequireAPIKey() error {
+	if TTS_API_KEY == "" {
+		return fmt.Errorf("TTS_API_KEY environment variable is not set")
+	}
+	return nil
+}
+
+// RequireDBToken returns an error when R2_DB_TOKEN is not set.
+func RequireDBToken() error {
+	if R2_DB_TOKEN == "" {
+		return fmt.Errorf("R2_DB_TOKEN environment variable is not set")
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/zhasm/tts-reader/pkg/logger"
 	"gopkg.in/yaml.v3"
@@ -24,7 +25,12 @@ type Lang struct {
 }
 
 type LangConfig struct {
-	Langs []Lang `yaml:"langs"`
+	Langs     []Lang          `yaml:"langs"`
+	Cache     CacheConfig     `yaml:"cache,omitempty"`
+	S3        S3Config        `yaml:"s3,omitempty"`
+	Storage   StorageConfig   `yaml:"storage,omitempty"`
+	Clipboard ClipboardConfig `yaml:"clipboard,omitempty"`
+	Player    PlayerConfig    `yaml:"player,omitempty"`
 }
 
 // Define the supported languages
@@ -85,6 +91,20 @@ func GetLang(name string) (Lang, bool) {
 	return Lang{}, false
 }
 
+// DEFAULT_GENDER is the voice gender of languages that do not set one.
+const DEFAULT_GENDER = "Male"
+
+// LangGender returns the voice gender of lang, given by its short or full
+// name.
+func LangGender(lang string) string {
+	for _, l := range Langs {
+		if (l.Name == lang || l.NameFUll == lang) && l.Gender != "" {
+			return l.Gender
+		}
+	}
+	return DEFAULT_GENDER
+}
+
 // GetRegex returns the regex of given language.
 func ValidateLangRegex(langName, content string) (bool, error) {
 	for _, l := range Langs {
@@ -99,6 +119,49 @@ func ValidateLangRegex(langName, content string) (bool, error) {
 	return false, fmt.Errorf("not supported language: %s", langName)
 }
 
+// GetLangByCode returns the Lang whose full name matches a BCP 47 language
+// tag such as "fr", "ja-JP" or "pl-pl", comparing the primary subtag only.
+func GetLangByCode(code string) (Lang, bool) {
+	primary := func(tag string) string {
+		tag, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		return tag
+	}
+	want := primary(strings.ReplaceAll(code, "_", "-"))
+	if want == "" {
+		return Lang{}, false
+	}
+	for _, l := range Langs {
+		if primary(l.NameFUll) == want {
+			return l, true
+		}
+	}
+	return Lang{}, false
+}
+
+// DetectLang returns the language whose regex matches the most runes of
+// content. Ties go to the current Language, so that a text matched equally by
+// several Latin-script languages keeps the one the user chose.
+func DetectLang(content string) (Lang, bool) {
+	var (
+		best      Lang
+		bestScore int
+	)
+	for _, l := range Langs {
+		re, err := regexp.Compile(l.Regex)
+		if err != nil || l.Regex == "" {
+			continue
+		}
+		score := 0
+		for _, m := range re.FindAllString(content, -1) {
+			score += utf8.RuneCountInString(m)
+		}
+		if score > bestScore || (score == bestScore && score > 0 && l.Name == Language) {
+			best, bestScore = l, score
+		}
+	}
+	return best, bestScore > 0
+}
+
 // GetFlagByName returns the flag emoji for the given language name.
 // If the language is not supported, it returns an empty string.
 func GetFlagByName(name string) string {
@@ -170,6 +233,11 @@ func LoadConfig() {
 				logger.LogWarn("Error parsing config file %s: %v. Using defaults.", configPath, err)
 				Langs = DefaultLangs
 			} else {
+				Cache = config.Cache
+				S3 = config.S3
+				Storage = config.Storage
+				Clipboard = config.Clipboard
+				Player = config.Player
 				if len(config.Langs) == 0 {
 					logger.LogWarn("Config file %s has no languages. Using defaults.", configPath)
 					Langs = DefaultLangs
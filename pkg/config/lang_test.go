@@ -22,6 +22,18 @@ func TestGetLang(t *testing.T) {
 	}
 }
 
+func TestLangGender(t *testing.T) {
+	if got := LangGender("pl-PL"); got != "Female" {
+		t.Errorf("LangGender(pl-PL) = %s, want Female", got)
+	}
+	if got := LangGender("fr"); got != "Male" {
+		t.Errorf("LangGender(fr) = %s, want Male", got)
+	}
+	if got := LangGender("xx"); got != DEFAULT_GENDER {
+		t.Errorf("LangGender(xx) = %s, want %s", got, DEFAULT_GENDER)
+	}
+}
+
 func TestGetFlag(t *testing.T) {
 	flag := GetFlagByName("fr")
 	if flag == "" {
@@ -32,3 +44,27 @@ func TestGetFlag(t *testing.T) {
 		t.Error("Expected empty flag for unsupported language")
 	}
 }
+
+func TestGetLangByCode(t *testing.T) {
+	if lang, found := GetLangByCode("ja"); !found || lang.Name != "jp" {
+		t.Errorf("Expected 'ja' to map to jp, got %+v", lang)
+	}
+	if lang, found := GetLangByCode("fr_CA"); !found || lang.Name != "fr" {
+		t.Errorf("Expected 'fr_CA' to map to fr, got %+v", lang)
+	}
+	if _, found := GetLangByCode("xx"); found {
+		t.Error("Expected not to find 'xx'")
+	}
+}
+
+func TestDetectLang(t *testing.T) {
+	if lang, found := DetectLang("今日はいい天気ですね"); !found || lang.Name != "jp" {
+		t.Errorf("Expected jp, got %+v", lang)
+	}
+	if lang, found := DetectLang("Zażółć gęślą jaźń"); !found || lang.Name != "pl" {
+		t.Errorf("Expected pl, got %+v", lang)
+	}
+	if _, found := DetectLang("12345"); found {
+		t.Error("Expected no language for digits")
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PLAYER_COMMAND names the player running the command template of the player
+// section.
+const PLAYER_COMMAND = "command"
+
+// DEFAULT_PLAYER_ORDER is the order players are probed in when the config
+// does not set one.
+var DEFAULT_PLAYER_ORDER = []string{"ffplay", "mpv", "pw-play", "paplay", "aplay"}
+
+// PLAYER_SOCKET_NAME is the file name of the socket of the playback queue.
+const PLAYER_SOCKET_NAME = "tts-reader-player.sock"
+
+// PlayerConfig chooses how audio is played.
+type PlayerConfig struct {
+	// Order lists the players probed, the first one installed and able to
+	// play the file winning. Names are those of DEFAULT_PLAYER_ORDER and
+	// command. TTS_PLAYER, a comma separated list, overrides it.
+	Order []string `yaml:"order,omitempty"`
+	// Command is the template of the command player, e.g.
+	// "vlc --intf dummy --play-and-exit {file}". {file} is the audio file,
+	// {speed} the playback rate, {start} the second to start at; without
+	// {file} the audio is sent on stdin.
+	Command string `yaml:"command,omitempty"`
+	// Formats lists the MIME types the command plays (default: any).
+	Formats []string `yaml:"formats,omitempty"`
+	// Socket is the Unix socket of the playback queue daemon (default:
+	// $XDG_RUNTIME_DIR, else a directory of the user in the temporary one).
+	// TTS_PLAYER_SOCKET overrides it.
+	Socket string `yaml:"socket,omitempty"`
+}
+
+// Player holds the player section of the config file.
+var Player PlayerConfig
+
+// PlayerOrder returns the players to probe, from the environment, the config
+// file or the defaults.
+func PlayerOrder() []string {
+	if env := os.Getenv("TTS_PLAYER"); env != "" {
+		var order []string
+		for _, name := range strings.Split(env, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				order = append(order, name)
+			}
+		}
+		return order
+	}
+	if len(Player.Order) > 0 {
+		return Player.Order
+	}
+	return DEFAULT_PLAYER_ORDER
+}
+
+// PlayerSocket returns the socket the playback queue daemon listens on.
+func PlayerSocket() string {
+	if env := os.Getenv("TTS_PLAYER_SOCKET"); env != "" {
+		return env
+	}
+	if Player.Socket != "" {
+		return Player.Socket
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, PLAYER_SOCKET_NAME)
+	}
+	// Not TTS_PATH, which may be a synced folder.
+	return filepath.Join(os.TempDir(), fmt.Sprintf("tts-reader-%d", os.Getuid()), PLAYER_SOCKET_NAME)
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	DEFAULT_S3_BUCKET = "tts"
+	// DEFAULT_S3_REGION is what R2 expects in signatures.
+	DEFAULT_S3_REGION = "auto"
+)
+
+// S3Config locates the S3-compatible bucket audio is uploaded to. The
+// environment variables R2_ENDPOINT, R2_BUCKET, R2_REGION, R2_ACCESS_KEY_ID
+// and R2_SECRET_ACCESS_KEY override the s3 section of the config file, which
+// should not hold the secret in shared setups.
+type S3Config struct {
+	// Endpoint is e.g. https://<account>.r2.cloudflarestorage.com.
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Bucket          string `yaml:"bucket,omitempty"`
+	Region          string `yaml:"region,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+}
+
+// S3 holds the s3 section of the config file.
+var S3 S3Config
+
+// ResolveS3 returns the S3 settings from the config file and the environment,
+// with defaults filled in, or an error naming what is missing.
+func ResolveS3() (S3Config, error) {
+	c := S3
+	for _, v := range []struct {
+		field *string
+		env   string
+		def   string
+	}{
+		{&c.Endpoint, "R2_ENDPOINT", ""},
+		{&c.Bucket, "R2_BUCKET", DEFAULT_S3_BUCKET},
+		{&c.Region, "R2_REGION", DEFAULT_S3_REGION},
+		{&c.AccessKeyID, "R2_ACCESS_KEY_ID", ""},
+		{&c.SecretAccessKey, "R2_SECRET_ACCESS_KEY", ""},
+	} {
+		if env := os.Getenv(v.env); env != "" {
+			*v.field = env
+		}
+		if *v.field == "" {
+			if v.def == "" {
+				return c, fmt.Errorf("S3 upload is not configured: set %s or the s3 section of the config", v.env)
+			}
+			*v.field = v.def
+		}
+	}
+	return c, nil
+}
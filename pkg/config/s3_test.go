@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestResolveS3(t *testing.T) {
+	old := S3
+	defer func() { S3 = old }()
+	S3 = S3Config{Endpoint: "https://r2.example.com", Bucket: "audio", AccessKeyID: "from-file"}
+	t.Setenv("R2_ENDPOINT", "")
+	t.Setenv("R2_BUCKET", "")
+	t.Setenv("R2_REGION", "")
+	t.Setenv("R2_ACCESS_KEY_ID", "from-env")
+	t.Setenv("R2_SECRET_ACCESS_KEY", "secret")
+
+	c, err := ResolveS3()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := S3Config{Endpoint: "https://r2.example.com", Bucket: "audio", Region: DEFAULT_S3_REGION, AccessKeyID: "from-env", SecretAccessKey: "secret"}
+	if c != want {
+		t.Errorf("ResolveS3() = %+v, want %+v", c, want)
+	}
+
+	t.Setenv("R2_SECRET_ACCESS_KEY", "")
+	if _, err := ResolveS3(); err == nil {
+		t.Error("Expected error without a secret key")
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Storage backends audio is published to.
+const (
+	STORAGE_S3     = "s3"
+	STORAGE_LOCAL  = "local"
+	STORAGE_WEBDAV = "webdav"
+)
+
+var STORAGE_BACKENDS = []string{STORAGE_S3, STORAGE_LOCAL, STORAGE_WEBDAV}
+
+// StorageConfig chooses where audio is published. The s3 backend reads its
+// bucket from the s3 section.
+type StorageConfig struct {
+	// Backend is one of STORAGE_BACKENDS, s3 by default.
+	Backend string `yaml:"backend,omitempty"`
+	// PublicURL is the base URL the published audio is served from. It
+	// defaults to the public R2 bucket, the WebDAV URL or a file:// URL.
+	PublicURL string       `yaml:"public_url,omitempty"`
+	Dir       string       `yaml:"dir,omitempty"`
+	WebDAV    WebDAVConfig `yaml:"webdav,omitempty"`
+}
+
+// WebDAVConfig locates a WebDAV collection, e.g. on a NAS. WEBDAV_URL,
+// WEBDAV_USER and WEBDAV_PASSWORD override it.
+type WebDAVConfig struct {
+	URL      string `yaml:"url,omitempty"`
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// Storage holds the storage section of the config file.
+var Storage StorageConfig
+
+// StorageBackend returns the configured backend, checked against
+// STORAGE_BACKENDS.
+func StorageBackend() (string, error) {
+	b := strings.ToLower(Storage.Backend)
+	if b == "" {
+		return STORAGE_S3, nil
+	}
+	if !slices.Contains(STORAGE_BACKENDS, b) {
+		return "", fmt.Errorf("invalid storage backend: %s (%s)", Storage.Backend, strings.Join(STORAGE_BACKENDS, ", "))
+	}
+	return b, nil
+}
+
+// ResolveWebDAV returns the WebDAV settings from the config file and the
+// environment.
+func ResolveWebDAV() (WebDAVConfig, error) {
+	c := Storage.WebDAV
+	for _, v := range []struct {
+		field *string
+		env   string
+	}{
+		{&c.URL, "WEBDAV_URL"},
+		{&c.User, "WEBDAV_USER"},
+		{&c.Password, "WEBDAV_PASSWORD"},
+	} {
+		if env := os.Getenv(v.env); env != "" {
+			*v.field = env
+		}
+	}
+	if c.URL == "" {
+		return c, fmt.Errorf("WebDAV storage is not configured: set WEBDAV_URL or storage.webdav.url")
+	}
+	return c, nil
+}